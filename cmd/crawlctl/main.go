@@ -0,0 +1,88 @@
+package main
+
+import (
+	"database/sql"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/mp-hl-2021/unarXiv/internal/interface/crawler"
+
+	_ "github.com/lib/pq"
+)
+
+const usage = `usage: crawlctl [-host db] command [arguments]
+
+commands:
+  failures [-limit n] [-snippets]   list URLs the crawler gave up on
+  requeue [-all] [url ...]          put failed URLs back to the crawl queue
+`
+
+// crawlctl lets operators inspect and requeue URLs in the dead-letter table of the crawler.
+func main() {
+	host := flag.String("host", "db", "database host")
+	flag.Usage = func() { fmt.Fprint(flag.CommandLine.Output(), usage) }
+	flag.Parse()
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	dbConnStr := fmt.Sprintf("postgres://%s@%s/%s?sslmode=disable", os.Getenv("dbusername"), *host, os.Getenv("dbname"))
+	db, err := sql.Open("postgres", dbConnStr)
+	if err != nil {
+		panic(err)
+	}
+	defer db.Close()
+	c := crawler.NewCrawler(db, nil, nil, "")
+
+	args := flag.Args()
+	switch args[0] {
+	case "failures":
+		listFailures(c, args[1:])
+	case "requeue":
+		requeue(c, args[1:])
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+}
+
+func listFailures(c *crawler.Crawler, args []string) {
+	fs := flag.NewFlagSet("failures", flag.ExitOnError)
+	limit := fs.Int("limit", 50, "number of URLs to list")
+	snippets := fs.Bool("snippets", false, "print beginnings of the failed pages")
+	fs.Parse(args)
+
+	failures, err := c.FailedURLs(*limit)
+	if err != nil {
+		fmt.Println("cannot list failures:", err)
+		os.Exit(1)
+	}
+	for _, f := range failures {
+		failedAt := time.Unix(0, int64(f.FailedAt)).UTC().Format(time.RFC3339)
+		fmt.Printf("%s\t%s\tattempts=%d\tstatus=%d\t%s\n", failedAt, f.URL, f.Attempts, f.HTTPStatus, f.Error)
+		if *snippets && f.Snippet != "" {
+			fmt.Println("\t" + strings.ReplaceAll(f.Snippet, "\n", "\n\t"))
+		}
+	}
+}
+
+func requeue(c *crawler.Crawler, args []string) {
+	fs := flag.NewFlagSet("requeue", flag.ExitOnError)
+	all := fs.Bool("all", false, "requeue all failed URLs")
+	fs.Parse(args)
+
+	n, err := c.RequeueFailed(fs.Args(), *all)
+	if err == crawler.ErrNothingToRequeue {
+		fmt.Println("give URLs to requeue or -all")
+		os.Exit(2)
+	}
+	if err != nil {
+		fmt.Println("cannot requeue:", err)
+		os.Exit(1)
+	}
+	fmt.Printf("requeued %d URLs\n", n)
+}
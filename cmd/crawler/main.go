@@ -1,11 +1,16 @@
 package main
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"github.com/mp-hl-2021/unarXiv/internal/interface/crawler"
 	"github.com/mp-hl-2021/unarXiv/internal/interface/repository/postgres"
+	"github.com/mp-hl-2021/unarXiv/internal/interface/warc"
+	"io"
+	"net/http"
 	"os"
+	"strings"
 	"time"
 
 	_ "github.com/lib/pq"
@@ -19,19 +24,173 @@ func main() {
 	}
 	defer db.Close()
 
-	articleRepo := postgres.NewArticleRepo(db)
+	textSearch := postgres.TextSearchConfig{
+		Default:        os.Getenv("textsearchconfig"),
+		DetectLanguage: os.Getenv("detectlanguage") == "true",
+	}
+	if err := textSearch.Validate(); err != nil {
+		panic(err)
+	}
+
+	articleRepo := postgres.NewArticleRepo(db, textSearch)
+
+	userAgent := envOr("useragent", crawler.DefaultUserAgent)
+	fetcher, closeFetcher, err := newFetcher(db, userAgent)
+	if err != nil {
+		panic(err)
+	}
+	defer closeFetcher()
+
+	c := crawler.NewCrawler(db, articleRepo, fetcher, envOr("workerid", crawler.DefaultWorkerId()))
+	go c.RunMetricsServer(os.Getenv("admintoken"))
 
-	c := crawler.NewCrawler(db, articleRepo)
-	go c.RunMetricsServer()
+	switch os.Getenv("source") {
+	case "oai":
+		harvest(c, userAgent)
+	case "atom":
+		fetchAtom(c, userAgent)
+	}
 
 	for {
-		cfg, err := c.GetConfiguration()
+		// failures of single URLs are retried by the crawler itself and failed
+		// pipelines are restarted, what stops a crawl is a signal, after which
+		// leases are released and the worker exits, or the database going away
+		err := c.CrawlArticles()
+		if err == nil {
+			return
+		}
+		fmt.Println("Crawling stopped:", err)
+		time.Sleep(time.Minute)
+	}
+}
+
+// newFetcher fetches live pages politely, keeping crawl delays of all replicas
+// in db, or replays WARC files listed in warcreplay instead. Fetched pages are also recorded to warcrecord if set,
+// compressed if its name ends with .gz.
+func newFetcher(db *sql.DB, userAgent string) (crawler.Fetcher, func() error, error) {
+	var fetcher crawler.Fetcher
+	var files []*os.File
+	closeFiles := func() error {
+		for _, file := range files {
+			if err := file.Close(); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if replay := envList("warcreplay", ","); len(replay) > 0 {
+		var readers []io.Reader
+		for _, name := range replay {
+			file, err := os.Open(name)
+			if err != nil {
+				closeFiles()
+				return nil, nil, err
+			}
+			files = append(files, file)
+			readers = append(readers, file)
+		}
+		replayer, err := crawler.NewWARCReplayer(readers...)
+		closeFiles()
+		files = nil
 		if err != nil {
-			panic(err)
+			return nil, nil, err
+		}
+		fmt.Println("Replaying", replayer.Len(), "recorded URLs")
+		fetcher = replayer
+	} else {
+		crawlDelay, err := time.ParseDuration(envOr("crawldelay", "1s"))
+		if err != nil {
+			return nil, nil, err
+		}
+		fetcher = crawler.NewSharedPoliteness(userAgent, &http.Client{Timeout: time.Minute}, crawlDelay, db)
+	}
+	if name := os.Getenv("warcrecord"); name != "" {
+		file, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+		if err != nil {
+			return nil, nil, err
 		}
-		if err := c.CrawlArticles(cfg); err != nil {
+		files = append(files, file)
+		w := warc.NewWriter(file, strings.HasSuffix(name, ".gz"))
+		recorder, err := crawler.NewWARCRecorder(fetcher, w, userAgent)
+		if err != nil {
+			closeFiles()
+			return nil, nil, err
+		}
+		fetcher = recorder
+	}
+	return fetcher, closeFiles, nil
+}
+
+// harvest keeps the articles up to date through OAI-PMH instead of crawling HTML pages.
+func harvest(c *crawler.Crawler, userAgent string) {
+	cfg := crawler.OAIConfig{
+		BaseURL:        envOr("oaiurl", "http://export.arxiv.org/oai2"),
+		MetadataPrefix: envOr("oaiformat", crawler.OAIFormatArXiv),
+		Set:            os.Getenv("oaiset"),
+		RequestDelay:   5 * time.Second,
+		AbsURL:         "http://arxiv.org/abs/",
+		UserAgent:      userAgent,
+		Client:         &http.Client{Timeout: 5 * time.Minute},
+	}
+	if cfg.MetadataPrefix != crawler.OAIFormatArXiv && cfg.MetadataPrefix != crawler.OAIFormatArXivRaw {
+		panic(fmt.Sprintf("unsupported OAI-PMH metadata format %q", cfg.MetadataPrefix))
+	}
+	for {
+		// arXiv publishes new records once a day
+		if err := c.HarvestOAI(context.Background(), cfg); err != nil {
+			fmt.Println("Harvesting error:", err)
+			time.Sleep(time.Minute)
+			continue
+		}
+		time.Sleep(time.Hour)
+	}
+}
+
+// fetchAtom keeps the topics of interest up to date through the arXiv Atom API.
+func fetchAtom(c *crawler.Crawler, userAgent string) {
+	cfg := crawler.AtomConfig{
+		BaseURL:      envOr("atomurl", "http://export.arxiv.org/api/query"),
+		Queries:      envList("atomqueries", ";"),
+		Categories:   envList("atomcategories", ","),
+		Subscribed:   os.Getenv("atomsubscribed") != "false",
+		PageSize:     100,
+		MaxResults:   2000,
+		RequestDelay: 3 * time.Second,
+		UserAgent:    userAgent,
+		Client:       &http.Client{Timeout: time.Minute},
+	}
+	for {
+		crawlerCfgs, err := c.GetConfigurations()
+		if err != nil && err != crawler.ErrNoConfigs {
 			panic(err)
 		}
-		time.Sleep(time.Minute)
+		// full texts are indexed if any configuration asks for them
+		cfg.IndexFullText = false
+		for _, crawlerCfg := range crawlerCfgs {
+			cfg.IndexFullText = cfg.IndexFullText || crawlerCfg.IndexFullText
+		}
+		if err := c.FetchAtom(context.Background(), cfg); err != nil {
+			fmt.Println("Fetching error:", err)
+			time.Sleep(time.Minute)
+			continue
+		}
+		time.Sleep(time.Hour)
+	}
+}
+
+func envList(name, sep string) []string {
+	var values []string
+	for _, value := range strings.Split(os.Getenv(name), sep) {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+func envOr(name, fallback string) string {
+	if value := os.Getenv(name); value != "" {
+		return value
 	}
+	return fallback
 }
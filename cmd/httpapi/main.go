@@ -1,6 +1,8 @@
 package main
 
 import (
+	"context"
+	"crypto/rand"
 	"database/sql"
 	"flag"
 	"fmt"
@@ -9,6 +11,7 @@ import (
 	"github.com/mp-hl-2021/unarXiv/internal/interface/repository/implicitrepos"
 	"github.com/mp-hl-2021/unarXiv/internal/interface/repository/postgres"
 	"github.com/mp-hl-2021/unarXiv/internal/usecases"
+	"log"
 	"net/http"
 	"os"
 	"time"
@@ -25,6 +28,18 @@ func readCryptoKey(privateKeyPath string, publicKeyPath string) (privateKeyBytes
 	return
 }
 
+// readCursorSecret returns the key signing pagination cursors. Without
+// "cursorsecret" a random one is used, so cursors don't survive restarts.
+func readCursorSecret() ([]byte, error) {
+	if secret := os.Getenv("cursorsecret"); secret != "" {
+		return []byte(secret), nil
+	}
+	log.Printf("cursorsecret is not set, pagination cursors will be invalidated on restart")
+	secret := make([]byte, 32)
+	_, err := rand.Read(secret)
+	return secret, err
+}
+
 func main() {
 	privateKeyPath := flag.String("privateKey", "app.rsa", "file path")
 	publicKeyPath := flag.String("publicKey", "app.rsa.pub", "file path")
@@ -48,7 +63,15 @@ func main() {
 	defer db.Close()
 
 	authUsecases := auth.NewUsecases(postgres.NewAccountsRepo(db), jwtAuth)
-	articleRepo := postgres.NewArticleRepo(db)
+	textSearch := postgres.TextSearchConfig{
+		Default:        os.Getenv("textsearchconfig"),
+		DetectLanguage: os.Getenv("detectlanguage") == "true",
+	}
+	if err := textSearch.Validate(); err != nil {
+		panic(err)
+	}
+
+	articleRepo := postgres.NewArticleRepo(db, textSearch)
 	artSubsRepo := postgres.NewArticleSubscriptionRepo(db)
 	searchSubsRepo := postgres.NewSearchSubscriptionRepo(db)
 	updatesRepo := implicitrepos.NewUpdatesRepoThroughQueries(articleRepo, artSubsRepo, searchSubsRepo)
@@ -58,9 +81,19 @@ func main() {
 		articleRepo,
 		updatesRepo,
 		artSubsRepo,
-		searchSubsRepo)
+		searchSubsRepo,
+		postgres.NewLexiconRepo(db))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go unarXivUsecases.KeepSuggestionsFresh(ctx)
+
+	cursorSecret, err := readCursorSecret()
+	if err != nil {
+		panic(err)
+	}
 
-	httpApi := httpapi.New(unarXivUsecases)
+	httpApi := httpapi.New(unarXivUsecases, cursorSecret)
 
 	httpServer := http.Server{
 		Addr:         ":8080",
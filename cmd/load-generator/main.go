@@ -4,13 +4,17 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"github.com/brianvoe/gofakeit/v6"
 	"math/rand"
 	"net/http"
+	"net/url"
 	"os"
 	"os/signal"
+	"sort"
+	"strconv"
 	"sync"
 	"time"
 )
@@ -18,6 +22,8 @@ import (
 var config = struct {
 	address          string
 	concurrencyLevel int
+	searchLimit      int
+	subscriptions    int
 }{}
 
 var queries = []string{"plasma", "derivative", "nuclear", "learning", "theorem", "aspect", "entropy"}
@@ -25,10 +31,50 @@ var queries = []string{"plasma", "derivative", "nuclear", "learning", "theorem",
 func init() {
 	address := flag.String("address", "http://localhost:8080", "chat address")
 	concurrencyLevel := flag.Int("concurrency", 1, "a number of concurrent requests")
+	searchLimit := flag.Int("searchLimit", 100, "a number of search hits per page")
+	subscriptions := flag.Int("subscriptions", 0, "a number of searches each worker subscribes to before requesting their updates, none to skip updates")
 	flag.Parse()
 
 	config.address = *address
 	config.concurrencyLevel = *concurrencyLevel
+	config.searchLimit = *searchLimit
+	config.subscriptions = *subscriptions
+}
+
+// latencies collects durations of successful requests by kind, so that runs
+// against different server versions can be compared.
+type latencies struct {
+	mu     sync.Mutex
+	byKind map[string][]time.Duration
+}
+
+func (l *latencies) add(kind string, d time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.byKind[kind] = append(l.byKind[kind], d)
+}
+
+func (l *latencies) print() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	kinds := make([]string, 0, len(l.byKind))
+	for kind := range l.byKind {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+	for _, kind := range kinds {
+		ds := l.byKind[kind]
+		sort.Slice(ds, func(i, j int) bool { return ds[i] < ds[j] })
+		var total time.Duration
+		for _, d := range ds {
+			total += d
+		}
+		percentile := func(p int) time.Duration {
+			return ds[(len(ds)-1)*p/100]
+		}
+		fmt.Printf("%s: %d requests, mean %v, p50 %v, p95 %v, p99 %v, max %v\n",
+			kind, len(ds), total/time.Duration(len(ds)), percentile(50), percentile(95), percentile(99), ds[len(ds)-1])
+	}
 }
 
 func main() {
@@ -54,31 +100,45 @@ func main() {
 		},
 	}
 
+	l := latencies{byKind: make(map[string][]time.Duration)}
 	var wg sync.WaitGroup
 	wg.Add(config.concurrencyLevel)
 	for i := 0; i < config.concurrencyLevel; i++ {
 		go func(i int) {
-			err := worker(ctx, c)
+			err := worker(ctx, c, &l)
 			fmt.Printf("worker %d finished, err: %v\n", i, err)
 			wg.Done()
 		}(i)
 	}
 	wg.Wait()
 	fmt.Println("all workers have finished")
+	l.print()
 }
 
-func worker(ctx context.Context, c client) error {
+func worker(ctx context.Context, c client, l *latencies) error {
+	token, err := c.subscriber(ctx)
+	if err != nil {
+		return err
+	}
 	for {
 		select {
 		default:
 			var err error
-			if rand.Float32() < 0.7 {
+			kind := "register"
+			start := time.Now()
+			if r := rand.Float32(); token != "" && r < 0.3 {
+				kind = "updates"
+				err = c.searchUpdates(ctx, token)
+			} else if r < 0.7 {
 				_, err = c.createAccount(ctx, gofakeit.Username()+gofakeit.DigitN(3), gofakeit.Password(true, true, true, false, false, 16))
 			} else {
+				kind = "search"
 				_, err = c.search(ctx, queries[rand.Intn(len(queries))])
 			}
 			if err != nil {
 				fmt.Println("request failed:", err)
+			} else {
+				l.add(kind, time.Since(start))
 			}
 		case <-ctx.Done():
 			fmt.Println("leaving worker")
@@ -117,7 +177,7 @@ func (c client) createAccount(ctx context.Context, login, password string) (stri
 }
 
 func (c client) search(ctx context.Context, query string) (string, error) {
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, config.address + "/search/" + query, nil)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, config.address+"/search/"+query+"?limit="+strconv.Itoa(config.searchLimit), nil)
 	if err != nil {
 		return "", err
 	}
@@ -130,4 +190,83 @@ func (c client) search(ctx context.Context, query string) (string, error) {
 		return "", fmt.Errorf("failed to search: %v", resp.Status)
 	}
 	return resp.Header.Get("Location"), nil
-}
\ No newline at end of file
+}
+
+// subscriber registers an account subscribed to config.subscriptions searches
+// and returns its token, an empty one if updates aren't requested.
+func (c client) subscriber(ctx context.Context) (string, error) {
+	if config.subscriptions == 0 {
+		return "", nil
+	}
+	login, password := gofakeit.Username()+gofakeit.DigitN(3), gofakeit.Password(true, true, true, false, false, 16)
+	if _, err := c.createAccount(ctx, login, password); err != nil {
+		return "", err
+	}
+	token, err := c.login(ctx, login, password)
+	if err != nil {
+		return "", err
+	}
+	for i := 0; i < config.subscriptions; i++ {
+		// distinct searches, each matching articles of one of queries
+		query := queries[i%len(queries)] + " -" + gofakeit.LetterN(8)
+		if err := c.do(ctx, http.MethodPost, "/subscriptions/searches/"+url.PathEscape(query), token, http.StatusAccepted); err != nil {
+			return "", fmt.Errorf("failed to subscribe: %v", err)
+		}
+	}
+	return token, nil
+}
+
+func (c client) login(ctx context.Context, login, password string) (string, error) {
+	body := struct {
+		Login    string `json:"login"`
+		Password string `json:"password"`
+	}{login, password}
+	s, err := json.Marshal(body)
+	if err != nil {
+		panic(err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, config.address+"/login", bytes.NewReader(s))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := c.c.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("failed to login: %v", resp.Status)
+	}
+	var token struct {
+		Token string `json:"token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return "", err
+	}
+	return token.Token, nil
+}
+
+func (c client) searchUpdates(ctx context.Context, token string) error {
+	if err := c.do(ctx, http.MethodGet, "/updates/searches", token, http.StatusOK); err != nil {
+		return fmt.Errorf("failed to get updates: %v", err)
+	}
+	return nil
+}
+
+func (c client) do(ctx context.Context, method, path, token string, status int) error {
+	req, err := http.NewRequestWithContext(ctx, method, config.address+path, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err := c.c.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != status {
+		return errors.New(resp.Status)
+	}
+	return nil
+}
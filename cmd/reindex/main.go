@@ -0,0 +1,78 @@
+package main
+
+import (
+	"database/sql"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/mp-hl-2021/unarXiv/internal/interface/repository/postgres"
+
+	_ "github.com/lib/pq"
+)
+
+// reindex migrates the schema of an existing database and rebuilds the
+// full-text index of all articles, e.g. after the text search configuration or
+// the indexed document has changed. initdb.sql is only run by Postgres on an
+// empty database, so the schema is migrated with migrate.sql, which brings
+// existing tables up to date, followed by initdb.sql, which adds new ones.
+func main() {
+	host := flag.String("host", "db", "database host")
+	batchSize := flag.Int("batch", 500, "articles reindexed per statement")
+	migration := flag.String("migrate", "migrate.sql", "script migrating existing tables, empty to skip migrating")
+	schema := flag.String("schema", "initdb.sql", "script creating missing tables and indexes")
+	flag.Parse()
+
+	dbConnStr := fmt.Sprintf("postgres://%s@%s/%s?sslmode=disable", os.Getenv("dbusername"), *host, os.Getenv("dbname"))
+	db, err := sql.Open("postgres", dbConnStr)
+	if err != nil {
+		panic(err)
+	}
+	defer db.Close()
+
+	textSearch := postgres.TextSearchConfig{
+		Default:        os.Getenv("textsearchconfig"),
+		DetectLanguage: os.Getenv("detectlanguage") == "true",
+	}
+	if err := textSearch.Validate(); err != nil {
+		panic(err)
+	}
+
+	if *migration != "" {
+		if err := runScripts(db, *migration, *schema); err != nil {
+			fmt.Printf("migration failed: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Println("schema migrated")
+	}
+
+	done, err := postgres.NewArticleRepo(db, textSearch).Reindex(*batchSize, func(done int) {
+		fmt.Printf("reindexed %d articles\n", done)
+	})
+	if err != nil {
+		fmt.Printf("reindex failed after %d articles: %v\n", done, err)
+		os.Exit(1)
+	}
+	fmt.Printf("reindex finished, %d articles\n", done)
+}
+
+// runScripts runs SQL scripts in a single transaction.
+func runScripts(db *sql.DB, paths ...string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for _, path := range paths {
+		script, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		// without arguments the script is sent as a whole, statements and all
+		if _, err := tx.Exec(string(script)); err != nil {
+			return fmt.Errorf("%s: %v", path, err)
+		}
+	}
+	return tx.Commit()
+}
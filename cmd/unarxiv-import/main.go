@@ -0,0 +1,169 @@
+package main
+
+import (
+	"compress/gzip"
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/mp-hl-2021/unarXiv/internal/domain/model"
+	"github.com/mp-hl-2021/unarXiv/internal/interface/repository/postgres"
+	"github.com/mp-hl-2021/unarXiv/internal/interface/snapshot"
+
+	_ "github.com/lib/pq"
+)
+
+// unarxiv-import seeds the database from the arXiv metadata snapshot, one JSON
+// object per line, optionally gzipped. An interrupted import resumes after the
+// last batch written, unless -restart is given.
+func main() {
+	host := flag.String("host", "db", "database host")
+	batchSize := flag.Int("batch", 1000, "articles written per transaction")
+	source := flag.String("source", "", "name the progress of the import is saved under, the file name by default")
+	absURL := flag.String("abs-url", "http://arxiv.org/abs/", "prefix of abstract page URLs")
+	dryRun := flag.Bool("dry-run", false, "only validate the snapshot, without connecting to the database")
+	restart := flag.Bool("restart", false, "import from the first line, ignoring the saved progress")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: %s [flags] snapshot.json[.gz]\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 1 || *batchSize <= 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	path := flag.Arg(0)
+	if *source == "" {
+		*source = filepath.Base(path)
+	}
+
+	in, err := openSnapshot(path)
+	if err != nil {
+		fmt.Println("cannot open snapshot:", err)
+		os.Exit(1)
+	}
+	defer in.Close()
+	reader := snapshot.NewReader(in)
+
+	var repo *postgres.ArticleRepo
+	if !*dryRun {
+		dbConnStr := fmt.Sprintf("postgres://%s@%s/%s?sslmode=disable", os.Getenv("dbusername"), *host, os.Getenv("dbname"))
+		db, err := sql.Open("postgres", dbConnStr)
+		if err != nil {
+			panic(err)
+		}
+		defer db.Close()
+
+		textSearch := postgres.TextSearchConfig{
+			Default:        os.Getenv("textsearchconfig"),
+			DetectLanguage: os.Getenv("detectlanguage") == "true",
+		}
+		if err := textSearch.Validate(); err != nil {
+			panic(err)
+		}
+		repo = postgres.NewArticleRepo(db, textSearch)
+
+		if !*restart {
+			done, err := repo.ImportProgress(*source)
+			if err != nil {
+				panic(err)
+			}
+			if done > 0 {
+				fmt.Printf("resuming %s after line %d\n", *source, done)
+				if err := reader.Skip(done); err != nil {
+					fmt.Printf("cannot skip %d lines: %v\n", done, err)
+					os.Exit(1)
+				}
+			}
+		}
+	}
+
+	p := progress{start: time.Now()}
+	batch := make([]model.Article, 0, *batchSize)
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		if repo != nil {
+			if err := repo.ImportArticles(*source, reader.Line(), batch); err != nil {
+				fmt.Printf("import failed at line %d: %v\n", reader.Line(), err)
+				os.Exit(1)
+			}
+		}
+		p.imported += len(batch)
+		batch = batch[:0]
+		p.report(reader.Line())
+	}
+	for {
+		record, err := reader.Next()
+		if err == io.EOF {
+			break
+		}
+		var lineErr *snapshot.LineError
+		if err != nil && !errors.As(err, &lineErr) {
+			fmt.Println("cannot read snapshot:", err)
+			os.Exit(1)
+		}
+		if err == nil {
+			var article model.Article
+			if article, err = record.Article(*absURL); err == nil {
+				batch = append(batch, article)
+			} else {
+				err = fmt.Errorf("line %d: %s: %w", reader.Line(), record.Id, err)
+			}
+		}
+		if err != nil {
+			p.invalid++
+			fmt.Println("invalid record:", err)
+		}
+		if len(batch) == *batchSize {
+			flush()
+		}
+	}
+	flush()
+	if *dryRun {
+		fmt.Printf("dry run finished: %d valid and %d invalid records\n", p.imported, p.invalid)
+	} else {
+		fmt.Printf("import finished: %d articles imported, %d invalid records skipped\n", p.imported, p.invalid)
+	}
+	if p.invalid > 0 && *dryRun {
+		os.Exit(1)
+	}
+}
+
+func openSnapshot(path string) (io.ReadCloser, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasSuffix(path, ".gz") {
+		return f, nil
+	}
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{gz, f}, nil
+}
+
+type progress struct {
+	start    time.Time
+	imported int
+	invalid  int
+}
+
+func (p *progress) report(line int64) {
+	elapsed := time.Since(p.start)
+	fmt.Printf("line %d: %d articles, %d invalid, %.0f articles/s\n",
+		line, p.imported, p.invalid, float64(p.imported)/elapsed.Seconds())
+}
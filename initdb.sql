@@ -4,52 +4,161 @@ CREATE TABLE IF NOT EXISTS Accounts (
     Password text not null
 );
 
+CREATE TABLE IF NOT EXISTS Licenses (
+    Id serial PRIMARY KEY,
+    URL text not null unique
+);
+
 CREATE TABLE IF NOT EXISTS Articles (
     Id text PRIMARY KEY,
     Title text,
     Abstract text,
     LastUpdateTimestamp bigint,
-    FullDocumentURL text
+    FullDocumentURL text,
+    SubmittedAt bigint,
+    LatestVersionAt bigint,
+    DOI text,
+    JournalRef text,
+    Comments text,
+    LicenseId integer REFERENCES Licenses (Id)
 );
 
+CREATE INDEX IF NOT EXISTS idx_articles_full_document_url ON Articles (FullDocumentURL);
+CREATE INDEX IF NOT EXISTS idx_articles_id_pattern ON Articles (Id text_pattern_ops);
+
 CREATE TABLE IF NOT EXISTS ArticlesFTS (
     Id text PRIMARY KEY references Articles(Id),
-    TextData tsvector
+    Config regconfig not null default 'english',
+    TextData tsvector,
+    BodyData tsvector
 );
 CREATE INDEX IF NOT EXISTS idx_articles_fts_gin ON ArticlesFTS USING gin (TextData);
+CREATE INDEX IF NOT EXISTS idx_articles_fts_body_gin ON ArticlesFTS USING gin (BodyData);
+
+CREATE MATERIALIZED VIEW IF NOT EXISTS LexiconWords AS
+SELECT w.word AS Word, coalesce(t.ndoc, 0) AS TitleCount, w.ndoc AS Count
+FROM ts_stat('SELECT to_tsvector(''simple'', coalesce(Title, '''') || '' '' || coalesce(Abstract, '''')) FROM Articles') w
+LEFT JOIN ts_stat('SELECT to_tsvector(''simple'', coalesce(Title, '''')) FROM Articles') t ON t.word = w.word;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_lexicon_words ON LexiconWords (Word);
+CREATE INDEX IF NOT EXISTS idx_lexicon_words_titles ON LexiconWords (TitleCount DESC, Word) WHERE TitleCount > 0;
+CREATE INDEX IF NOT EXISTS idx_lexicon_words_count ON LexiconWords (Count DESC, Word);
+
+CREATE TABLE IF NOT EXISTS ArticleBodies (
+    ArticleId text PRIMARY KEY REFERENCES Articles (Id),
+    Body text not null,
+    ExtractedAt bigint
+);
+
+CREATE TABLE IF NOT EXISTS ArticleVersions (
+    ArticleId text REFERENCES Articles (Id),
+    Version integer not null,
+    SubmittedAt bigint,
+    Title text,
+    Abstract text,
+    Authors text[],
+    Comment text,
+    RecordedAt bigint,
+    PRIMARY KEY (ArticleId, Version)
+);
 
 CREATE TABLE IF NOT EXISTS AuthorsOfArticles (
     ArticleId text REFERENCES Articles (Id),
     AuthorName text
 );
 
+CREATE TABLE IF NOT EXISTS CategoriesOfArticles (
+    ArticleId text REFERENCES Articles (Id),
+    Category text,
+    IsPrimary boolean not null default false
+);
+
 
 CREATE TABLE IF NOT EXISTS AccountArticleRelations (
     UserId integer REFERENCES Accounts (Id),
     ArticleId text REFERENCES Articles (Id),
     IsSubscribed boolean,
-    LastAccess bigint
+    LastAccess bigint,
+    SubscribedAt bigint
 );
 
 CREATE TABLE IF NOT EXISTS AccountSearchRelations (
     UserId integer REFERENCES Accounts (Id),
     Search text,
+    Filters text not null default '',
     IsSubscribed boolean,
     LastAccess bigint
 );
 
 CREATE TABLE IF NOT EXISTS CrawlerConfig (
     RootURL text primary key,
-    DesiredArticleCount integer
+    DesiredArticleCount integer,
+    IndexFullText boolean not null default false,
+    IncludePatterns text[] not null default '{}',
+    ExcludePatterns text[] not null default '{}',
+    Concurrency integer not null default 2,
+    CrawlDelaySeconds double precision not null default 0,
+    Mode text not null default 'discover' CHECK (Mode IN ('discover', 'refresh'))
 );
-INSERT INTO CrawlerConfig VALUES ('http://arxiv.org/', 1000) ON CONFLICT DO NOTHING;
+INSERT INTO CrawlerConfig (RootURL, DesiredArticleCount) VALUES ('http://arxiv.org/', 1000) ON CONFLICT DO NOTHING;
 
 CREATE TABLE IF NOT EXISTS CrawlStatus (
     URL text not null primary key,
-    Visited boolean not null,
+    State text not null default 'queued' CHECK (State IN ('queued', 'claimed', 'fetched', 'parsed', 'failed')),
     LastAccess bigint,
-    LastHTTPStatus integer
+    LastHTTPStatus integer,
+    RetryCount integer not null default 0,
+    NextAttemptAt bigint,
+    LastError text,
+    ETag text,
+    LastModified text,
+    RecrawlInterval bigint,
+    Priority integer not null default 0,
+    LeasedBy text,
+    LeasedAt bigint,
+    LeaseExpiresAt bigint,
+    RootURL text
 );
+CREATE INDEX IF NOT EXISTS idx_crawl_status_leases ON CrawlStatus (LeaseExpiresAt) WHERE LeasedBy IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_crawl_status_queue ON CrawlStatus (RootURL, Priority DESC) WHERE State = 'queued';
 
-INSERT INTO CrawlStatus (URL, Visited) VALUES ('http://arxiv.org/', false) ON CONFLICT DO NOTHING;
+CREATE TABLE IF NOT EXISTS CrawlHosts (
+    Host text PRIMARY KEY,
+    NextSlotAt bigint not null
+);
 
+CREATE TABLE IF NOT EXISTS CrawlerControl (
+    Id integer PRIMARY KEY CHECK (Id = 1),
+    State text not null CHECK (State IN ('running', 'paused', 'draining')),
+    UpdatedAt bigint
+);
+
+CREATE TABLE IF NOT EXISTS CrawlWorkers (
+    WorkerId text PRIMARY KEY,
+    StartedAt bigint not null,
+    HeartbeatAt bigint not null
+);
+
+CREATE TABLE IF NOT EXISTS CrawlFailures (
+    URL text PRIMARY KEY REFERENCES CrawlStatus (URL),
+    Error text not null,
+    Snippet text,
+    HTTPStatus integer,
+    Attempts integer not null,
+    FailedAt bigint not null
+);
+
+CREATE TABLE IF NOT EXISTS HarvestState (
+    BaseURL text not null,
+    MetadataPrefix text not null,
+    SetSpec text not null default '',
+    FromDatestamp text not null default '',
+    ResumptionToken text not null default '',
+    UpdatedAt bigint,
+    PRIMARY KEY (BaseURL, MetadataPrefix, SetSpec)
+);
+
+CREATE TABLE IF NOT EXISTS ImportProgress (
+    Source text PRIMARY KEY,
+    Lines bigint not null,
+    UpdatedAt bigint
+);
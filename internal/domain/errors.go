@@ -12,4 +12,8 @@ var (
 	NeverAccessed = fmt.Errorf("never accessed")
 
 	ArticleNotFound = fmt.Errorf("article not found")
+	VersionNotFound = fmt.Errorf("version not found")
+	VersionNotRecorded = fmt.Errorf("version was not recorded")
+
+	InvalidPageKey = fmt.Errorf("invalid page key")
 )
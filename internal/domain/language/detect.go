@@ -0,0 +1,84 @@
+package language
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Language is a lowercase English name of a natural language, the way
+// text search configurations name them.
+type Language string
+
+const (
+	English    Language = "english"
+	French     Language = "french"
+	German     Language = "german"
+	Spanish    Language = "spanish"
+	Italian    Language = "italian"
+	Portuguese Language = "portuguese"
+	Dutch      Language = "dutch"
+	Russian    Language = "russian"
+)
+
+// stopwords are frequent function words of a language. A word listed for
+// several languages counts for each of them.
+var stopwords = map[Language][]string{
+	English:    {"the", "of", "and", "to", "is", "we", "that", "this", "with", "for", "are", "which", "by", "on", "be", "from", "it", "an", "these"},
+	French:     {"le", "les", "des", "du", "et", "est", "une", "dans", "nous", "pour", "sur", "qui", "par", "au", "aux", "ces", "sont", "avec"},
+	German:     {"der", "die", "das", "und", "ist", "ein", "eine", "wir", "mit", "von", "den", "dem", "zu", "auf", "nicht", "sich", "für", "werden"},
+	Spanish:    {"el", "los", "las", "y", "es", "del", "una", "en", "por", "que", "con", "para", "se", "como", "al", "su", "este", "son"},
+	Italian:    {"il", "gli", "della", "delle", "di", "che", "è", "una", "per", "con", "sono", "nel", "questo", "dei", "alla", "si", "come"},
+	Portuguese: {"os", "das", "dos", "uma", "em", "não", "com", "para", "que", "se", "na", "no", "ao", "são", "este", "foi", "pelo"},
+	Dutch:      {"het", "een", "van", "en", "is", "wij", "dat", "niet", "op", "voor", "met", "zijn", "worden", "deze", "ook", "bij"},
+	Russian:    {"и", "в", "не", "на", "что", "с", "по", "мы", "для", "это", "как", "из", "к", "от", "при", "также", "которые"},
+}
+
+var languageOfStopword = func() map[string][]Language {
+	m := make(map[string][]Language)
+	for lang, words := range stopwords {
+		for _, w := range words {
+			m[w] = append(m[w], lang)
+		}
+	}
+	return m
+}()
+
+// Supported returns all languages Detect may return.
+func Supported() []Language {
+	return []Language{English, French, German, Spanish, Italian, Portuguese, Dutch, Russian}
+}
+
+const (
+	// minHits is the number of stopwords needed to tell anything at all
+	minHits = 3
+	// minLead is how many times the best language must outscore the second one
+	minLead = 2
+)
+
+// Detect guesses the language of a text by counting stopwords. It returns
+// false if the text is too short or too mixed to tell.
+func Detect(text string) (Language, bool) {
+	hits := make(map[Language]int)
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r)
+	})
+	for _, w := range words {
+		for _, lang := range languageOfStopword[w] {
+			hits[lang]++
+		}
+	}
+	var best Language
+	bestHits, secondHits := 0, 0
+	for _, lang := range Supported() {
+		switch n := hits[lang]; {
+		case n > bestHits:
+			best, bestHits, secondHits = lang, n, bestHits
+		case n > secondHits:
+			secondHits = n
+		}
+	}
+	if bestHits < minHits || bestHits < minLead*secondHits {
+		return "", false
+	}
+	return best, true
+}
@@ -4,11 +4,70 @@ import "net/url"
 
 type ArticleId string
 type ArticleMeta struct {
-	Id                  ArticleId
-	Title               string
-	Authors             []string
-	Abstract            string
+	Id       ArticleId
+	Title    string
+	Authors  []string
+	Abstract string
+	// Categories lists the primary category first, followed by cross-lists.
+	Categories []string
+	// LastUpdateTimestamp is when the latest version was submitted, or when a change
+	// was noticed if the source doesn't tell.
 	LastUpdateTimestamp uint64
+	// SubmittedAt is when the first version was submitted, LatestVersionAt is when
+	// the latest one was, zero if unknown.
+	SubmittedAt     uint64
+	LatestVersionAt uint64
+	DOI             string
+	JournalRef      string
+	Comments        string
+	// License is the URL of the license the article is distributed under.
+	License string
+}
+
+func (a ArticleMeta) PrimaryCategory() string {
+	if len(a.Categories) == 0 {
+		return ""
+	}
+	return a.Categories[0]
+}
+
+func (a ArticleMeta) CrossLists() []string {
+	if len(a.Categories) < 2 {
+		return nil
+	}
+	return a.Categories[1:]
+}
+
+// ArticleUserRelation describes how a particular user has interacted with an article.
+type ArticleUserRelation struct {
+	Viewed       bool
+	LastViewedAt uint64
+	Subscribed   bool
+	// SubscribedAt is when the user last subscribed, zero if unknown.
+	SubscribedAt uint64
+}
+
+// SeenAt is the time up to which the user knows about updates of the article:
+// the last view, or the subscription if it is later.
+func (r ArticleUserRelation) SeenAt() uint64 {
+	if r.SubscribedAt > r.LastViewedAt {
+		return r.SubscribedAt
+	}
+	return r.LastViewedAt
+}
+
+// UserArticleMeta is an article as seen by a particular user.
+// Relation is nil when the article is requested anonymously.
+type UserArticleMeta struct {
+	ArticleMeta
+	Relation *ArticleUserRelation
+}
+
+// RelatedArticle is an article similar to another one. Score is higher for more
+// similar articles and is only comparable within a single result.
+type RelatedArticle struct {
+	UserArticleMeta
+	Score float64
 }
 
 type Article struct {
@@ -22,7 +81,14 @@ func (a Article) Equals(b Article) bool {
 		a.Title != b.Title ||
 		a.Abstract != b.Abstract ||
 		a.FullDocumentURL.String() != b.FullDocumentURL.String() ||
-		len(a.Authors) != len(b.Authors) {
+		a.SubmittedAt != b.SubmittedAt ||
+		a.LatestVersionAt != b.LatestVersionAt ||
+		a.DOI != b.DOI ||
+		a.JournalRef != b.JournalRef ||
+		a.Comments != b.Comments ||
+		a.License != b.License ||
+		len(a.Authors) != len(b.Authors) ||
+		len(a.Categories) != len(b.Categories) {
 		return false
 	}
 	for i := range a.Authors {
@@ -30,5 +96,10 @@ func (a Article) Equals(b Article) bool {
 			return false
 		}
 	}
+	for i := range a.Categories {
+		if a.Categories[i] != b.Categories[i] {
+			return false
+		}
+	}
 	return true
 }
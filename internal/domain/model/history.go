@@ -2,7 +2,7 @@ package model
 
 type UserSearchAccess struct {
     UserId
-    Query     string
+    Query     SearchQuery
     Timestamp uint64
 }
 
@@ -14,11 +14,13 @@ type UserArticleAccess struct {
 
 type UserSearchHistory struct {
     UserId
-    Queries []string
+    Queries []SearchQuery
+    Next    PageKey
 }
 
 type UserArticleHistory struct {
     UserId
-    Articles []ArticleMeta
+    Articles []UserArticleMeta
+    Next     PageKey
 }
 
@@ -0,0 +1,12 @@
+package model
+
+// PageKey is a position in a list sorted by some key: the sort key of the last
+// item of a page. Its content is defined by the repository producing the list.
+type PageKey []string
+
+// PageRequest asks for at most Limit items following After. A zero Limit means
+// no limit, an empty After means the first page.
+type PageRequest struct {
+	Limit uint32
+	After PageKey
+}
@@ -1,11 +1,100 @@
 package model
 
+type SearchSortOrder string
+
+const (
+    SortByRelevance SearchSortOrder = "relevance"
+    SortByNewest    SearchSortOrder = "newest"
+    SortByOldest    SearchSortOrder = "oldest"
+    SortByTitle     SearchSortOrder = "title"
+)
+
+func (s SearchSortOrder) IsValid() bool {
+    switch s {
+    case "", SortByRelevance, SortByNewest, SortByOldest, SortByTitle:
+        return true
+    }
+    return false
+}
+
+// SearchFilters narrow down search results, zero values mean no filtering.
+type SearchFilters struct {
+    UpdatedAfter  uint64
+    UpdatedBefore uint64
+    Author        string
+    Category      string
+}
+
+type SearchFacet string
+
+const (
+    AuthorsFacet    SearchFacet = "authors"
+    CategoriesFacet SearchFacet = "categories"
+    YearsFacet      SearchFacet = "years"
+)
+
+func (f SearchFacet) IsValid() bool {
+    return f == AuthorsFacet || f == CategoriesFacet || f == YearsFacet
+}
+
+type FacetBucket struct {
+    Value string
+    Count uint32
+}
+
+// SearchFacets are counts over the whole matched set, not only the returned page.
+// Authors and Categories hold the most frequent values, Years is a histogram
+// of LastUpdateTimestamp.
+type SearchFacets struct {
+    Authors    []FacetBucket
+    Categories []FacetBucket
+    Years      []FacetBucket
+}
+
+// HighlightOptions control highlighted fragments of search hits.
+type HighlightOptions struct {
+    StartSel     string
+    StopSel      string
+    MaxFragments uint32
+}
+
+// SearchQuery is a query with its filters and sort order. Subscriptions and
+// history keep all of it except Offset, Page, Highlight and Facets.
 type SearchQuery struct {
-    Query  string
-    Offset uint32
+    Query     string
+    Filters   SearchFilters
+    SortOrder SearchSortOrder
+    // IncludeBody makes words of full texts of articles match, not only of titles,
+    // authors and abstracts.
+    IncludeBody bool
+    Offset      uint32
+    Page      PageRequest
+
+    // Highlight is nil if highlighting is not requested.
+    Highlight *HighlightOptions
+    Facets    []SearchFacet
+}
+
+// SearchHighlights are parts of a hit with matched words wrapped into
+// HighlightOptions.StartSel and HighlightOptions.StopSel.
+type SearchHighlights struct {
+    Title    string
+    Abstract string
+}
+
+type SearchHit struct {
+    UserArticleMeta
+    Highlights *SearchHighlights
 }
 
 type SearchResult struct {
     TotalMatchesCount uint32
-    Articles          []ArticleMeta
+    Articles          []SearchHit
+    // Facets is nil if no facets were requested.
+    Facets *SearchFacets
+    // Next is nil on the last page.
+    Next PageKey
+    // DidYouMean is a spelling correction of a query with few matches,
+    // empty if there is none.
+    DidYouMean string
 }
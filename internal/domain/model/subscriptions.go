@@ -7,5 +7,5 @@ type UserArticleSubscription struct {
 
 type UserSearchSubscription struct {
     UserId
-    Query string
+    Query SearchQuery
 }
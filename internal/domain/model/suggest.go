@@ -0,0 +1,20 @@
+package model
+
+type TermFrequency struct {
+    Term  string
+    Count uint32
+}
+
+type SuggestionSource string
+
+const (
+    // SuggestedTerm completes the last word of a prefix with a word from article titles.
+    SuggestedTerm SuggestionSource = "term"
+    // SuggestedQuery is a past query of users starting with a prefix.
+    SuggestedQuery SuggestionSource = "query"
+)
+
+type Suggestion struct {
+    Text   string
+    Source SuggestionSource
+}
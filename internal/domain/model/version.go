@@ -0,0 +1,87 @@
+package model
+
+// ArticleVersion is an arXiv version of an article, Version being 2 for v2.
+// Title, Abstract, Authors and Comment are a snapshot of the article taken when
+// the version was the latest one. Versions that were never seen as the latest
+// one are only known from the submission history and have Recorded unset.
+type ArticleVersion struct {
+    ArticleId   ArticleId
+    Version     uint32
+    SubmittedAt uint64
+    Recorded    bool
+    Title       string
+    Abstract    string
+    Authors     []string
+    Comment     string
+}
+
+type ArticleField string
+
+const (
+    TitleField    ArticleField = "title"
+    AbstractField ArticleField = "abstract"
+    AuthorsField  ArticleField = "authors"
+    CommentField  ArticleField = "comment"
+)
+
+// FieldChange is a field that differs between two versions. Text fields have
+// Old and New values, lists have Added and Removed elements.
+type FieldChange struct {
+    Field   ArticleField
+    Old     string
+    New     string
+    Added   []string
+    Removed []string
+}
+
+type VersionDiff struct {
+    ArticleId ArticleId
+    From      uint32
+    To        uint32
+    Changes   []FieldChange
+}
+
+// Diff returns changes of fields from v to the other version, in the order of fields above.
+func (v ArticleVersion) Diff(other ArticleVersion) VersionDiff {
+    diff := VersionDiff{ArticleId: v.ArticleId, From: v.Version, To: other.Version}
+    texts := []struct {
+        field    ArticleField
+        old, new string
+    }{
+        {TitleField, v.Title, other.Title},
+        {AbstractField, v.Abstract, other.Abstract},
+    }
+    for _, t := range texts {
+        if t.old != t.new {
+            diff.Changes = append(diff.Changes, FieldChange{Field: t.field, Old: t.old, New: t.new})
+        }
+    }
+    if added, removed := listChanges(v.Authors, other.Authors); len(added) > 0 || len(removed) > 0 {
+        diff.Changes = append(diff.Changes, FieldChange{Field: AuthorsField, Added: added, Removed: removed})
+    }
+    if v.Comment != other.Comment {
+        diff.Changes = append(diff.Changes, FieldChange{Field: CommentField, Old: v.Comment, New: other.Comment})
+    }
+    return diff
+}
+
+func listChanges(old, new []string) (added, removed []string) {
+    count := make(map[string]int, len(old))
+    for _, s := range old {
+        count[s]++
+    }
+    for _, s := range new {
+        if count[s] > 0 {
+            count[s]--
+        } else {
+            added = append(added, s)
+        }
+    }
+    for _, s := range old {
+        if count[s] > 0 {
+            count[s]--
+            removed = append(removed, s)
+        }
+    }
+    return added, removed
+}
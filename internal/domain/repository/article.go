@@ -7,8 +7,19 @@ import (
 type ArticleRepo interface {
     ArticleMetaById(id model.ArticleId) (model.ArticleMeta, error)
     ArticleById(id model.ArticleId) (model.Article, error)
+    // ArticleMetasByIds returns articles in the order of ids, skipping unknown ones.
+    ArticleMetasByIds(ids []model.ArticleId) ([]model.ArticleMeta, error)
 
     UpdateArticle(article model.Article) error
+    // UpdateArticleBody stores the full text of an article and indexes it.
+    UpdateArticleBody(id model.ArticleId, body string) error
+    // RecordArticleVersions stores versions of an article. A snapshot recorded
+    // earlier is kept when the version is stored again without one.
+    RecordArticleVersions(versions []model.ArticleVersion) error
+    // ArticleVersions returns known versions of an article, oldest first.
+    ArticleVersions(id model.ArticleId) ([]model.ArticleVersion, error)
 
-    Search(query model.SearchQuery, limit uint32) (model.SearchResult, error)
+    Search(query model.SearchQuery) (model.SearchResult, error)
+    // RelatedArticles returns up to limit articles most similar to the given one, most similar first.
+    RelatedArticles(id model.ArticleId, limit uint32) ([]model.RelatedArticle, error)
 }
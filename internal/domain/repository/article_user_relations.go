@@ -3,14 +3,15 @@ package repository
 import "github.com/mp-hl-2021/unarXiv/internal/domain/model"
 
 type ArticleUserRelationsRepo interface {
-	GetArticleSubscriptions(id model.UserId) ([]model.ArticleId, error)
+	GetArticleSubscriptions(id model.UserId, page model.PageRequest) ([]model.ArticleId, model.PageKey, error)
 	SubscribeForArticle(id model.UserId, articleId model.ArticleId) error
 	UnsubscribeFromArticle(id model.UserId, articleId model.ArticleId) error
 	IsSubscribedForArticle(id model.UserId, articleId model.ArticleId) (bool, error)
 
 	ArticleAccessOccurred(userId model.UserId, articleId model.ArticleId) error
 	GetArticleLastAccessTimestamp(userId model.UserId, articleId model.ArticleId) (uint64, error)
+	GetArticleRelations(userId model.UserId, articleIds []model.ArticleId) (map[model.ArticleId]model.ArticleUserRelation, error)
 
-	GetArticleHistory(userId model.UserId) ([]model.ArticleId, error)
+	GetArticleHistory(userId model.UserId, page model.PageRequest) ([]model.ArticleId, model.PageKey, error)
 	ClearArticleHistory(userId model.UserId) error
 }
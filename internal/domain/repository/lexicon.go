@@ -0,0 +1,18 @@
+package repository
+
+import "github.com/mp-hl-2021/unarXiv/internal/domain/model"
+
+type LexiconRepo interface {
+    // TitleTerms returns up to limit words most frequently used in article titles,
+    // with the number of articles using them.
+    TitleTerms(limit uint32) ([]model.TermFrequency, error)
+    // Words returns up to limit words most frequently used in indexed article texts.
+    Words(limit uint32) ([]model.TermFrequency, error)
+    // RefreshWords recounts the words of TitleTerms and Words in all articles,
+    // which takes long. Until then they are as of the previous refresh.
+    RefreshWords() error
+    // PopularQueries returns up to limit past search queries starting with prefix,
+    // with the number of users who made them. Queries made by only a few users
+    // are left out, as they would reveal what these users searched for.
+    PopularQueries(prefix string, limit uint32) ([]model.TermFrequency, error)
+}
@@ -3,14 +3,17 @@ package repository
 import "github.com/mp-hl-2021/unarXiv/internal/domain/model"
 
 type SearchUserRelationsRepo interface {
-	GetSearchSubscriptions(id model.UserId) ([]string, error)
-	SubscribeForSearch(id model.UserId, query string) error
-	UnsubscribeFromSearch(id model.UserId, query string) error
-	IsSubscribedForSearch(id model.UserId, query string) (bool, error)
+	GetSearchSubscriptions(id model.UserId, page model.PageRequest) ([]model.SearchQuery, model.PageKey, error)
+	SubscribeForSearch(id model.UserId, query model.SearchQuery) error
+	UnsubscribeFromSearch(id model.UserId, query model.SearchQuery) error
+	IsSubscribedForSearch(id model.UserId, query model.SearchQuery) (bool, error)
 
-	SearchAccessOccurred(userId model.UserId, query string) error
-	GetSearchLastAccessTimestamp(userId model.UserId, query string) (uint64, error)
+	SearchAccessOccurred(userId model.UserId, query model.SearchQuery) error
+	GetSearchLastAccessTimestamp(userId model.UserId, query model.SearchQuery) (uint64, error)
+	// GetSearchLastAccessTimestamps returns when each of queries was last accessed,
+	// in the order of queries, zero for queries that were never accessed.
+	GetSearchLastAccessTimestamps(userId model.UserId, queries []model.SearchQuery) ([]uint64, error)
 
-	GetSearchHistory(userId model.UserId) ([]string, error)
+	GetSearchHistory(userId model.UserId, page model.PageRequest) ([]model.SearchQuery, model.PageKey, error)
 	ClearSearchHistory(userId model.UserId) error
 }
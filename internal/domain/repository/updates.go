@@ -3,6 +3,8 @@ package repository
 import "github.com/mp-hl-2021/unarXiv/internal/domain/model"
 
 type UpdatesRepo interface {
-    GetArticleSubscriptionsUpdates(id model.UserId) ([]model.ArticleMeta, error)
-    GetSearchSubscriptionsUpdates(id model.UserId) ([]string, error)
+    // GetArticleSubscriptionsUpdates returns updated articles along with the relations
+    // of the user to them, which tell whether they are updated.
+    GetArticleSubscriptionsUpdates(id model.UserId, page model.PageRequest) ([]model.UserArticleMeta, model.PageKey, error)
+    GetSearchSubscriptionsUpdates(id model.UserId, page model.PageRequest) ([]model.SearchQuery, model.PageKey, error)
 }
@@ -0,0 +1,109 @@
+package searchquery
+
+// Field restricts a term to a single part of an article.
+type Field string
+
+const (
+	AnyField      Field = ""
+	TitleField    Field = "title"
+	AbstractField Field = "abstract"
+	AuthorField   Field = "author"
+	IdField       Field = "id"
+	CategoryField Field = "category"
+)
+
+var knownFields = map[string]Field{
+	string(TitleField):    TitleField,
+	string(AbstractField): AbstractField,
+	string(AuthorField):   AuthorField,
+	string(IdField):       IdField,
+	string(CategoryField): CategoryField,
+}
+
+// IsText reports whether the field is matched against the full-text index.
+func (f Field) IsText() bool {
+	return f == AnyField || f == TitleField || f == AbstractField
+}
+
+// Node is an element of a parsed search query.
+type Node interface {
+	node()
+}
+
+// Term matches a single word, a word prefix (Prefix) or an exact phrase (Phrase).
+type Term struct {
+	Field  Field
+	Text   string
+	Phrase bool
+	Prefix bool
+	// Pos is the position of the term in the original query, in characters.
+	Pos int
+	// TextPos is the position of Text in the original query, past the field
+	// name and the opening quote.
+	TextPos int
+}
+
+// And matches articles matched by all of its operands.
+type And struct {
+	Operands []Node
+}
+
+// Or matches articles matched by any of its operands.
+type Or struct {
+	Operands []Node
+}
+
+// Not matches articles not matched by its operand.
+type Not struct {
+	Operand Node
+}
+
+func (Term) node() {}
+func (And) node()  {}
+func (Or) node()   {}
+func (Not) node()  {}
+
+// PositiveTerms returns terms that contribute to a match, i.e. that are not negated.
+func PositiveTerms(n Node) []Term {
+	var terms []Term
+	collectTerms(n, false, &terms)
+	return terms
+}
+
+// ReplaceTerms rewrites the original query replacing text of terms for which
+// replace returns true, leaving the rest of the query as it was written. Terms
+// must come in the order they appear in the query, as PositiveTerms returns them.
+func ReplaceTerms(query string, terms []Term, replace func(Term) (string, bool)) string {
+	runes := []rune(query)
+	var result []rune
+	last := 0
+	for _, term := range terms {
+		text, ok := replace(term)
+		if !ok || term.TextPos < last {
+			continue
+		}
+		result = append(result, runes[last:term.TextPos]...)
+		result = append(result, []rune(text)...)
+		last = term.TextPos + len([]rune(term.Text))
+	}
+	return string(append(result, runes[last:]...))
+}
+
+func collectTerms(n Node, negated bool, terms *[]Term) {
+	switch n := n.(type) {
+	case Term:
+		if !negated {
+			*terms = append(*terms, n)
+		}
+	case And:
+		for _, op := range n.Operands {
+			collectTerms(op, negated, terms)
+		}
+	case Or:
+		for _, op := range n.Operands {
+			collectTerms(op, negated, terms)
+		}
+	case Not:
+		collectTerms(n.Operand, !negated, terms)
+	}
+}
@@ -0,0 +1,328 @@
+package searchquery
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// ParseError describes a malformed query. Pos is the position of the offending
+// character in the query, in characters.
+type ParseError struct {
+	Pos int
+	Msg string
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("%s at position %d", e.Msg, e.Pos)
+}
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenWord
+	tokenPhrase
+	tokenField
+	tokenMinus
+	tokenAnd
+	tokenOr
+	tokenNot
+	tokenLParen
+	tokenRParen
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+func isWordRune(r rune) bool {
+	return !unicode.IsSpace(r) && r != '(' && r != ')' && r != '"'
+}
+
+func tokenize(query string) ([]token, error) {
+	runes := []rune(query)
+	var tokens []token
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '(':
+			tokens = append(tokens, token{kind: tokenLParen, pos: i})
+			i++
+		case r == ')':
+			tokens = append(tokens, token{kind: tokenRParen, pos: i})
+			i++
+		case r == '-' && i+1 < len(runes) && (isWordRune(runes[i+1]) || runes[i+1] == '"' || runes[i+1] == '('):
+			tokens = append(tokens, token{kind: tokenMinus, pos: i})
+			i++
+		case r == '"':
+			end := i + 1
+			for end < len(runes) && runes[end] != '"' {
+				end++
+			}
+			if end == len(runes) {
+				return nil, &ParseError{Pos: i, Msg: "unterminated phrase"}
+			}
+			tokens = append(tokens, token{kind: tokenPhrase, text: string(runes[i+1 : end]), pos: i})
+			i = end + 1
+		default:
+			end := i
+			for end < len(runes) && isWordRune(runes[end]) {
+				end++
+			}
+			// a colon after a field name scopes the term that follows, any other
+			// colon is a part of the word, as in "COVID-19:" or a URL
+			colon := i
+			for colon < end && runes[colon] != ':' {
+				colon++
+			}
+			if colon < end {
+				name := strings.ToLower(string(runes[i:colon]))
+				if _, ok := knownFields[name]; ok {
+					tokens = append(tokens, token{kind: tokenField, text: name, pos: i})
+					i = colon + 1
+					continue
+				}
+			}
+			word := string(runes[i:end])
+			kind := tokenWord
+			switch word {
+			case "AND":
+				kind = tokenAnd
+			case "OR":
+				kind = tokenOr
+			case "NOT":
+				kind = tokenNot
+			}
+			tokens = append(tokens, token{kind: kind, text: word, pos: i})
+			i = end
+		}
+	}
+	tokens = append(tokens, token{kind: tokenEOF, pos: len(runes)})
+	return tokens, nil
+}
+
+type parser struct {
+	tokens []token
+	next   int
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.next]
+}
+
+func (p *parser) advance() token {
+	t := p.tokens[p.next]
+	if t.kind != tokenEOF {
+		p.next++
+	}
+	return t
+}
+
+// Parse parses a query written in the search language.
+//
+// A query is a sequence of terms, implicitly joined with AND. A term is a word,
+// a word prefix ending with '*' or a phrase in double quotes, optionally scoped
+// to a field: title, abstract, author, id or category. A colon that does not
+// follow a field name is a part of a word, so that titles such as
+// "COVID-19: a review" can be searched as written. Terms are combined with
+// AND, OR and NOT (or a leading '-') and grouped with parentheses:
+//
+//	author:"Hinton" AND title:transformer -survey
+//
+// A query that matches articles by negated terms alone, such as "-survey" or
+// "transformer OR -survey", is rejected, as it matches almost everything.
+func Parse(query string) (Node, error) {
+	tokens, err := tokenize(query)
+	if err != nil {
+		return nil, err
+	}
+	p := parser{tokens: tokens}
+	if p.peek().kind == tokenEOF {
+		return nil, &ParseError{Pos: 0, Msg: "empty query"}
+	}
+	n, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != tokenEOF {
+		return nil, &ParseError{Pos: t.pos, Msg: "unexpected ')'"}
+	}
+	if negated, ok := negatedOnly(n); ok {
+		return nil, &ParseError{Pos: firstTermPos(negated), Msg: "negated terms need a term that is not negated"}
+	}
+	return n, nil
+}
+
+// negatedOnly reports whether n matches articles that match none of its terms,
+// returning the negation that lets them through.
+func negatedOnly(n Node) (Node, bool) {
+	switch n := n.(type) {
+	case And:
+		for _, op := range n.Operands {
+			if _, ok := negatedOnly(op); !ok {
+				return nil, false
+			}
+		}
+		return negatedOnly(n.Operands[0])
+	case Or:
+		for _, op := range n.Operands {
+			if negated, ok := negatedOnly(op); ok {
+				return negated, true
+			}
+		}
+	case Not:
+		if _, ok := negatedOnly(n.Operand); !ok {
+			return n, true
+		}
+	}
+	return nil, false
+}
+
+func firstTermPos(n Node) int {
+	switch n := n.(type) {
+	case Term:
+		return n.Pos
+	case And:
+		return firstTermPos(n.Operands[0])
+	case Or:
+		return firstTermPos(n.Operands[0])
+	case Not:
+		return firstTermPos(n.Operand)
+	}
+	return 0
+}
+
+func (p *parser) parseOr() (Node, error) {
+	first, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	operands := []Node{first}
+	for p.peek().kind == tokenOr {
+		p.advance()
+		n, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		operands = append(operands, n)
+	}
+	if len(operands) == 1 {
+		return first, nil
+	}
+	return Or{Operands: operands}, nil
+}
+
+func (p *parser) parseAnd() (Node, error) {
+	first, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	operands := []Node{first}
+	for {
+		switch p.peek().kind {
+		case tokenAnd:
+			p.advance()
+		case tokenEOF, tokenOr, tokenRParen:
+			if len(operands) == 1 {
+				return first, nil
+			}
+			return And{Operands: operands}, nil
+		}
+		n, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		operands = append(operands, n)
+	}
+}
+
+func (p *parser) parseUnary() (Node, error) {
+	if k := p.peek().kind; k == tokenNot || k == tokenMinus {
+		p.advance()
+		n, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return Not{Operand: n}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *parser) parsePrimary() (Node, error) {
+	t := p.advance()
+	switch t.kind {
+	case tokenLParen:
+		n, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if closing := p.advance(); closing.kind != tokenRParen {
+			return nil, &ParseError{Pos: closing.pos, Msg: "expected ')'"}
+		}
+		return n, nil
+	case tokenField:
+		value := p.advance()
+		if value.kind != tokenWord && value.kind != tokenPhrase {
+			return nil, &ParseError{Pos: value.pos, Msg: fmt.Sprintf("expected a word or a phrase after %q", t.text+":")}
+		}
+		term, err := makeTerm(value)
+		if err != nil {
+			return nil, err
+		}
+		term.Field = knownFields[t.text]
+		term.Pos = t.pos
+		return term, nil
+	case tokenWord, tokenPhrase:
+		return makeTerm(t)
+	case tokenEOF:
+		return nil, &ParseError{Pos: t.pos, Msg: "unexpected end of query"}
+	default:
+		return nil, &ParseError{Pos: t.pos, Msg: fmt.Sprintf("unexpected %q", tokenText(t))}
+	}
+}
+
+func makeTerm(t token) (Term, error) {
+	if t.kind == tokenPhrase {
+		if strings.TrimSpace(t.text) == "" {
+			return Term{}, &ParseError{Pos: t.pos, Msg: "empty phrase"}
+		}
+		return Term{Text: t.text, Phrase: true, Pos: t.pos, TextPos: t.pos + 1}, nil
+	}
+	text := t.text
+	prefix := strings.HasSuffix(text, "*")
+	if prefix {
+		text = strings.TrimSuffix(text, "*")
+	}
+	if text == "" || strings.Contains(text, "*") {
+		return Term{}, &ParseError{Pos: t.pos, Msg: "'*' is only allowed at the end of a word"}
+	}
+	return Term{Text: text, Prefix: prefix, Pos: t.pos, TextPos: t.pos}, nil
+}
+
+// Literal returns a query matching articles with all words of text, taking
+// the syntax of the language literally, the way queries were matched before
+// there was one. It is empty if text has no words.
+func Literal(text string) string {
+	var phrases []string
+	for _, word := range strings.Fields(strings.ReplaceAll(text, `"`, " ")) {
+		phrases = append(phrases, `"`+word+`"`)
+	}
+	return strings.Join(phrases, " ")
+}
+
+func tokenText(t token) string {
+	switch t.kind {
+	case tokenLParen:
+		return "("
+	case tokenRParen:
+		return ")"
+	case tokenMinus:
+		return "-"
+	}
+	return t.text
+}
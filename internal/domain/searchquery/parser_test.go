@@ -0,0 +1,177 @@
+package searchquery
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// format writes a node as an s-expression, terms as field:text with '*' for
+// prefixes and quotes for phrases.
+func format(n Node) string {
+	switch n := n.(type) {
+	case Term:
+		text := n.Text
+		if n.Phrase {
+			text = `"` + text + `"`
+		}
+		if n.Prefix {
+			text += "*"
+		}
+		if n.Field != AnyField {
+			text = string(n.Field) + ":" + text
+		}
+		return text
+	case And:
+		return "(AND " + formatAll(n.Operands) + ")"
+	case Or:
+		return "(OR " + formatAll(n.Operands) + ")"
+	case Not:
+		return "(NOT " + format(n.Operand) + ")"
+	}
+	return "?"
+}
+
+func formatAll(nodes []Node) string {
+	parts := make([]string, len(nodes))
+	for i, n := range nodes {
+		parts[i] = format(n)
+	}
+	return strings.Join(parts, " ")
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{query: "transformer", want: "transformer"},
+		{query: "attention is all", want: "(AND attention is all)"},
+		{query: "attention AND transformer", want: "(AND attention transformer)"},
+		// AND binds tighter than OR, with or without the operator
+		{query: "a b OR c", want: "(OR (AND a b) c)"},
+		{query: "a OR b c", want: "(OR a (AND b c))"},
+		{query: "a AND b OR c AND d", want: "(OR (AND a b) (AND c d))"},
+		{query: "a (b OR c)", want: "(AND a (OR b c))"},
+		{query: "((a))", want: "a"},
+		// NOT binds tighter than AND
+		{query: "a NOT b c", want: "(AND a (NOT b) c)"},
+		{query: "a -b", want: "(AND a (NOT b))"},
+		{query: "a -(b OR c)", want: "(AND a (NOT (OR b c)))"},
+		{query: "a NOT NOT b", want: "(AND a (NOT (NOT b)))"},
+		{query: "a - b", want: "(AND a - b)"},
+		{query: "self-attention", want: "self-attention"},
+		{query: `"attention is all you need"`, want: `"attention is all you need"`},
+		{query: `a "b c" -"d e"`, want: `(AND a "b c" (NOT "d e"))`},
+		{query: "transform*", want: "transform*"},
+		// operators are only recognized in upper case
+		{query: "cats and dogs", want: "(AND cats and dogs)"},
+		{query: `title:transformer author:"Hinton"`, want: `(AND title:transformer author:"Hinton")`},
+		{query: "Title:transformer", want: "title:transformer"},
+		{query: "title: transformer", want: "title:transformer"},
+		{query: "id:2101.0* category:cs.LG", want: "(AND id:2101.0* category:cs.LG)"},
+		{query: "title:re:x", want: "title:re:x"},
+		{query: "a -title:survey", want: "(AND a (NOT title:survey))"},
+		// colons after other words are a part of them
+		{query: "COVID-19: a review", want: "(AND COVID-19: a review)"},
+		{query: "re: transformers", want: "(AND re: transformers)"},
+		{query: "http://arxiv.org", want: "http://arxiv.org"},
+		{query: "a : b", want: "(AND a : b)"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			n, err := Parse(tt.query)
+			if err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+			if got := format(n); got != tt.want {
+				t.Errorf("Parse() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParsePositions(t *testing.T) {
+	n, err := Parse(`a  title:"b c" Ω -d`)
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	want := []Term{
+		{Text: "a", Pos: 0, TextPos: 0},
+		{Field: TitleField, Text: "b c", Phrase: true, Pos: 3, TextPos: 10},
+		{Text: "Ω", Pos: 15, TextPos: 15},
+	}
+	if got := PositiveTerms(n); !reflect.DeepEqual(got, want) {
+		t.Errorf("PositiveTerms() = %+v, want %+v", got, want)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		query string
+		pos   int
+		msg   string
+	}{
+		{query: "", pos: 0, msg: "empty query"},
+		{query: "   ", pos: 0, msg: "empty query"},
+		{query: `a "b c`, pos: 2, msg: "unterminated phrase"},
+		{query: `a ""`, pos: 2, msg: "empty phrase"},
+		{query: "a (b", pos: 4, msg: "expected ')'"},
+		{query: "a) b", pos: 1, msg: "unexpected ')'"},
+		{query: "()", pos: 1, msg: `unexpected ")"`},
+		{query: "a AND", pos: 5, msg: "unexpected end of query"},
+		{query: "a OR OR b", pos: 5, msg: `unexpected "OR"`},
+		{query: "title:", pos: 6, msg: `expected a word or a phrase after "title:"`},
+		{query: "title:(a b)", pos: 6, msg: `expected a word or a phrase after "title:"`},
+		{query: "a*b", pos: 0, msg: "'*' is only allowed at the end of a word"},
+		{query: "a *", pos: 2, msg: "'*' is only allowed at the end of a word"},
+		// negated terms alone match almost everything
+		{query: "-survey", pos: 1, msg: "negated terms need a term that is not negated"},
+		{query: "NOT a NOT b", pos: 4, msg: "negated terms need a term that is not negated"},
+		{query: "transformer OR -survey", pos: 16, msg: "negated terms need a term that is not negated"},
+		{query: "(a -b) OR -c", pos: 11, msg: "negated terms need a term that is not negated"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			n, err := Parse(tt.query)
+			var parseErr *ParseError
+			if !errors.As(err, &parseErr) {
+				t.Fatalf("Parse() = %v, %v, want a ParseError", n, err)
+			}
+			if parseErr.Pos != tt.pos || parseErr.Msg != tt.msg {
+				t.Errorf("Parse() error = %q at %d, want %q at %d", parseErr.Msg, parseErr.Pos, tt.msg, tt.pos)
+			}
+		})
+	}
+}
+
+func TestParseAcceptsNegationWithPositiveTerms(t *testing.T) {
+	for _, query := range []string{"a -b", "-b a", "(a OR b) -c", "a OR (b -c)", "NOT (NOT a)"} {
+		if _, err := Parse(query); err != nil {
+			t.Errorf("Parse(%q) error = %v", query, err)
+		}
+	}
+}
+
+func TestLiteral(t *testing.T) {
+	tests := map[string]string{
+		"":                         "",
+		`  "  `:                    "",
+		"-survey":                  `"-survey"`,
+		`"unterminated (quote`:     `"unterminated" "(quote"`,
+		"title:x COVID-19: a*b OR": `"title:x" "COVID-19:" "a*b" "OR"`,
+	}
+	for text, want := range tests {
+		got := Literal(text)
+		if got != want {
+			t.Errorf("Literal(%q) = %q, want %q", text, got, want)
+		}
+		if got == "" {
+			continue
+		}
+		if _, err := Parse(got); err != nil {
+			t.Errorf("Parse(Literal(%q)) error = %v", text, err)
+		}
+	}
+}
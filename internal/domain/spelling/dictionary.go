@@ -0,0 +1,152 @@
+package spelling
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/mp-hl-2021/unarXiv/internal/domain/model"
+)
+
+// Dictionary completes and corrects words using their frequencies in a corpus.
+// It is immutable once built and safe for concurrent use.
+type Dictionary struct {
+	// words are sorted by Term for prefix lookups
+	words []model.TermFrequency
+	index map[string]bool
+	// trigrams maps a trigram of a padded word to indices of words containing it
+	trigrams map[string][]int
+}
+
+func NewDictionary(words []model.TermFrequency) *Dictionary {
+	d := &Dictionary{
+		index:    make(map[string]bool, len(words)),
+		trigrams: make(map[string][]int),
+	}
+	for _, w := range words {
+		term := strings.ToLower(w.Term)
+		if term == "" || d.index[term] {
+			continue
+		}
+		d.index[term] = true
+		d.words = append(d.words, model.TermFrequency{Term: term, Count: w.Count})
+	}
+	sort.Slice(d.words, func(i, j int) bool {
+		return d.words[i].Term < d.words[j].Term
+	})
+	for i, w := range d.words {
+		for _, gram := range trigrams(w.Term) {
+			d.trigrams[gram] = append(d.trigrams[gram], i)
+		}
+	}
+	return d
+}
+
+// trigrams returns trigrams of a word padded with spaces, one per character.
+func trigrams(word string) []string {
+	runes := []rune(" " + word + " ")
+	grams := make([]string, 0, len(runes)-2)
+	for i := 0; i+3 <= len(runes); i++ {
+		grams = append(grams, string(runes[i:i+3]))
+	}
+	return grams
+}
+
+func (d *Dictionary) Contains(word string) bool {
+	return d.index[strings.ToLower(word)]
+}
+
+// Complete returns up to limit most frequent words starting with prefix.
+func (d *Dictionary) Complete(prefix string, limit int) []string {
+	prefix = strings.ToLower(prefix)
+	if prefix == "" || limit <= 0 {
+		return nil
+	}
+	first := sort.Search(len(d.words), func(i int) bool {
+		return d.words[i].Term >= prefix
+	})
+	var matches []model.TermFrequency
+	for i := first; i < len(d.words) && strings.HasPrefix(d.words[i].Term, prefix); i++ {
+		matches = append(matches, d.words[i])
+	}
+	sort.SliceStable(matches, func(i, j int) bool {
+		return matches[i].Count > matches[j].Count
+	})
+	if len(matches) > limit {
+		matches = matches[:limit]
+	}
+	result := make([]string, len(matches))
+	for i := range matches {
+		result[i] = matches[i].Term
+	}
+	return result
+}
+
+// maxDistance is how many typos are tolerated in a word of the given length.
+func maxDistance(length int) int {
+	switch {
+	case length < 4:
+		return 0
+	case length < 8:
+		return 1
+	}
+	return 2
+}
+
+// Correct returns the closest known word for a word missing from the dictionary,
+// preferring more frequent words among equally close ones. It returns false if
+// the word is known, is not a plain word or has no close enough match.
+func (d *Dictionary) Correct(word string) (string, bool) {
+	word = strings.ToLower(word)
+	if d.index[word] || !isPlainWord(word) {
+		return "", false
+	}
+	length := len([]rune(word))
+	maxDist := maxDistance(length)
+	if maxDist == 0 {
+		return "", false
+	}
+	grams := trigrams(word)
+	shared := make(map[int]int)
+	for _, gram := range grams {
+		for _, i := range d.trigrams[gram] {
+			shared[i]++
+		}
+	}
+	// an edit changes at most 3 trigrams, a transposition at most 4
+	minShared := len(grams) - 4*maxDist
+	best, bestDist := -1, maxDist+1
+	for i, n := range shared {
+		if n < minShared {
+			continue
+		}
+		candidate := d.words[i]
+		if diff := len([]rune(candidate.Term)) - length; diff > maxDist || -diff > maxDist {
+			continue
+		}
+		dist := Distance(word, candidate.Term)
+		if dist < bestDist || dist == bestDist && best >= 0 && isBetter(candidate, d.words[best]) {
+			best, bestDist = i, dist
+		}
+	}
+	if best < 0 {
+		return "", false
+	}
+	return d.words[best].Term, true
+}
+
+func isBetter(a, b model.TermFrequency) bool {
+	if a.Count != b.Count {
+		return a.Count > b.Count
+	}
+	return a.Term < b.Term
+}
+
+func isPlainWord(word string) bool {
+	for _, r := range word {
+		if !unicode.IsLetter(r) {
+			return false
+		}
+	}
+	return word != ""
+}
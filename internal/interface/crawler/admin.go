@@ -0,0 +1,373 @@
+package crawler
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/mp-hl-2021/unarXiv/internal/domain/model"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const (
+	defaultErrorsLimit = 50
+	maxErrorsLimit     = 1000
+)
+
+type rootStatsResponse struct {
+	RootURL  string `json:"root_url"`
+	Queued   int    `json:"queued"`
+	Retrying int    `json:"retrying"`
+	Claimed  int    `json:"claimed"`
+	Fetched  int    `json:"fetched"`
+	Parsed   int    `json:"parsed"`
+	Failed   int    `json:"failed"`
+	Articles int    `json:"articles"`
+}
+
+type frontierResponse struct {
+	Total        int                 `json:"total"`
+	Queued       int                 `json:"queued"`
+	Roots        []rootStatsResponse `json:"roots"`
+	HTTPStatuses map[string]int      `json:"http_statuses"`
+}
+
+type pipelineResponse struct {
+	State    PipelineState `json:"state"`
+	WorkerId string        `json:"worker_id"`
+}
+
+type enqueueRequest struct {
+	// RootURL is optional, the root of the first configuration by default.
+	RootURL    string            `json:"root_url"`
+	ArticleIds []model.ArticleId `json:"article_ids"`
+}
+
+type enqueueResponse struct {
+	Queued int `json:"queued"`
+}
+
+type configBody struct {
+	RootURL             string    `json:"root_url"`
+	DesiredArticleCount int       `json:"desired_article_count"`
+	IndexFullText       bool      `json:"index_full_text"`
+	Include             []string  `json:"include"`
+	Exclude             []string  `json:"exclude"`
+	Concurrency         int       `json:"concurrency"`
+	CrawlDelaySeconds   float64   `json:"crawl_delay_seconds"`
+	Mode                CrawlMode `json:"mode"`
+}
+
+type failedURLResponse struct {
+	URL        string `json:"url"`
+	Error      string `json:"error"`
+	Snippet    string `json:"snippet,omitempty"`
+	HTTPStatus int    `json:"http_status,omitempty"`
+	Attempts   int    `json:"attempts"`
+	FailedAt   uint64 `json:"failed_at"`
+}
+
+type retryingURLResponse struct {
+	URL           string `json:"url"`
+	Error         string `json:"error"`
+	HTTPStatus    int    `json:"http_status,omitempty"`
+	Attempts      int    `json:"attempts"`
+	NextAttemptAt uint64 `json:"next_attempt_at"`
+}
+
+type errorsResponse struct {
+	Failed   []failedURLResponse   `json:"failed"`
+	Retrying []retryingURLResponse `json:"retrying"`
+}
+
+type requeueRequest struct {
+	URLs []string `json:"urls"`
+	All  bool     `json:"all"`
+}
+
+type requeueResponse struct {
+	Requeued int `json:"requeued"`
+}
+
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+// AdminRouter serves the admin API under /admin/, requests must carry the
+// token as "Authorization: Bearer token". Requests are counted by action and
+// status code.
+func (c *Crawler) AdminRouter(token string) http.Handler {
+	router := mux.NewRouter()
+	handle := func(path, method, action string, handler http.HandlerFunc) {
+		counter := totalAdminRequests.MustCurryWith(prometheus.Labels{"action": action})
+		router.Handle(path, promhttp.InstrumentHandlerCounter(counter, adminAuth(token, handler))).Methods(method)
+	}
+
+	handle("/admin/frontier", http.MethodGet, "frontier", c.getFrontier)
+
+	handle("/admin/pipeline", http.MethodGet, "pipeline", c.getPipeline)
+	// pause stops claiming URLs, drain also returns claimed ones to the queue, resume undoes both
+	handle("/admin/pipeline/pause", http.MethodPost, "pause", c.postPipelineState(StatePaused))
+	handle("/admin/pipeline/drain", http.MethodPost, "drain", c.postPipelineState(StateDraining))
+	handle("/admin/pipeline/resume", http.MethodPost, "resume", c.postPipelineState(StateRunning))
+
+	// bodies are enqueueRequest
+	handle("/admin/articles/enqueue", http.MethodPost, "enqueue", c.postEnqueue(false))
+	handle("/admin/articles/recrawl", http.MethodPost, "recrawl", c.postEnqueue(true))
+
+	handle("/admin/configs", http.MethodGet, "get_configs", c.getConfigs)
+	// adds or replaces the configuration with the root of the configBody
+	handle("/admin/configs", http.MethodPut, "put_config", c.putConfig)
+	// the root is passed as "?root_url=smth"
+	handle("/admin/configs", http.MethodDelete, "delete_config", c.deleteConfig)
+
+	// number of URLs of each kind is optional, should be passed as "?limit=n"
+	handle("/admin/errors", http.MethodGet, "errors", c.getErrors)
+	handle("/admin/errors/requeue", http.MethodPost, "requeue", c.postRequeue)
+
+	return router
+}
+
+func adminAuth(token string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		given := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if token == "" || subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		next(w, r)
+	}
+}
+
+func respondWithJSON(w http.ResponseWriter, object interface{}, status int) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if object != nil {
+		if err := json.NewEncoder(w).Encode(object); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to write admin response: %v\n", err)
+		}
+	}
+}
+
+func respondWithError(w http.ResponseWriter, action string, err error, status int) {
+	if status == http.StatusInternalServerError {
+		fmt.Fprintf(os.Stderr, "Error happened in admin %s: %v\n", action, err)
+	}
+	respondWithJSON(w, errorResponse{Error: err.Error()}, status)
+}
+
+func (c *Crawler) getFrontier(w http.ResponseWriter, r *http.Request) {
+	stats, err := c.FrontierStats()
+	if err != nil {
+		respondWithError(w, "frontier", err, http.StatusInternalServerError)
+		return
+	}
+	resp := frontierResponse{Roots: []rootStatsResponse{}, HTTPStatuses: make(map[string]int)}
+	for _, root := range stats.Roots {
+		resp.Total += root.Queued + root.Claimed + root.Fetched + root.Parsed + root.Failed
+		resp.Queued += root.Queued
+		resp.Roots = append(resp.Roots, rootStatsResponse(root))
+	}
+	for status, count := range stats.HTTPStatuses {
+		resp.HTTPStatuses[strconv.Itoa(status)] = count
+	}
+	respondWithJSON(w, resp, http.StatusOK)
+}
+
+func (c *Crawler) getPipeline(w http.ResponseWriter, r *http.Request) {
+	respondWithJSON(w, pipelineResponse{State: c.PipelineState(), WorkerId: c.workerId}, http.StatusOK)
+}
+
+func (c *Crawler) postPipelineState(state PipelineState) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := c.SetPipelineState(state); err != nil {
+			respondWithError(w, "pipeline", err, http.StatusInternalServerError)
+			return
+		}
+		respondWithJSON(w, pipelineResponse{State: state, WorkerId: c.workerId}, http.StatusOK)
+	}
+}
+
+func (c *Crawler) postEnqueue(force bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req enqueueRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			respondWithError(w, "enqueue", err, http.StatusBadRequest)
+			return
+		}
+		if req.RootURL == "" {
+			cfgs, err := c.GetConfigurations()
+			if err == ErrNoConfigs {
+				respondWithError(w, "enqueue", err, http.StatusConflict)
+				return
+			}
+			if err != nil {
+				respondWithError(w, "enqueue", err, http.StatusInternalServerError)
+				return
+			}
+			req.RootURL = cfgs[0].RootURL
+		}
+		queued, err := c.EnqueueArticles(req.RootURL, req.ArticleIds, force)
+		if err == ErrNothingToQueue || errors.Is(err, ErrInvalidArticles) {
+			respondWithError(w, "enqueue", err, http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			respondWithError(w, "enqueue", err, http.StatusInternalServerError)
+			return
+		}
+		respondWithJSON(w, enqueueResponse{Queued: queued}, http.StatusOK)
+	}
+}
+
+func (c *Crawler) getConfigs(w http.ResponseWriter, r *http.Request) {
+	cfgs, err := c.GetConfigurations()
+	if err != nil && err != ErrNoConfigs {
+		respondWithError(w, "configs", err, http.StatusInternalServerError)
+		return
+	}
+	resp := make([]configBody, 0, len(cfgs))
+	for _, cfg := range cfgs {
+		body := configBody{
+			RootURL:             cfg.RootURL,
+			DesiredArticleCount: cfg.DesiredArticleCount,
+			IndexFullText:       cfg.IndexFullText,
+			Include:             []string{},
+			Exclude:             []string{},
+			Concurrency:         cfg.Concurrency,
+			CrawlDelaySeconds:   cfg.CrawlDelay.Seconds(),
+			Mode:                cfg.Mode,
+		}
+		for _, rule := range cfg.Include {
+			body.Include = append(body.Include, rule.String())
+		}
+		for _, rule := range cfg.Exclude {
+			body.Exclude = append(body.Exclude, rule.String())
+		}
+		resp = append(resp, body)
+	}
+	respondWithJSON(w, resp, http.StatusOK)
+}
+
+// configuration validates a configuration sent by an operator.
+func (b *configBody) configuration() (Configuration, error) {
+	root, err := url.Parse(b.RootURL)
+	if err != nil || (root.Scheme != "http" && root.Scheme != "https") || root.Host == "" || !strings.HasSuffix(root.Path, "/") {
+		return Configuration{}, fmt.Errorf("root_url must be an http(s) URL ending with a slash")
+	}
+	if b.Mode == "" {
+		b.Mode = ModeDiscover
+	}
+	if b.Mode != ModeDiscover && b.Mode != ModeRefresh {
+		return Configuration{}, fmt.Errorf("unknown crawl mode %q", b.Mode)
+	}
+	if b.Concurrency == 0 {
+		b.Concurrency = 2
+	}
+	if b.Concurrency < 0 || b.DesiredArticleCount < 0 || b.CrawlDelaySeconds < 0 {
+		return Configuration{}, fmt.Errorf("concurrency, desired_article_count and crawl_delay_seconds can't be negative")
+	}
+	cfg := Configuration{
+		RootURL:             b.RootURL,
+		DesiredArticleCount: b.DesiredArticleCount,
+		IndexFullText:       b.IndexFullText,
+		Concurrency:         b.Concurrency,
+		CrawlDelay:          time.Duration(b.CrawlDelaySeconds * float64(time.Second)),
+		Mode:                b.Mode,
+	}
+	if cfg.Include, err = compileRules(b.Include); err != nil {
+		return Configuration{}, fmt.Errorf("include rules: %w", err)
+	}
+	if cfg.Exclude, err = compileRules(b.Exclude); err != nil {
+		return Configuration{}, fmt.Errorf("exclude rules: %w", err)
+	}
+	return cfg, nil
+}
+
+func (c *Crawler) putConfig(w http.ResponseWriter, r *http.Request) {
+	var body configBody
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		respondWithError(w, "put_config", err, http.StatusBadRequest)
+		return
+	}
+	cfg, err := body.configuration()
+	if err != nil {
+		respondWithError(w, "put_config", err, http.StatusBadRequest)
+		return
+	}
+	if err := c.SaveConfiguration(cfg); err != nil {
+		respondWithError(w, "put_config", err, http.StatusInternalServerError)
+		return
+	}
+	respondWithJSON(w, body, http.StatusOK)
+}
+
+func (c *Crawler) deleteConfig(w http.ResponseWriter, r *http.Request) {
+	err := c.DeleteConfiguration(r.FormValue("root_url"))
+	if err == ErrConfigNotFound {
+		respondWithError(w, "delete_config", err, http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		respondWithError(w, "delete_config", err, http.StatusInternalServerError)
+		return
+	}
+	respondWithJSON(w, nil, http.StatusNoContent)
+}
+
+func (c *Crawler) getErrors(w http.ResponseWriter, r *http.Request) {
+	limit := defaultErrorsLimit
+	if raw := r.FormValue("limit"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n <= 0 || n > maxErrorsLimit {
+			respondWithError(w, "errors", fmt.Errorf("limit must be between 1 and %d", maxErrorsLimit), http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+	failed, err := c.FailedURLs(limit)
+	if err != nil {
+		respondWithError(w, "errors", err, http.StatusInternalServerError)
+		return
+	}
+	retrying, err := c.RetryingURLs(limit)
+	if err != nil {
+		respondWithError(w, "errors", err, http.StatusInternalServerError)
+		return
+	}
+	resp := errorsResponse{Failed: []failedURLResponse{}, Retrying: []retryingURLResponse{}}
+	for _, f := range failed {
+		resp.Failed = append(resp.Failed, failedURLResponse(f))
+	}
+	for _, u := range retrying {
+		resp.Retrying = append(resp.Retrying, retryingURLResponse(u))
+	}
+	respondWithJSON(w, resp, http.StatusOK)
+}
+
+func (c *Crawler) postRequeue(w http.ResponseWriter, r *http.Request) {
+	var req requeueRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, "requeue", err, http.StatusBadRequest)
+		return
+	}
+	n, err := c.RequeueFailed(req.URLs, req.All)
+	if err == ErrNothingToRequeue {
+		respondWithError(w, "requeue", err, http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		respondWithError(w, "requeue", err, http.StatusInternalServerError)
+		return
+	}
+	respondWithJSON(w, requeueResponse{Requeued: n}, http.StatusOK)
+}
@@ -0,0 +1,120 @@
+package crawler
+
+import (
+	"errors"
+	"sort"
+	"sync"
+
+	"github.com/mp-hl-2021/unarXiv/internal/domain"
+	"github.com/mp-hl-2021/unarXiv/internal/domain/model"
+)
+
+var errNotSupported = errors.New("not supported by memoryArticles")
+
+// memoryArticles is an ArticleRepo keeping what the crawler stores in memory.
+type memoryArticles struct {
+	mu       sync.Mutex
+	articles map[model.ArticleId]model.Article
+	versions map[model.ArticleId]map[uint32]model.ArticleVersion
+	bodies   map[model.ArticleId]string
+}
+
+func newMemoryArticles() *memoryArticles {
+	return &memoryArticles{
+		articles: make(map[model.ArticleId]model.Article),
+		versions: make(map[model.ArticleId]map[uint32]model.ArticleVersion),
+		bodies:   make(map[model.ArticleId]string),
+	}
+}
+
+func (m *memoryArticles) ArticleMetaById(id model.ArticleId) (model.ArticleMeta, error) {
+	article, err := m.ArticleById(id)
+	return article.ArticleMeta, err
+}
+
+func (m *memoryArticles) ArticleById(id model.ArticleId) (model.Article, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	article, ok := m.articles[id]
+	if !ok {
+		return model.Article{}, domain.ArticleNotFound
+	}
+	return article, nil
+}
+
+func (m *memoryArticles) ArticleMetasByIds(ids []model.ArticleId) ([]model.ArticleMeta, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var metas []model.ArticleMeta
+	for _, id := range ids {
+		if article, ok := m.articles[id]; ok {
+			metas = append(metas, article.ArticleMeta)
+		}
+	}
+	return metas, nil
+}
+
+func (m *memoryArticles) UpdateArticle(article model.Article) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.articles[article.Id] = article
+	return nil
+}
+
+func (m *memoryArticles) UpdateArticleBody(id model.ArticleId, body string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.articles[id]; !ok {
+		return domain.ArticleNotFound
+	}
+	m.bodies[id] = body
+	return nil
+}
+
+func (m *memoryArticles) RecordArticleVersions(versions []model.ArticleVersion) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, v := range versions {
+		stored, ok := m.versions[v.ArticleId]
+		if !ok {
+			stored = make(map[uint32]model.ArticleVersion)
+			m.versions[v.ArticleId] = stored
+		}
+		if prev, ok := stored[v.Version]; ok && prev.Recorded && !v.Recorded {
+			continue
+		}
+		stored[v.Version] = v
+	}
+	return nil
+}
+
+func (m *memoryArticles) ArticleVersions(id model.ArticleId) ([]model.ArticleVersion, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var versions []model.ArticleVersion
+	for _, v := range m.versions[id] {
+		versions = append(versions, v)
+	}
+	sort.Slice(versions, func(i, j int) bool { return versions[i].Version < versions[j].Version })
+	return versions, nil
+}
+
+func (m *memoryArticles) Search(query model.SearchQuery) (model.SearchResult, error) {
+	return model.SearchResult{}, errNotSupported
+}
+
+func (m *memoryArticles) RelatedArticles(id model.ArticleId, limit uint32) ([]model.RelatedArticle, error) {
+	return nil, errNotSupported
+}
+
+// ids returns ids of stored articles in order.
+func (m *memoryArticles) ids() []model.ArticleId {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var ids []model.ArticleId
+	for id := range m.articles {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
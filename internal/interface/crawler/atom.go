@@ -0,0 +1,318 @@
+package crawler
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mp-hl-2021/unarXiv/internal/domain/model"
+	"github.com/mp-hl-2021/unarXiv/internal/interface/utils"
+)
+
+// atomMaxEmptyPages bounds retries of pages the API returns empty before the end of the results.
+const atomMaxEmptyPages = 3
+
+var atomVersionRegexp = regexp.MustCompile(`v([0-9]+)$`)
+
+// AtomConfig configures fetching from the arXiv Atom API such as http://export.arxiv.org/api/query.
+type AtomConfig struct {
+	BaseURL string
+	// Queries are search_query values of the API such as "cat:cs.AI" or "ti:transformer".
+	Queries []string
+	// Categories are fetched as if they were given as "cat:" queries.
+	Categories []string
+	// Subscribed adds categories of searches users are subscribed to.
+	Subscribed bool
+	// PageSize is max_results of a single request, MaxResults bounds results per query.
+	PageSize   int
+	MaxResults int
+	// RequestDelay is the pause between consecutive requests.
+	RequestDelay time.Duration
+	// IndexFullText enables indexing PDFs linked from new and updated entries.
+	IndexFullText bool
+	// UserAgent identifies requests, DefaultUserAgent if empty.
+	UserAgent string
+	Client    *http.Client
+}
+
+type atomFeed struct {
+	TotalResults int         `xml:"totalResults"`
+	Entries      []atomEntry `xml:"entry"`
+}
+
+type atomEntry struct {
+	Id         string `xml:"id"`
+	Updated    string `xml:"updated"`
+	Published  string `xml:"published"`
+	Title      string `xml:"title"`
+	Summary    string `xml:"summary"`
+	Comment    string `xml:"comment"`
+	JournalRef string `xml:"journal_ref"`
+	DOI        string `xml:"doi"`
+	Primary    struct {
+		Term string `xml:"term,attr"`
+	} `xml:"primary_category"`
+	Authors []struct {
+		Name string `xml:"name"`
+	} `xml:"author"`
+	Links []struct {
+		Href  string `xml:"href,attr"`
+		Rel   string `xml:"rel,attr"`
+		Title string `xml:"title,attr"`
+		Type  string `xml:"type,attr"`
+	} `xml:"link"`
+	Categories []struct {
+		Term string `xml:"term,attr"`
+	} `xml:"category"`
+}
+
+// atomArticle is an entry of the feed with the link to its PDF.
+type atomArticle struct {
+	crawledArticle
+	PDFURL string
+}
+
+// articleId cuts the id of an article out of an entry id such as
+// http://arxiv.org/abs/hep-th/9901001v2, dropping the version.
+func (e *atomEntry) articleId() (model.ArticleId, error) {
+	i := strings.Index(e.Id, "/abs/")
+	if i < 0 {
+		return "", fmt.Errorf("unexpected entry id %q", e.Id)
+	}
+	return model.ArticleId(atomVersionRegexp.ReplaceAllString(e.Id[i+len("/abs/"):], "")), nil
+}
+
+func (e *atomEntry) article() (atomArticle, error) {
+	id, err := e.articleId()
+	if err != nil {
+		return atomArticle{}, err
+	}
+	var article atomArticle
+	article.Article = model.Article{ArticleMeta: model.ArticleMeta{
+		Id:         id,
+		Title:      collapseSpaces(e.Title),
+		Abstract:   collapseSpaces(e.Summary),
+		Comments:   collapseSpaces(e.Comment),
+		JournalRef: collapseSpaces(e.JournalRef),
+		DOI:        strings.TrimSpace(e.DOI),
+	}}
+	for _, a := range e.Authors {
+		article.Authors = append(article.Authors, collapseSpaces(a.Name))
+	}
+	if e.Primary.Term != "" {
+		article.Categories = append(article.Categories, e.Primary.Term)
+	}
+	for _, c := range e.Categories {
+		if c.Term != e.Primary.Term {
+			article.Categories = append(article.Categories, c.Term)
+		}
+	}
+	// published is the date of the first version, updated of the latest one
+	if t, err := time.Parse(time.RFC3339, e.Published); err == nil {
+		article.SubmittedAt = utils.Uint64Time(t)
+		article.LatestVersionAt = article.SubmittedAt
+	}
+	if t, err := time.Parse(time.RFC3339, e.Updated); err == nil {
+		article.LatestVersionAt = utils.Uint64Time(t)
+	}
+	article.LastUpdateTimestamp = article.LatestVersionAt
+	if article.LastUpdateTimestamp == 0 {
+		article.LastUpdateTimestamp = utils.Uint64Time(time.Now())
+	}
+	for _, l := range e.Links {
+		switch {
+		case l.Rel == "alternate":
+			if absURL, err := url.Parse(atomVersionRegexp.ReplaceAllString(l.Href, "")); err == nil {
+				article.FullDocumentURL = *absURL
+			}
+		case l.Title == "pdf" || l.Type == "application/pdf":
+			article.PDFURL = l.Href
+		}
+	}
+	// the feed describes the latest version, and tells when the first one was submitted
+	if m := atomVersionRegexp.FindStringSubmatch(e.Id); m != nil {
+		if version, err := strconv.ParseUint(m[1], 10, 32); err == nil {
+			var versions []model.ArticleVersion
+			if version > 1 && article.SubmittedAt != 0 {
+				versions = append(versions, model.ArticleVersion{ArticleId: id, Version: 1, SubmittedAt: article.SubmittedAt})
+			}
+			versions = append(versions, model.ArticleVersion{
+				ArticleId:   id,
+				Version:     uint32(version),
+				SubmittedAt: article.LatestVersionAt,
+			})
+			article.Versions = withSnapshot(article.Article, versions)
+		}
+	}
+	return article, nil
+}
+
+// subscribedCategories are the category filters of searches someone is subscribed to.
+func (c *Crawler) subscribedCategories() ([]string, error) {
+	rows, err := c.db.Query("SELECT DISTINCT Filters FROM AccountSearchRelations WHERE IsSubscribed AND Filters LIKE '%category=%';")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var categories []string
+	for rows.Next() {
+		var filters string
+		if err := rows.Scan(&filters); err != nil {
+			return nil, err
+		}
+		v, err := url.ParseQuery(filters)
+		if err != nil {
+			continue
+		}
+		if category := v.Get("category"); category != "" {
+			categories = append(categories, category)
+		}
+	}
+	return categories, rows.Err()
+}
+
+func (cfg *AtomConfig) queryURL(query string, start int) string {
+	v := url.Values{
+		"search_query": {query},
+		"start":        {strconv.Itoa(start)},
+		"max_results":  {strconv.Itoa(cfg.PageSize)},
+		"sortBy":       {"lastUpdatedDate"},
+		"sortOrder":    {"descending"},
+	}
+	return cfg.BaseURL + "?" + v.Encode()
+}
+
+func (cfg *AtomConfig) fetchFeed(ctx context.Context, query string, start int) (*atomFeed, error) {
+	client := cfg.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, cfg.queryURL(query, start), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", cfg.UserAgent)
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		io.Copy(io.Discard, resp.Body)
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	var feed atomFeed
+	if err := xml.NewDecoder(resp.Body).Decode(&feed); err != nil {
+		return nil, err
+	}
+	// errors come as a single entry with an id like http://arxiv.org/api/errors#...
+	if len(feed.Entries) == 1 && strings.Contains(feed.Entries[0].Id, "/api/errors") {
+		return nil, fmt.Errorf("API error: %s", collapseSpaces(feed.Entries[0].Summary))
+	}
+	return &feed, nil
+}
+
+// FetchAtom upserts articles matching the configured queries and categories,
+// most recently updated first.
+func (c *Crawler) FetchAtom(ctx context.Context, cfg AtomConfig) error {
+	if cfg.UserAgent == "" {
+		cfg.UserAgent = DefaultUserAgent
+	}
+	queries := append([]string(nil), cfg.Queries...)
+	categories := cfg.Categories
+	if cfg.Subscribed {
+		subscribed, err := c.subscribedCategories()
+		if err != nil {
+			return err
+		}
+		categories = append(append([]string(nil), categories...), subscribed...)
+	}
+	for _, category := range categories {
+		queries = append(queries, "cat:"+category)
+	}
+	for _, query := range queries {
+		if err := c.fetchAtomQuery(ctx, &cfg, query); err != nil {
+			return fmt.Errorf("query %q: %w", query, err)
+		}
+	}
+	return nil
+}
+
+func (c *Crawler) fetchAtomQuery(ctx context.Context, cfg *AtomConfig, query string) error {
+	fmt.Println("Fetching", query)
+	emptyPages := 0
+	for start := 0; start < cfg.MaxResults; {
+		feed, err := cfg.fetchFeed(ctx, query, start)
+		if err != nil {
+			return err
+		}
+		if len(feed.Entries) == 0 {
+			// the API sometimes answers with an empty page in the middle of results
+			emptyPages++
+			if start >= feed.TotalResults || emptyPages > atomMaxEmptyPages {
+				return nil
+			}
+		} else {
+			emptyPages = 0
+		}
+		for i := range feed.Entries {
+			if err := c.fetchAtomEntry(ctx, cfg, &feed.Entries[i]); err != nil {
+				return err
+			}
+		}
+		start += len(feed.Entries)
+		if start >= feed.TotalResults {
+			return nil
+		}
+		select {
+		case <-time.After(cfg.RequestDelay):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+func (c *Crawler) fetchAtomEntry(ctx context.Context, cfg *AtomConfig, entry *atomEntry) error {
+	article, err := entry.article()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Skipping entry: %v\n", err)
+		return nil
+	}
+	if article.Title == "" {
+		fmt.Fprintf(os.Stderr, "Skipping entry %s without title\n", article.Id)
+		return nil
+	}
+	up, err := c.upsertArticle(article.Article, article.Versions)
+	if err != nil {
+		return err
+	}
+	if !up {
+		return nil
+	}
+	fmt.Println("Upserted article", article.Id)
+	if cfg.IndexFullText && article.PDFURL != "" {
+		// full texts are optional, as in the crawling pipeline
+		data, err := c.downloadPDF(ctx, article.PDFURL)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to download full text of %s: %v\n", article.Id, err)
+			totalFullTexts.WithLabelValues("download_failed").Inc()
+			return nil
+		}
+		if err := c.indexFullText(article.Id, data); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to index full text of %s: %v\n", article.Id, err)
+			totalFullTexts.WithLabelValues("extraction_failed").Inc()
+			return nil
+		}
+		totalFullTexts.WithLabelValues("indexed").Inc()
+	}
+	return nil
+}
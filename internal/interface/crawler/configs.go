@@ -0,0 +1,131 @@
+package crawler
+
+import (
+	"fmt"
+	"regexp"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// CrawlMode is what a configuration crawls.
+type CrawlMode string
+
+const (
+	// ModeDiscover follows links to find new articles and refreshes known ones.
+	ModeDiscover CrawlMode = "discover"
+	// ModeRefresh only recrawls article pages that were visited before.
+	ModeRefresh CrawlMode = "refresh"
+)
+
+// Configuration is a row of CrawlerConfig. Every configuration is crawled by
+// its own pipeline, URLs found by it belong to its root.
+type Configuration struct {
+	RootURL string
+	// DesiredArticleCount is the budget of article pages, once reached the
+	// configuration only refreshes known articles. Zero means no budget.
+	DesiredArticleCount int
+	// IndexFullText enables downloading PDFs of new and updated articles to index their text.
+	IndexFullText bool
+	// Include and Exclude rules are matched against the path and query of found
+	// links, a link is queued if it matches any include rule, or there are none,
+	// and no exclude rule.
+	Include []*regexp.Regexp
+	Exclude []*regexp.Regexp
+	// Concurrency is the number of pages downloaded at once.
+	Concurrency int
+	// CrawlDelay is the least delay between requests to a host, used if it is
+	// longer than the crawler's default and the host's Crawl-delay.
+	CrawlDelay time.Duration
+	Mode       CrawlMode
+}
+
+// GetConfigurations loads all configurations, or returns ErrNoConfigs if there are none.
+func (c *Crawler) GetConfigurations() ([]Configuration, error) {
+	rows, err := c.db.Query(`SELECT RootURL, DesiredArticleCount, IndexFullText, IncludePatterns, ExcludePatterns,
+    Concurrency, CrawlDelaySeconds, Mode FROM CrawlerConfig ORDER BY RootURL;`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var cfgs []Configuration
+	for rows.Next() {
+		cfg := Configuration{}
+		var include, exclude []string
+		var delay float64
+		err := rows.Scan(&cfg.RootURL, &cfg.DesiredArticleCount, &cfg.IndexFullText, pq.Array(&include), pq.Array(&exclude),
+			&cfg.Concurrency, &delay, &cfg.Mode)
+		if err != nil {
+			return nil, err
+		}
+		if cfg.Include, err = compileRules(include); err != nil {
+			return nil, fmt.Errorf("include rules of %s: %w", cfg.RootURL, err)
+		}
+		if cfg.Exclude, err = compileRules(exclude); err != nil {
+			return nil, fmt.Errorf("exclude rules of %s: %w", cfg.RootURL, err)
+		}
+		if cfg.Mode != ModeDiscover && cfg.Mode != ModeRefresh {
+			return nil, fmt.Errorf("unknown crawl mode %q of %s", cfg.Mode, cfg.RootURL)
+		}
+		if cfg.Concurrency < 1 {
+			cfg.Concurrency = 1
+		}
+		cfg.CrawlDelay = time.Duration(delay * float64(time.Second))
+		cfgs = append(cfgs, cfg)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(cfgs) == 0 {
+		return nil, ErrNoConfigs
+	}
+	return cfgs, nil
+}
+
+// equals tells whether a running pipeline of cfg has to be restarted to apply other.
+func (cfg *Configuration) equals(other *Configuration) bool {
+	return cfg.RootURL == other.RootURL &&
+		cfg.DesiredArticleCount == other.DesiredArticleCount &&
+		cfg.IndexFullText == other.IndexFullText &&
+		rulesEqual(cfg.Include, other.Include) &&
+		rulesEqual(cfg.Exclude, other.Exclude) &&
+		cfg.Concurrency == other.Concurrency &&
+		cfg.CrawlDelay == other.CrawlDelay &&
+		cfg.Mode == other.Mode
+}
+
+func rulesEqual(a, b []*regexp.Regexp) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].String() != b[i].String() {
+			return false
+		}
+	}
+	return true
+}
+
+// articlesCount is the number of article pages crawled for a root, which are
+// the pages with a recrawl interval.
+func (c *Crawler) articlesCount(rootURL string) (int, error) {
+	var count int
+	err := c.db.QueryRow("SELECT count(*) FROM CrawlStatus WHERE RootURL = $1 AND RecrawlInterval IS NOT NULL;", rootURL).Scan(&count)
+	return count, err
+}
+
+// refreshOnly tells whether a configuration should only recrawl known
+// articles, because of its mode or because its budget is spent.
+func (c *Crawler) refreshOnly(cfg *Configuration) (bool, error) {
+	if cfg.Mode == ModeRefresh {
+		return true, nil
+	}
+	if cfg.DesiredArticleCount <= 0 {
+		return false, nil
+	}
+	count, err := c.articlesCount(cfg.RootURL)
+	if err != nil {
+		return false, err
+	}
+	return count >= cfg.DesiredArticleCount, nil
+}
@@ -0,0 +1,299 @@
+package crawler
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/url"
+	"regexp"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/mp-hl-2021/unarXiv/internal/domain/model"
+	"github.com/mp-hl-2021/unarXiv/internal/interface/utils"
+)
+
+// PipelineState is set by operators for all workers, which poll it.
+type PipelineState string
+
+const (
+	// StateRunning claims and crawls URLs.
+	StateRunning PipelineState = "running"
+	// StatePaused stops claiming URLs, claimed ones are still crawled.
+	StatePaused PipelineState = "paused"
+	// StateDraining stops claiming URLs and puts claimed ones that are not
+	// being crawled yet back to the queue, so that workers become idle.
+	StateDraining PipelineState = "draining"
+)
+
+const statePollInterval = 5 * time.Second
+
+// articleIdRegexp matches new and old style arXiv ids, with an optional version.
+var articleIdRegexp = regexp.MustCompile(`^([0-9]{4}\.[0-9]{4,5}|[a-z\-]+(\.[A-Z]{2})?/[0-9]{7})(v[0-9]+)?$`)
+
+var (
+	ErrUnknownState    = fmt.Errorf("unknown pipeline state")
+	ErrConfigNotFound  = fmt.Errorf("configuration not found")
+	ErrNothingToQueue  = fmt.Errorf("no articles to enqueue given")
+	ErrInvalidArticles = fmt.Errorf("invalid article ids")
+)
+
+func (s PipelineState) valid() bool {
+	return s == StateRunning || s == StatePaused || s == StateDraining
+}
+
+// PipelineState is the state last seen by this worker.
+func (c *Crawler) PipelineState() PipelineState {
+	c.stateMu.Lock()
+	defer c.stateMu.Unlock()
+	if c.state == "" {
+		return StateRunning
+	}
+	return c.state
+}
+
+func (c *Crawler) setLocalState(state PipelineState) {
+	c.stateMu.Lock()
+	defer c.stateMu.Unlock()
+	if c.state == state {
+		return
+	}
+	if c.state != "" {
+		fmt.Println("Pipeline state changed from", c.state, "to", state)
+	}
+	c.state = state
+	for _, s := range []PipelineState{StateRunning, StatePaused, StateDraining} {
+		value := 0.0
+		if s == state {
+			value = 1
+		}
+		pipelineState.WithLabelValues(string(s)).Set(value)
+	}
+}
+
+// SetPipelineState changes the state of all workers.
+func (c *Crawler) SetPipelineState(state PipelineState) error {
+	if !state.valid() {
+		return ErrUnknownState
+	}
+	_, err := c.db.Exec(`INSERT INTO CrawlerControl (Id, State, UpdatedAt) VALUES (1, $1, $2)
+ON CONFLICT (Id) DO UPDATE SET State = EXCLUDED.State, UpdatedAt = EXCLUDED.UpdatedAt;`,
+		string(state), utils.Uint64Time(time.Now()))
+	if err != nil {
+		return err
+	}
+	totalStateChanges.WithLabelValues(string(state)).Inc()
+	c.setLocalState(state)
+	return nil
+}
+
+func (c *Crawler) loadPipelineState() error {
+	var state PipelineState
+	err := c.db.QueryRow("SELECT State FROM CrawlerControl WHERE Id = 1;").Scan(&state)
+	if err == sql.ErrNoRows {
+		state = StateRunning
+	} else if err != nil {
+		return err
+	}
+	if !state.valid() {
+		return ErrUnknownState
+	}
+	c.setLocalState(state)
+	return nil
+}
+
+// watchPipelineState picks up state changes made through other workers.
+func (c *Crawler) watchPipelineState(ctx context.Context) error {
+	ticker := time.NewTicker(statePollInterval)
+	defer ticker.Stop()
+	for {
+		if err := c.loadPipelineState(); err != nil {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// RootStats counts URLs of a configuration by state. Queued URLs include
+// ones waiting for a retry.
+type RootStats struct {
+	RootURL  string
+	Queued   int
+	Retrying int
+	Claimed  int
+	Fetched  int
+	Parsed   int
+	Failed   int
+	Articles int
+}
+
+// FrontierStats is the state of the crawl queue.
+type FrontierStats struct {
+	Roots []RootStats
+	// HTTPStatuses counts URLs by the status of their last response.
+	HTTPStatuses map[int]int
+}
+
+func (c *Crawler) FrontierStats() (FrontierStats, error) {
+	rows, err := c.db.Query(`SELECT COALESCE(RootURL, ''),
+    count(*) FILTER (WHERE State = 'queued'),
+    count(*) FILTER (WHERE State = 'queued' AND NextAttemptAt > $1),
+    count(*) FILTER (WHERE State = 'claimed'),
+    count(*) FILTER (WHERE State = 'fetched'),
+    count(*) FILTER (WHERE State = 'parsed'),
+    count(*) FILTER (WHERE State = 'failed'),
+    count(*) FILTER (WHERE RecrawlInterval IS NOT NULL)
+FROM CrawlStatus GROUP BY RootURL ORDER BY RootURL;`, utils.Uint64Time(time.Now()))
+	if err != nil {
+		return FrontierStats{}, err
+	}
+	defer rows.Close()
+	stats := FrontierStats{HTTPStatuses: make(map[int]int)}
+	for rows.Next() {
+		var root RootStats
+		if err := rows.Scan(&root.RootURL, &root.Queued, &root.Retrying, &root.Claimed, &root.Fetched, &root.Parsed, &root.Failed, &root.Articles); err != nil {
+			return FrontierStats{}, err
+		}
+		stats.Roots = append(stats.Roots, root)
+	}
+	if err := rows.Err(); err != nil {
+		return FrontierStats{}, err
+	}
+
+	rows, err = c.db.Query("SELECT LastHTTPStatus, count(*) FROM CrawlStatus WHERE LastHTTPStatus IS NOT NULL GROUP BY LastHTTPStatus;")
+	if err != nil {
+		return FrontierStats{}, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var status, count int
+		if err := rows.Scan(&status, &count); err != nil {
+			return FrontierStats{}, err
+		}
+		stats.HTTPStatuses[status] = count
+	}
+	return stats, rows.Err()
+}
+
+// RetryingURL is a URL that failed and is going to be retried.
+type RetryingURL struct {
+	URL           string
+	Error         string
+	HTTPStatus    int
+	Attempts      int
+	NextAttemptAt uint64
+}
+
+// RetryingURLs returns up to limit URLs waiting for a retry, most recently failed first.
+func (c *Crawler) RetryingURLs(limit int) ([]RetryingURL, error) {
+	rows, err := c.db.Query(`SELECT URL, LastError, COALESCE(LastHTTPStatus, 0), RetryCount, COALESCE(NextAttemptAt, 0)
+FROM CrawlStatus WHERE State = 'queued' AND RetryCount > 0 AND LastError IS NOT NULL
+ORDER BY LastAccess DESC NULLS LAST LIMIT $1;`, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var urls []RetryingURL
+	for rows.Next() {
+		var u RetryingURL
+		if err := rows.Scan(&u.URL, &u.Error, &u.HTTPStatus, &u.Attempts, &u.NextAttemptAt); err != nil {
+			return nil, err
+		}
+		urls = append(urls, u)
+	}
+	return urls, rows.Err()
+}
+
+// EnqueueArticles queues abstract pages of articles under rootURL before
+// other URLs. Queued pages are crawled sooner, visited ones are left alone
+// unless force is set: then they are recrawled without conditional requests,
+// also if the crawler gave up on them. Pages being crawled are not touched.
+// It returns how many pages were queued.
+func (c *Crawler) EnqueueArticles(rootURL string, ids []model.ArticleId, force bool) (int, error) {
+	if len(ids) == 0 {
+		return 0, ErrNothingToQueue
+	}
+	root, err := url.Parse(rootURL)
+	if err != nil {
+		return 0, err
+	}
+	urls := make([]string, 0, len(ids))
+	for _, id := range ids {
+		if !articleIdRegexp.MatchString(string(id)) {
+			return 0, fmt.Errorf("%w: %q", ErrInvalidArticles, id)
+		}
+		u, ok := normalizeURL(root, root, "abs/"+string(id))
+		if !ok {
+			return 0, fmt.Errorf("%w: %q", ErrInvalidArticles, id)
+		}
+		urls = append(urls, u)
+	}
+
+	tx, err := c.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+	query := `INSERT INTO CrawlStatus (URL, Priority, RootURL) SELECT u, $2, $3 FROM unnest($1::text[]) AS u
+ON CONFLICT (URL) DO UPDATE SET Priority = EXCLUDED.Priority WHERE CrawlStatus.State = 'queued';`
+	if force {
+		_, err := tx.Exec("DELETE FROM CrawlFailures WHERE URL = ANY($1);", pq.Array(urls))
+		if err != nil {
+			return 0, err
+		}
+		query = `INSERT INTO CrawlStatus (URL, Priority, RootURL) SELECT u, $2, $3 FROM unnest($1::text[]) AS u
+ON CONFLICT (URL) DO UPDATE SET State = 'queued', Priority = EXCLUDED.Priority, RetryCount = 0, NextAttemptAt = NULL,
+    LastError = NULL, ETag = NULL, LastModified = NULL
+WHERE CrawlStatus.State IN ('queued', 'parsed', 'failed');`
+	}
+	res, err := tx.Exec(query, pq.Array(urls), manualPriority, rootURL)
+	if err != nil {
+		return 0, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	return int(n), tx.Commit()
+}
+
+// SaveConfiguration adds a configuration or replaces the one with the same
+// root. Workers pick it up on the next reload.
+func (c *Crawler) SaveConfiguration(cfg Configuration) error {
+	include := make([]string, 0, len(cfg.Include))
+	for _, rule := range cfg.Include {
+		include = append(include, rule.String())
+	}
+	exclude := make([]string, 0, len(cfg.Exclude))
+	for _, rule := range cfg.Exclude {
+		exclude = append(exclude, rule.String())
+	}
+	_, err := c.db.Exec(`INSERT INTO CrawlerConfig (RootURL, DesiredArticleCount, IndexFullText, IncludePatterns, ExcludePatterns,
+    Concurrency, CrawlDelaySeconds, Mode) VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+ON CONFLICT (RootURL) DO UPDATE SET DesiredArticleCount = EXCLUDED.DesiredArticleCount, IndexFullText = EXCLUDED.IndexFullText,
+    IncludePatterns = EXCLUDED.IncludePatterns, ExcludePatterns = EXCLUDED.ExcludePatterns, Concurrency = EXCLUDED.Concurrency,
+    CrawlDelaySeconds = EXCLUDED.CrawlDelaySeconds, Mode = EXCLUDED.Mode;`,
+		cfg.RootURL, cfg.DesiredArticleCount, cfg.IndexFullText, pq.Array(include), pq.Array(exclude),
+		cfg.Concurrency, cfg.CrawlDelay.Seconds(), string(cfg.Mode))
+	return err
+}
+
+// DeleteConfiguration stops crawling a root, its URLs stay in the queue.
+func (c *Crawler) DeleteConfiguration(rootURL string) error {
+	res, err := c.db.Exec("DELETE FROM CrawlerConfig WHERE RootURL = $1;", rootURL)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrConfigNotFound
+	}
+	return nil
+}
@@ -9,12 +9,17 @@ import (
 	"os"
 	"os/signal"
 	"net/http"
+	"net/url"
 	"sync"
+	"syscall"
+	"github.com/lib/pq"
 	"github.com/PuerkitoBio/goquery"
 	"github.com/mp-hl-2021/unarXiv/internal/domain"
 	"github.com/mp-hl-2021/unarXiv/internal/domain/model"
 	"github.com/mp-hl-2021/unarXiv/internal/domain/repository"
+	"github.com/mp-hl-2021/unarXiv/internal/interface/pdf"
 	"github.com/mp-hl-2021/unarXiv/internal/interface/utils"
+	"regexp"
 	"strings"
 	"time"
 )
@@ -28,52 +33,48 @@ var (
 	ErrEmptyQueue    = fmt.Errorf("no more urls to crawl")
 
 	chBuff                 = 10
-	downloadURLConcurrency = 2
 	parseHTMLConcurrency   = 2
-	putArticleLConcurrency = 1
-	putURLConcurrency      = 1
+	commitPageConcurrency  = 1
+	fullTextConcurrency    = 1
+
+	categoryRegexp = regexp.MustCompile(`\(([a-z\-]+(?:\.[A-Za-z\-]+)?)\)`)
 )
 
+// maxPDFSize bounds downloaded documents, larger ones are not indexed
+const maxPDFSize = 64 << 20
+
+// configReloadInterval is how often changes of configurations are picked up.
+const configReloadInterval = 30 * time.Second
+
+// drainTimeout is how long a stopping pipeline may crawl URLs it claimed,
+// it is below the stop grace period of the crawler container.
+const drainTimeout = 45 * time.Second
 
 type Crawler struct {
 	db		   *sql.DB
 	articlesRepo repository.ArticleRepo
-}
+	fetcher	  Fetcher
+	// workerId is the holder of URLs leased by this crawler
+	workerId	 string
 
-func NewCrawler(db *sql.DB, articlesRepo repository.ArticleRepo) *Crawler {
-	return &Crawler{db: db, articlesRepo: articlesRepo}
+	stateMu sync.Mutex
+	state   PipelineState
 }
 
-type Configuration struct {
-	RootURL			 string
-	DesiredArticleCount int
+func NewCrawler(db *sql.DB, articlesRepo repository.ArticleRepo, fetcher Fetcher, workerId string) *Crawler {
+	return &Crawler{db: db, articlesRepo: articlesRepo, fetcher: fetcher, workerId: workerId}
 }
 
-func (c *Crawler) getUnvisitedURLs() ([]string, error) {
-	rows, err := c.db.Query("SELECT URL FROM CrawlStatus WHERE Visited = false LIMIT 100;") // todo: fix magic number. probably in the next life
-	if err != nil {
-		return []string{}, err
+func (c *Crawler) addURLsToQueue(rootURL string, urls []string) error {
+	if len(urls) == 0 {
+		return nil
 	}
-	defer rows.Close()
-	urls := make([]string, 0, 100) // todo: fix magic number. probably in the next life
-	for rows.Next() {
-		url := ""
-		err := rows.Scan(&url)
-		if err != nil {
-			return []string{}, err
-		}
-		urls = append(urls, url)
+	priorities := make([]int64, 0, len(urls))
+	for _, url := range urls {
+		priorities = append(priorities, int64(urlPriority(url)))
 	}
-	return urls, nil
-}
-
-func (c *Crawler) addURLToQueue(url string) error {
-	_, err := c.db.Exec("INSERT INTO CrawlStatus (URL, Visited) VALUES ($1, false) ON CONFLICT DO NOTHING;", url)
-	return err
-}
-
-func (c *Crawler) dbVisitURL(url string) error {
-	_, err := c.db.Exec("UPDATE CrawlStatus SET Visited = true where URL = $1;", url)
+	_, err := c.db.Exec(`INSERT INTO CrawlStatus (URL, Priority, RootURL) SELECT u, p, $3 FROM unnest($1::text[], $2::integer[]) AS t(u, p)
+ON CONFLICT DO NOTHING;`, pq.Array(urls), pq.Array(priorities), rootURL)
 	return err
 }
 
@@ -82,147 +83,330 @@ func (c *Crawler) dbUpdateURLInfo(url string, HTTPStatus int) error {
 	return err
 }
 
-func (c *Crawler) GetConfiguration() (Configuration, error) {
-	rows, err := c.db.Query("SELECT RootURL, DesiredArticleCount FROM CrawlerConfig;")
-	if err != nil {
-		return Configuration{}, err
-	}
-	defer rows.Close()
-	for rows.Next() {
-		cfg := Configuration{}
-		err := rows.Scan(&cfg.RootURL, &cfg.DesiredArticleCount)
-		return cfg, err
-	}
-	return Configuration{}, ErrNoConfigs
-}
-
-func (c *Crawler) getArticlesCount() (int, error) {
-	rows, err := c.db.Query("SELECT n_live_tup FROM pg_stat_all_tables WHERE relname = 'articles';")
-	if err != nil {
-		return 0, err
-	}
-	defer rows.Close()
-	for rows.Next() {
-		var cnt int
-		err = rows.Scan(&cnt)
-		return cnt, err
-	}
-	return 0, fmt.Errorf("unexpected query result")
-}
-
-func (c *Crawler) getURLFromDB(ctx context.Context, URLChan chan<- string) error {
-	var urls []string
+// getURLFromDB claims URLs and sends them to downloaders until claimCtx is
+// canceled. Then it puts claimed URLs it hasn't sent back to the queue and
+// closes URLChan, so that the pipeline drains.
+func (c *Crawler) getURLFromDB(ctx, claimCtx context.Context, cfg *Configuration, URLChan chan<- queuedURL) error {
+	defer close(URLChan)
+	var urls []queuedURL
 	var err error
+	wasRefreshOnly := false
 	for {
-		select {
-		case <-ctx.Done():
-			return ctx.Err()
-		default:
-			if len(urls) == 0 {
-				urls, err = c.getUnvisitedURLs()
-				if err != nil {
+		if claimCtx.Err() != nil || ctx.Err() != nil {
+			if len(urls) > 0 {
+				if err := c.releaseURLs(urls); err != nil {
 					return err
 				}
-				if len(urls) == 0 {
-					time.Sleep(time.Second)
-					continue
+			}
+			return ctx.Err()
+		}
+		if state := c.PipelineState(); state != StateRunning {
+			if state == StateDraining && len(urls) > 0 {
+				if err := c.releaseURLs(urls); err != nil {
+					return err
 				}
+				urls = nil
 			}
-			url := urls[0]
-			urls = urls[1:]
-			err = c.dbVisitURL(url)
+			sleep(claimCtx, time.Second)
+			continue
+		}
+		if len(urls) == 0 {
+			var refreshOnly bool
+			refreshOnly, err = c.refreshOnly(cfg)
+			if err != nil {
+				return err
+			}
+			if refreshOnly && !wasRefreshOnly && cfg.Mode == ModeDiscover {
+				fmt.Println("Reached", cfg.DesiredArticleCount, "articles of", cfg.RootURL, "only refreshing them")
+			}
+			wasRefreshOnly = refreshOnly
+			urls, err = c.claimURLs(cfg.RootURL, refreshOnly)
 			if err != nil {
 				return err
 			}
-			URLChan <- url
+			if len(urls) == 0 {
+				sleep(claimCtx, time.Second)
+				continue
+			}
+		}
+		select {
+		case URLChan <- urls[0]:
+			urls = urls[1:]
+		case <-claimCtx.Done():
+		case <-ctx.Done():
 		}
 	}
 }
 
-func (c *Crawler) downloadURL(ctx context.Context, URLChan <-chan string, HTMLChan chan<- *http.Response) error {
+// sleep pauses for d or until ctx is canceled.
+func sleep(ctx context.Context, d time.Duration) {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+	case <-ctx.Done():
+	}
+}
+
+// fetchedPage is a successful response to a URL from the queue, which may
+// differ from the URL of the response after redirects.
+type fetchedPage struct {
+	url      string
+	response *http.Response
+}
+
+// parsedPage is what a page adds to the crawl: links and maybe an article.
+type parsedPage struct {
+	url     string
+	links   []string
+	article *crawledArticle
+}
+
+func (c *Crawler) downloadURL(ctx context.Context, URLChan <-chan queuedURL, HTMLChan chan<- fetchedPage) error {
 	for {
+		var queued queuedURL
+		var ok bool
 		select {
 		case <-ctx.Done():
 			return ctx.Err()
-		case url := <-URLChan:
-			fmt.Println("Visiting", url)
-			response, err := http.Get(url)
-			if err != nil {
+		case queued, ok = <-URLChan:
+			if !ok {
+				return nil
+			}
+		}
+		url := queued.url
+		header := http.Header{}
+		if queued.etag != "" {
+			header.Set("If-None-Match", queued.etag)
+		}
+		if queued.lastModified != "" {
+			header.Set("If-Modified-Since", queued.lastModified)
+		}
+		response, err := c.fetcher.Fetch(ctx, url, header)
+		if err == ErrDisallowedByRobots {
+			fmt.Println("Skipping", url, "disallowed by robots.txt")
+			if err := c.handleFailure(ctx, url, permanentError(err, nil)); err != nil {
 				return err
 			}
-			totalURLsVisited.Inc()
-			err = c.dbUpdateURLInfo(url, response.StatusCode)
-			if err != nil {
+			continue
+		}
+		if err == ErrRobotsUnreachable {
+			// not a failure of the URL, it is tried again with robots.txt
+			fmt.Println("Deferring", url, "robots.txt is unreachable")
+			if err := c.urlDeferred(url, time.Now().Add(robotsRetryTTL)); err != nil {
 				return err
 			}
-			HTMLChan <- response
-			time.Sleep(time.Second)
+			continue
+		}
+		if err != nil {
+			if err := c.handleFailure(ctx, url, transientError(err)); err != nil {
+				return err
+			}
+			continue
+		}
+		fmt.Println("Visited", url)
+		totalURLsVisited.Inc()
+		err = c.dbUpdateURLInfo(url, response.StatusCode)
+		if err != nil {
+			response.Body.Close()
+			return err
+		}
+		if response.StatusCode == http.StatusNotModified {
+			response.Body.Close()
+			totalNotModified.Inc()
+			if err := c.urlSucceeded(url); err != nil {
+				return err
+			}
+			c.recrawled(url, false)
+			continue
+		}
+		if response.StatusCode >= 400 {
+			body, _ := io.ReadAll(io.LimitReader(response.Body, snippetLength))
+			response.Body.Close()
+			if err := c.handleFailure(ctx, url, statusError(response.StatusCode, body)); err != nil {
+				return err
+			}
+			continue
+		}
+		err = c.urlFetched(url, response.Header.Get("ETag"), response.Header.Get("Last-Modified"))
+		if err != nil {
+			response.Body.Close()
+			return err
+		}
+		select {
+		case HTMLChan <- fetchedPage{url: url, response: response}:
+		case <-ctx.Done():
+			response.Body.Close()
+			return ctx.Err()
 		}
 	}
 }
 
-func (c *Crawler) parseHTML(ctx context.Context, cfg *Configuration, HTMLChan <-chan *http.Response, ArticleChan chan<- model.Article, NewURLChan chan<- string) error {
+func (c *Crawler) parseHTML(ctx context.Context, cfg *Configuration, HTMLChan <-chan fetchedPage, PageChan chan<- parsedPage) error {
 	for {
+		var page fetchedPage
+		var ok bool
 		select {
 		case <-ctx.Done():
 			return ctx.Err()
-		case response := <-HTMLChan:
-			body, err := io.ReadAll(response.Body)
-			if err != nil {
-				return err
-			}
-			dom, err := goquery.NewDocumentFromReader(bytes.NewReader(body))
-			if err != nil {
-				return err
+		case page, ok = <-HTMLChan:
+			if !ok {
+				return nil
 			}
-			err = c.collectUrls(dom, cfg, NewURLChan)
-			if err != nil {
+		}
+		parsed, failure := c.parsePage(cfg, page)
+		if failure != nil {
+			if err := c.handleFailure(ctx, page.url, failure); err != nil {
 				return err
 			}
-			if strings.Contains(response.Request.URL.String(), "/abs/") {
-				article, err := c.parseArticle(response, dom)
-				if err != nil {
-					return err
-				}
-				ArticleChan <- article
-			}
-			response.Body.Close()
+			continue
+		}
+		select {
+		case PageChan <- parsed:
+		case <-ctx.Done():
+			return ctx.Err()
 		}
 	}
 }
 
-func (c *Crawler) putURLToDB(ctx context.Context, NewURLChan <-chan string) error {
+func (c *Crawler) parsePage(cfg *Configuration, page fetchedPage) (parsedPage, *urlError) {
+	parsed := parsedPage{url: page.url}
+	body, err := io.ReadAll(page.response.Body)
+	page.response.Body.Close()
+	if err != nil {
+		return parsed, transientError(err)
+	}
+	dom, err := goquery.NewDocumentFromReader(bytes.NewReader(body))
+	if err != nil {
+		return parsed, permanentError(err, body)
+	}
+	if cfg.Mode == ModeDiscover {
+		parsed.links, err = c.collectUrls(dom, cfg, page.response.Request.URL)
+		if err != nil {
+			return parsed, permanentError(err, body)
+		}
+	}
+	if strings.Contains(page.response.Request.URL.String(), "/abs/") {
+		article, err := c.parseArticle(page.response, dom)
+		if err != nil {
+			return parsed, permanentError(err, body)
+		}
+		article.URL = page.url
+		parsed.article = &article
+	}
+	return parsed, nil
+}
+
+// commitPages stores links and articles of parsed pages. A page is marked as
+// parsed only after everything it adds is stored, so that a page that was
+// not committed before a crash is crawled again.
+func (c *Crawler) commitPages(ctx context.Context, cfg *Configuration, PageChan <-chan parsedPage, FullTextChan chan<- model.ArticleId) error {
 	for {
+		var page parsedPage
+		var ok bool
 		select {
 		case <-ctx.Done():
 			return ctx.Err()
-		case url := <-NewURLChan:
-			err := c.addURLToQueue(url)
+		case page, ok = <-PageChan:
+			if !ok {
+				return nil
+			}
+		}
+		if err := c.addURLsToQueue(cfg.RootURL, page.links); err != nil {
+			return err
+		}
+		up := false
+		if page.article != nil {
+			var err error
+			up, err = c.upsertArticle(page.article.Article, page.article.Versions)
 			if err != nil {
-				return err
+				if err := c.handleFailure(ctx, page.url, transientError(err)); err != nil {
+					return err
+				}
+				continue
+			}
+			c.recrawled(page.url, up)
+		}
+		if err := c.urlSucceeded(page.url); err != nil {
+			return err
+		}
+		if up {
+			fmt.Println("Upserted article", page.article.Id)
+			if cfg.IndexFullText {
+				select {
+				case FullTextChan <- page.article.Id:
+				case <-ctx.Done():
+					return ctx.Err()
+				}
 			}
 		}
 	}
 }
 
-func (c *Crawler) putArticleToDB(ctx context.Context, ArticleChan <-chan model.Article) error {
+func (c *Crawler) pdfURL(cfg *Configuration, id model.ArticleId) string {
+	return cfg.RootURL + "pdf/" + string(id)
+}
+
+// fetchFullText downloads PDFs of articles and indexes their text. Full texts
+// are optional, so failures are only logged and counted.
+func (c *Crawler) fetchFullText(ctx context.Context, cfg *Configuration, FullTextChan <-chan model.ArticleId) error {
 	for {
+		var id model.ArticleId
+		var ok bool
 		select {
 		case <-ctx.Done():
 			return ctx.Err()
-		case article := <-ArticleChan:
-			up, err := c.upsertArticle(article)
-			if err != nil {
-				return err
-			}
-			if up {
-				fmt.Println("Upserted article", article.Id)
+		case id, ok = <-FullTextChan:
+			if !ok {
+				return nil
 			}
 		}
+		data, err := c.downloadPDF(ctx, c.pdfURL(cfg, id))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to download full text of %s: %v\n", id, err)
+			totalFullTexts.WithLabelValues("download_failed").Inc()
+			continue
+		}
+		if err := c.indexFullText(id, data); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to index full text of %s: %v\n", id, err)
+			totalFullTexts.WithLabelValues("extraction_failed").Inc()
+			continue
+		}
+		totalFullTexts.WithLabelValues("indexed").Inc()
+	}
+}
+
+func (c *Crawler) downloadPDF(ctx context.Context, url string) ([]byte, error) {
+	response, err := c.fetcher.Fetch(ctx, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s", response.Status)
+	}
+	data, err := io.ReadAll(io.LimitReader(response.Body, maxPDFSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxPDFSize {
+		return nil, fmt.Errorf("document is larger than %d bytes", maxPDFSize)
 	}
+	return data, nil
 }
 
-func (c *Crawler) upsertArticle(article model.Article) (bool, error) {
+// indexFullText extracts text of a PDF document and stores it as the body of an article.
+func (c *Crawler) indexFullText(id model.ArticleId, data []byte) error {
+	text, err := pdf.ExtractText(data)
+	if err != nil {
+		return err
+	}
+	return c.articlesRepo.UpdateArticleBody(id, text)
+}
+
+// upsertArticle stores an article if it is new or has changed, and versions
+// that are not stored yet. It reports whether the article was stored.
+func (c *Crawler) upsertArticle(article model.Article, versions []model.ArticleVersion) (bool, error) {
 	prevArticleState, err := c.articlesRepo.ArticleById(article.Id)
 	if err == domain.ArticleNotFound {
 		err = c.articlesRepo.UpdateArticle(article)
@@ -230,124 +414,317 @@ func (c *Crawler) upsertArticle(article model.Article) (bool, error) {
 			return false, err
 		}
 		totalArticlesUpdated.WithLabelValues("1").Inc()
-		return true, nil
+		return true, c.recordVersions(versions)
 	}
 	if err != nil {
 		return false, err
 	}
 	if article.Equals(prevArticleState) {
-		return false, nil
+		return false, c.recordVersions(versions)
 	}
 	err = c.articlesRepo.UpdateArticle(article)
 	if err != nil {
 		return false, err
 	}
 	totalArticlesUpdated.WithLabelValues("0").Inc()
-	return true, err
+	return true, c.recordVersions(versions)
+}
+
+func (c *Crawler) recordVersions(versions []model.ArticleVersion) error {
+	changed, err := c.versionsChanged(versions)
+	if err != nil || !changed {
+		return err
+	}
+	return c.articlesRepo.RecordArticleVersions(versions)
 }
 
-func (c *Crawler) CrawlArticles(cfg Configuration) error {
+// CrawlArticles runs a pipeline for every configuration until interrupted.
+// Configurations are reloaded periodically: pipelines of added ones are
+// started, of removed ones stopped, and of changed or failed ones restarted.
+//
+// An interrupt or SIGTERM stops claiming URLs and waits up to drainTimeout
+// for claimed ones to be crawled, a second one stops at once. URLs that were
+// not crawled go back to the queue. It returns nil when stopped by a signal,
+// and an error if a job shared by the pipelines failed.
+func (c *Crawler) CrawlArticles() error {
 	fmt.Println("Crawling...")
 
+	// leases left by a previous run of this worker are not renewed by anyone
+	if err := c.releaseOwnLeases(); err != nil {
+		return err
+	}
+	if err := c.loadPipelineState(); err != nil {
+		return err
+	}
+
 	ctx, cancel := context.WithCancel(context.Background())
+	stopCtx, stop := context.WithCancel(ctx)
 	osChan := make(chan os.Signal, 1)
-	signal.Notify(osChan, os.Interrupt)
+	signal.Notify(osChan, os.Interrupt, syscall.SIGTERM)
 	defer func() {
 		signal.Stop(osChan)
 		cancel()
 	}()
 
-	URLChan := make(chan string, chBuff)
-	HTMLChan := make(chan *http.Response, chBuff)
-	ArticleChan := make(chan model.Article, chBuff)
-	NewURLChan := make(chan string, chBuff)
-
 	go func() {
 		for {
 			select {
 			case <-osChan:
-				cancel()
+				if stopCtx.Err() == nil {
+					fmt.Println("Stopping, draining claimed URLs for up to", drainTimeout, "- interrupt again to stop at once")
+					stop()
+				} else {
+					cancel()
+				}
 			case <-ctx.Done():
 				return
 			}
 		}
 	}()
 
+	var failure error
+	var failureOnce sync.Once
+	var jobsWG sync.WaitGroup
+	for name, job := range map[string]func(context.Context) error{
+		"Heartbeat":        c.heartbeat,
+		"StateWatcher":     c.watchPipelineState,
+		"RecrawlScheduler": c.scheduleRecrawls,
+	} {
+		jobsWG.Add(1)
+		go func(name string, job func(context.Context) error) {
+			err := job(ctx)
+			fmt.Fprintf(os.Stderr, "%s 1 stopped, reason: %v\n", name, err)
+			if ctx.Err() == nil {
+				failureOnce.Do(func() { failure = err })
+			}
+			jobsWG.Done()
+			cancel()
+		}(name, job)
+	}
+
+	pipelines := make(map[string]*pipeline)
+	ticker := time.NewTicker(configReloadInterval)
+	defer ticker.Stop()
+	for stopCtx.Err() == nil {
+		c.syncPipelines(ctx, pipelines)
+		select {
+		case <-stopCtx.Done():
+		case <-ticker.C:
+		}
+	}
+
+	// leases are renewed by the heartbeat while pipelines drain
+	var stopWG sync.WaitGroup
+	for root, p := range pipelines {
+		stopWG.Add(1)
+		go func(root string, p *pipeline) {
+			c.stopPipeline(root, p)
+			stopWG.Done()
+		}(root, p)
+	}
+	stopWG.Wait()
+	cancel()
+	jobsWG.Wait()
+
+	if err := c.releaseOwnLeases(); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to release leases: %v\n", err)
+	}
+	return failure
+}
+
+// pipeline is a running crawl of a configuration.
+type pipeline struct {
+	cfg Configuration
+	// stopClaiming lets the pipeline drain, cancel stops it at once
+	stopClaiming context.CancelFunc
+	cancel       context.CancelFunc
+	done         chan struct{}
+}
+
+func (p *pipeline) stopped() bool {
+	select {
+	case <-p.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// syncPipelines makes pipelines match the current configurations. If they
+// can't be loaded, running pipelines are kept.
+func (c *Crawler) syncPipelines(ctx context.Context, pipelines map[string]*pipeline) {
+	cfgs, err := c.GetConfigurations()
+	if err != nil && err != ErrNoConfigs {
+		fmt.Fprintf(os.Stderr, "Failed to load configurations: %v\n", err)
+		return
+	}
+	current := make(map[string]Configuration, len(cfgs))
+	for _, cfg := range cfgs {
+		current[cfg.RootURL] = cfg
+	}
+	for root, p := range pipelines {
+		cfg, ok := current[root]
+		if ok && cfg.equals(&p.cfg) && !p.stopped() {
+			delete(current, root)
+			continue
+		}
+		c.stopPipeline(root, p)
+		delete(pipelines, root)
+	}
+	for _, cfg := range cfgs {
+		if _, ok := current[cfg.RootURL]; !ok {
+			continue
+		}
+		fmt.Println("Starting crawl of", cfg.RootURL, "in", cfg.Mode, "mode")
+		pctx, cancel := context.WithCancel(ctx)
+		claimCtx, stopClaiming := context.WithCancel(pctx)
+		p := &pipeline{cfg: cfg, stopClaiming: stopClaiming, cancel: cancel, done: make(chan struct{})}
+		pipelines[cfg.RootURL] = p
+		go func(p *pipeline) {
+			err := c.crawl(pctx, claimCtx, p.cfg)
+			fmt.Fprintf(os.Stderr, "Crawl of %s stopped, reason: %v\n", p.cfg.RootURL, err)
+			close(p.done)
+		}(p)
+	}
+}
+
+// stopPipeline lets a pipeline drain for up to drainTimeout, then stops it
+// and puts URLs it claimed but didn't crawl back to the queue.
+func (c *Crawler) stopPipeline(root string, p *pipeline) {
+	p.stopClaiming()
+	timer := time.NewTimer(drainTimeout)
+	defer timer.Stop()
+	select {
+	case <-p.done:
+	case <-timer.C:
+		fmt.Fprintf(os.Stderr, "Crawl of %s didn't drain in %s, stopping it\n", root, drainTimeout)
+		p.cancel()
+		<-p.done
+	}
+	p.cancel()
+	if err := c.releaseLeases(root); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to release leases of %s: %v\n", root, err)
+	}
+}
+
+// crawl runs the pipeline of a configuration. Once claimCtx is canceled, the
+// stages finish URLs that were claimed and stop in turn, it returns nil then.
+// It returns an error if ctx is canceled or a stage fails.
+func (c *Crawler) crawl(ctx, claimCtx context.Context, cfg Configuration) error {
+	ctx, cancel := context.WithCancel(withCrawlDelay(ctx, cfg.CrawlDelay))
+	defer cancel()
+
+	if err := c.addURLsToQueue(cfg.RootURL, []string{cfg.RootURL}); err != nil {
+		return err
+	}
+
+	// every stage closes its output when all its workers stop
+	URLChan := make(chan queuedURL, chBuff)
+	HTMLChan := make(chan fetchedPage, chBuff)
+	PageChan := make(chan parsedPage, chBuff)
+	FullTextChan := make(chan model.ArticleId, chBuff)
+
 	var gwg sync.WaitGroup
 	gwg.Add(1)
-	go func(out chan<- string) {
-		err := c.getURLFromDB(ctx, out)
-		fmt.Fprintf(os.Stderr, "URLGetter 1 stopped, reason: %s\n", err)
+	go func(out chan<- queuedURL) {
+		err := c.getURLFromDB(ctx, claimCtx, &cfg, out)
+		fmt.Fprintf(os.Stderr, "URLGetter 1 stopped, reason: %v\n", err)
 		gwg.Done()
-		cancel()
+		if err != nil {
+			cancel()
+		}
 	}(URLChan)
 
 	var dwg sync.WaitGroup
-	dwg.Add(downloadURLConcurrency)
-	for i := 0; i < downloadURLConcurrency; i++ {
-		go func(in <-chan string, out chan<- *http.Response) {
+	dwg.Add(cfg.Concurrency)
+	for i := 0; i < cfg.Concurrency; i++ {
+		go func(i int, in <-chan queuedURL, out chan<- fetchedPage) {
 			err := c.downloadURL(ctx, in, out)
-			fmt.Fprintf(os.Stderr, "URLDownloader %d stopped, reason: %s\n", i, err)
+			fmt.Fprintf(os.Stderr, "URLDownloader %d stopped, reason: %v\n", i, err)
 			dwg.Done()
-			cancel()
-		}(URLChan, HTMLChan)
+			if err != nil {
+				cancel()
+			}
+		}(i, URLChan, HTMLChan)
 	}
+	go func() {
+		dwg.Wait()
+		close(HTMLChan)
+	}()
 
 	var parseWG sync.WaitGroup
 	parseWG.Add(parseHTMLConcurrency)
 	for i := 0; i < parseHTMLConcurrency; i++ {
-		go func(in <-chan *http.Response, outArticle chan<- model.Article, outURL chan<- string) {
-			err := c.parseHTML(ctx, &cfg, in, outArticle, outURL)
-			fmt.Fprintf(os.Stderr, "HTMLParser %d stopped, reason: %s\n", i, err)
+		go func(i int, in <-chan fetchedPage, out chan<- parsedPage) {
+			err := c.parseHTML(ctx, &cfg, in, out)
+			fmt.Fprintf(os.Stderr, "HTMLParser %d stopped, reason: %v\n", i, err)
 			parseWG.Done()
-			cancel()
-		}(HTMLChan, ArticleChan, NewURLChan)
+			if err != nil {
+				cancel()
+			}
+		}(i, HTMLChan, PageChan)
 	}
+	go func() {
+		parseWG.Wait()
+		close(PageChan)
+	}()
 
-	var putUrlWG sync.WaitGroup
-	putUrlWG.Add(putURLConcurrency)
-	for i := 0; i < putURLConcurrency; i++ {
-		go func(in <-chan string) {
-			err := c.putURLToDB(ctx, in)
-			fmt.Fprintf(os.Stderr, "URLPutter %d stopped, reason: %s\n", i, err)
-			putUrlWG.Done()
-			cancel()
-		}(NewURLChan)
+	var commitWG sync.WaitGroup
+	commitWG.Add(commitPageConcurrency)
+	for i := 0; i < commitPageConcurrency; i++ {
+		go func(i int, in <-chan parsedPage, out chan<- model.ArticleId) {
+			err := c.commitPages(ctx, &cfg, in, out)
+			fmt.Fprintf(os.Stderr, "PageCommitter %d stopped, reason: %v\n", i, err)
+			commitWG.Done()
+			if err != nil {
+				cancel()
+			}
+		}(i, PageChan, FullTextChan)
 	}
+	go func() {
+		commitWG.Wait()
+		close(FullTextChan)
+	}()
 
-	var putArticleWG sync.WaitGroup
-	putArticleWG.Add(putArticleLConcurrency)
-	for i := 0; i < putArticleLConcurrency; i++ {
-		go func(in <-chan model.Article) {
-			err := c.putArticleToDB(ctx, in)
-			fmt.Fprintf(os.Stderr, "ArticlePutter %d stopped, reason: %s\n", i, err)
-			putArticleWG.Done()
-			cancel()
-		}(ArticleChan)
+	var fullTextWG sync.WaitGroup
+	fullTextWG.Add(fullTextConcurrency)
+	for i := 0; i < fullTextConcurrency; i++ {
+		go func(i int, in <-chan model.ArticleId) {
+			err := c.fetchFullText(ctx, &cfg, in)
+			fmt.Fprintf(os.Stderr, "FullTextFetcher %d stopped, reason: %v\n", i, err)
+			fullTextWG.Done()
+			if err != nil {
+				cancel()
+			}
+		}(i, FullTextChan)
 	}
 
 	gwg.Wait()
 	dwg.Wait()
 	parseWG.Wait()
-	putUrlWG.Wait()
-	putArticleWG.Wait()
+	commitWG.Wait()
+	fullTextWG.Wait()
 
+	// responses left in the channel after a failure aren't read by anyone
+	for page := range HTMLChan {
+		page.response.Body.Close()
+	}
 	return ctx.Err()
 }
 
-func (c *Crawler) parseArticle(response *http.Response, dom *goquery.Document) (model.Article, error) {
+func (c *Crawler) parseArticle(response *http.Response, dom *goquery.Document) (crawledArticle, error) {
 	originalUrl := response.Request.URL.String()
 	absId, err := c.extractArticleId(originalUrl)
 	if err != nil {
-		return model.Article{}, err
+		return crawledArticle{}, err
 	}
 	title := c.getElemTextByClass(dom, "title mathjax")
 	if len(title) == 0 {
-		return model.Article{}, ErrEmptyTitle
+		return crawledArticle{}, ErrEmptyTitle
 	}
 	authorsRaw := c.getElemTextByClass(dom, "authors")
 	if len(authorsRaw) == 0 {
-		return model.Article{}, ErrEmptyAuthors
+		return crawledArticle{}, ErrEmptyAuthors
 	}
 	authors := strings.Split(authorsRaw, ", ")
 	abstract := c.getElemTextByClass(dom, "abstract mathjax")
@@ -361,7 +738,43 @@ func (c *Crawler) parseArticle(response *http.Response, dom *goquery.Document) (
 		},
 		FullDocumentURL: *response.Request.URL,
 	}
-	return article, nil
+	c.parseDetails(dom, &article.ArticleMeta)
+	versions := c.parseSubmissionHistory(article.Id, dom)
+	if len(versions) > 0 {
+		article.SubmittedAt = versions[0].SubmittedAt
+		article.LatestVersionAt = versions[len(versions)-1].SubmittedAt
+		if article.LatestVersionAt != 0 {
+			article.LastUpdateTimestamp = article.LatestVersionAt
+		}
+	}
+	return crawledArticle{Article: article, Versions: withSnapshot(article, versions)}, nil
+}
+
+// parseDetails extracts categories, the optional metadata table rows and the license.
+func (c *Crawler) parseDetails(dom *goquery.Document, article *model.ArticleMeta) {
+	text := func(selector string) string {
+		return strings.Join(strings.Fields(dom.Find(selector).First().Text()), " ")
+	}
+	article.Categories = extractCategories(text("td.tablecell.subjects"))
+	article.Comments = text("td.tablecell.comments")
+	article.JournalRef = text("td.tablecell.jref")
+	article.DOI = text("td.tablecell.doi a")
+	if article.DOI == "" {
+		article.DOI = text("td.tablecell.doi")
+	}
+	if license, ok := dom.Find(".abs-license a").First().Attr("href"); ok {
+		article.License = license
+	}
+}
+
+// extractCategories extracts category codes from a subjects line such as
+// "Machine Learning (cs.LG); Quantum Physics (quant-ph)", the primary one first.
+func extractCategories(subjects string) []string {
+	var categories []string
+	for _, m := range categoryRegexp.FindAllStringSubmatch(subjects, -1) {
+		categories = append(categories, m[1])
+	}
+	return categories
 }
 
 func (c *Crawler) getElemTextByClass(dom *goquery.Document, class string) string {
@@ -378,8 +791,14 @@ func (c *Crawler) extractArticleId(originalUrl string) (string, error) {
 	return absId, nil
 }
 
-func (c *Crawler) collectUrls(dom *goquery.Document, cfg *Configuration, NewURLChan chan<- string) error {
-	var err error
+// collectUrls returns links of a page to be queued.
+func (c *Crawler) collectUrls(dom *goquery.Document, cfg *Configuration, base *url.URL) ([]string, error) {
+	root, err := url.Parse(cfg.RootURL)
+	if err != nil {
+		return nil, err
+	}
+	seen := make(map[string]bool)
+	var links []string
 	dom.Find("a[href]").Each(func(i int, s *goquery.Selection) {
 		if err != nil {
 			return
@@ -389,12 +808,17 @@ func (c *Crawler) collectUrls(dom *goquery.Document, cfg *Configuration, NewURLC
 			err = ErrExpectedHref
 			return
 		}
-		if strings.HasPrefix(suburl, "/") {
-			suburl = cfg.RootURL + suburl[1:]
+		suburl, ok := normalizeURL(root, base, suburl)
+		if !ok || seen[suburl] || strings.Contains(suburl, "/pdf/") || strings.Contains(suburl, "/ps/") {
+			return
 		}
-		if strings.Contains(suburl, cfg.RootURL) && !strings.Contains(suburl, "/pdf/") && !strings.Contains(suburl, "/ps/") {
-			NewURLChan <- suburl
+		seen[suburl] = true
+		u, _ := url.Parse(suburl)
+		if !cfg.inScope(u) {
+			totalURLsBlocked.WithLabelValues("scope").Inc()
+			return
 		}
+		links = append(links, suburl)
 	})
-	return err
+	return links, err
 }
@@ -0,0 +1,208 @@
+package crawler
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/mp-hl-2021/unarXiv/internal/interface/utils"
+)
+
+const (
+	// maxURLAttempts is how many times a URL failing with transient errors is
+	// tried before it goes to the dead-letter table.
+	maxURLAttempts = 5
+	retryBaseDelay = 30 * time.Second
+	retryMaxDelay  = 6 * time.Hour
+	// snippetLength bounds the part of a failed page kept for operators.
+	snippetLength = 2048
+)
+
+// urlError is a failure to crawl a single URL. Permanent failures are not
+// retried, e.g. a missing page or one that can't be parsed.
+type urlError struct {
+	err        error
+	permanent  bool
+	httpStatus int
+	snippet    string
+}
+
+func (e *urlError) Error() string {
+	return e.err.Error()
+}
+
+func (e *urlError) Unwrap() error {
+	return e.err
+}
+
+func transientError(err error) *urlError {
+	return &urlError{err: err}
+}
+
+func permanentError(err error, snippet []byte) *urlError {
+	return &urlError{err: err, permanent: true, snippet: cutSnippet(snippet)}
+}
+
+// statusError classifies an unsuccessful response, rate limiting and server
+// errors being transient.
+func statusError(status int, body []byte) *urlError {
+	return &urlError{
+		err:        fmt.Errorf("unexpected status %d %s", status, http.StatusText(status)),
+		permanent:  status != http.StatusTooManyRequests && status != http.StatusRequestTimeout && status < 500,
+		httpStatus: status,
+		snippet:    cutSnippet(body),
+	}
+}
+
+func cutSnippet(body []byte) string {
+	if len(body) > snippetLength {
+		body = body[:snippetLength]
+	}
+	return strings.ToValidUTF8(string(body), "")
+}
+
+// retryDelay grows exponentially with the number of attempts, with jitter so
+// that URLs failed together are not retried together.
+func retryDelay(attempts int) time.Duration {
+	delay := retryMaxDelay
+	if attempts < 20 {
+		if d := retryBaseDelay << uint(attempts-1); d < retryMaxDelay {
+			delay = d
+		}
+	}
+	return delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+}
+
+// urlFailed schedules a retry of a URL or moves it to the dead-letter table.
+// An error is only returned if the failure couldn't be stored.
+func (c *Crawler) urlFailed(url string, failure *urlError) error {
+	var attempts int
+	err := c.db.QueryRow("UPDATE CrawlStatus SET RetryCount = RetryCount + 1, LastError = $2 WHERE URL = $1 AND LeasedBy = $3 RETURNING RetryCount;",
+		url, failure.Error(), c.workerId).Scan(&attempts)
+	if err == sql.ErrNoRows {
+		// the lease expired and the URL was queued again
+		fmt.Fprintf(os.Stderr, "Lost the lease of %s, failed with: %v\n", url, failure)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if !failure.permanent && attempts < maxURLAttempts {
+		fmt.Fprintf(os.Stderr, "Failed to crawl %s, attempt %d: %v\n", url, attempts, failure)
+		totalURLFailures.WithLabelValues("transient").Inc()
+		nextAttempt := utils.Uint64Time(time.Now().Add(retryDelay(attempts)))
+		_, err := c.db.Exec(`UPDATE CrawlStatus SET State = 'queued', NextAttemptAt = $2, LeasedBy = NULL, LeasedAt = NULL, LeaseExpiresAt = NULL
+WHERE URL = $1;`, url, nextAttempt)
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "Gave up crawling %s after %d attempts: %v\n", url, attempts, failure)
+	if failure.permanent {
+		totalURLFailures.WithLabelValues("permanent").Inc()
+	} else {
+		totalURLFailures.WithLabelValues("exhausted").Inc()
+	}
+	_, err = c.db.Exec("UPDATE CrawlStatus SET State = 'failed', LeasedBy = NULL, LeasedAt = NULL, LeaseExpiresAt = NULL WHERE URL = $1;", url)
+	if err != nil {
+		return err
+	}
+	var httpStatus interface{}
+	if failure.httpStatus != 0 {
+		httpStatus = failure.httpStatus
+	}
+	_, err = c.db.Exec(`INSERT INTO CrawlFailures (URL, Error, Snippet, HTTPStatus, Attempts, FailedAt) VALUES ($1, $2, $3, $4, $5, $6)
+ON CONFLICT (URL) DO UPDATE SET Error = EXCLUDED.Error, Snippet = EXCLUDED.Snippet, HTTPStatus = EXCLUDED.HTTPStatus,
+    Attempts = EXCLUDED.Attempts, FailedAt = EXCLUDED.FailedAt;`,
+		url, failure.Error(), failure.snippet, httpStatus, attempts, utils.Uint64Time(time.Now()))
+	return err
+}
+
+// urlDeferred queues a URL again to be claimed not before until, without
+// counting an attempt.
+func (c *Crawler) urlDeferred(url string, until time.Time) error {
+	_, err := c.db.Exec(`UPDATE CrawlStatus SET State = 'queued', NextAttemptAt = $3, LeasedBy = NULL, LeasedAt = NULL, LeaseExpiresAt = NULL
+WHERE URL = $1 AND LeasedBy = $2;`, url, c.workerId, utils.Uint64Time(until))
+	return err
+}
+
+// urlSucceeded marks a URL as parsed and forgets its earlier failures.
+func (c *Crawler) urlSucceeded(url string) error {
+	_, err := c.db.Exec("UPDATE CrawlStatus SET State = 'parsed', LeasedBy = NULL, LeasedAt = NULL, LeaseExpiresAt = NULL WHERE URL = $1 AND LeasedBy = $2;",
+		url, c.workerId)
+	if err != nil {
+		return err
+	}
+	res, err := c.db.Exec("UPDATE CrawlStatus SET RetryCount = 0, NextAttemptAt = NULL, LastError = NULL WHERE URL = $1 AND RetryCount > 0;", url)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil || n == 0 {
+		return err
+	}
+	_, err = c.db.Exec("DELETE FROM CrawlFailures WHERE URL = $1;", url)
+	return err
+}
+
+// handleFailure records a failure of a URL. Workers stop on the error it returns,
+// which happens when the crawl is canceled or the failure could not be recorded.
+func (c *Crawler) handleFailure(ctx context.Context, url string, failure *urlError) error {
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return c.urlFailed(url, failure)
+}
+
+// FailedURL is a URL in the dead-letter table.
+type FailedURL struct {
+	URL        string
+	Error      string
+	Snippet    string
+	HTTPStatus int
+	Attempts   int
+	FailedAt   uint64
+}
+
+// FailedURLs returns up to limit URLs the crawler gave up on, most recent first.
+func (c *Crawler) FailedURLs(limit int) ([]FailedURL, error) {
+	rows, err := c.db.Query(`SELECT URL, Error, coalesce(Snippet, ''), coalesce(HTTPStatus, 0), Attempts, FailedAt
+FROM CrawlFailures ORDER BY FailedAt DESC LIMIT $1;`, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var failures []FailedURL
+	for rows.Next() {
+		var f FailedURL
+		if err := rows.Scan(&f.URL, &f.Error, &f.Snippet, &f.HTTPStatus, &f.Attempts, &f.FailedAt); err != nil {
+			return nil, err
+		}
+		failures = append(failures, f)
+	}
+	return failures, rows.Err()
+}
+
+var ErrNothingToRequeue = errors.New("no URLs to requeue given")
+
+// RequeueFailed moves URLs from the dead-letter table back to the queue with
+// a fresh retry budget, all of them if all is set. It returns how many were requeued.
+func (c *Crawler) RequeueFailed(urls []string, all bool) (int, error) {
+	if len(urls) == 0 && !all {
+		return 0, ErrNothingToRequeue
+	}
+	res, err := c.db.Exec(`WITH Requeued AS (
+    DELETE FROM CrawlFailures WHERE $1 OR URL = ANY($2) RETURNING URL
+)
+UPDATE CrawlStatus SET State = 'queued', RetryCount = 0, NextAttemptAt = NULL, LastError = NULL
+WHERE URL IN (SELECT URL FROM Requeued);`, all, pq.Array(urls))
+	if err != nil {
+		return 0, err
+	}
+	n, err := res.RowsAffected()
+	return int(n), err
+}
@@ -0,0 +1,144 @@
+package crawler
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httputil"
+	"strings"
+	"sync"
+
+	"github.com/mp-hl-2021/unarXiv/internal/interface/warc"
+)
+
+// DefaultUserAgent identifies requests of the crawler unless configured otherwise.
+const DefaultUserAgent = "unarXiv-crawler/1.0 (+https://github.com/mp-hl-2021/unarXiv)"
+
+// requestedURIField keeps the URL a response was fetched for when redirects
+// led to another one.
+const requestedURIField = "X-Requested-URI"
+
+// Fetcher downloads pages for the crawler. header holds additional request
+// fields, e.g. for conditional requests. The Request of a response is the one
+// of the final URL after redirects.
+type Fetcher interface {
+	Fetch(ctx context.Context, url string, header http.Header) (*http.Response, error)
+}
+
+// WARCRecorder is a fetcher writing responses of another one to a WARC file.
+type WARCRecorder struct {
+	fetcher Fetcher
+
+	mu sync.Mutex
+	w  *warc.Writer
+}
+
+// NewWARCRecorder records responses of fetcher to w, starting with a record
+// describing the crawler.
+func NewWARCRecorder(fetcher Fetcher, w *warc.Writer, userAgent string) (*WARCRecorder, error) {
+	info := "software: unarXiv-crawler\r\nformat: WARC File Format 1.1\r\nhttp-header-user-agent: " + userAgent + "\r\n"
+	err := w.WriteRecord(warc.NewRecord(warc.TypeWarcinfo, "", "application/warc-fields", []byte(info)))
+	if err != nil {
+		return nil, err
+	}
+	return &WARCRecorder{fetcher: fetcher, w: w}, nil
+}
+
+func (r *WARCRecorder) Fetch(ctx context.Context, url string, header http.Header) (*http.Response, error) {
+	response, err := r.fetcher.Fetch(ctx, url, header)
+	if err != nil {
+		return nil, err
+	}
+	// the body is read into memory and replaced by a copy
+	block, err := httputil.DumpResponse(response, true)
+	if err != nil {
+		response.Body.Close()
+		return nil, err
+	}
+	target := url
+	if response.Request != nil {
+		target = response.Request.URL.String()
+	}
+	record := warc.NewRecord(warc.TypeResponse, target, "application/http;msgtype=response", block)
+	if target != url {
+		record.Header.Set(requestedURIField, url)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := r.w.WriteRecord(record); err != nil {
+		response.Body.Close()
+		return nil, err
+	}
+	return response, nil
+}
+
+// WARCReplayer is a fetcher answering with responses recorded in WARC files,
+// to crawl without the network deterministically. URLs that were not recorded
+// are answered with 404 Not Found. If a URL was recorded several times, the
+// last response is used. Records are kept in memory.
+type WARCReplayer struct {
+	responses map[string]warc.Record
+}
+
+// NewWARCReplayer reads response records of WARC files.
+func NewWARCReplayer(files ...io.Reader) (*WARCReplayer, error) {
+	r := &WARCReplayer{responses: make(map[string]warc.Record)}
+	for _, file := range files {
+		reader, err := warc.NewReader(file)
+		if err != nil {
+			return nil, err
+		}
+		for {
+			record, err := reader.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return nil, err
+			}
+			if record.Type() != warc.TypeResponse {
+				continue
+			}
+			r.responses[record.TargetURI()] = record
+			if requested := record.Header.Get(requestedURIField); requested != "" {
+				r.responses[requested] = record
+			}
+		}
+	}
+	return r, nil
+}
+
+// Len is the number of URLs with a recorded response.
+func (r *WARCReplayer) Len() int {
+	return len(r.responses)
+}
+
+func (r *WARCReplayer) Fetch(ctx context.Context, url string, header http.Header) (*http.Response, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	record, ok := r.responses[url]
+	target := url
+	if ok {
+		target = record.TargetURI()
+	}
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return &http.Response{
+			Status:     "404 Not Found",
+			StatusCode: http.StatusNotFound,
+			Proto:      "HTTP/1.1",
+			ProtoMajor: 1,
+			ProtoMinor: 1,
+			Header:     http.Header{},
+			Body:       io.NopCloser(strings.NewReader("")),
+			Request:    request,
+		}, nil
+	}
+	return http.ReadResponse(bufio.NewReader(bytes.NewReader(record.Block)), request)
+}
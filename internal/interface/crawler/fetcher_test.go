@@ -0,0 +1,166 @@
+package crawler
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"testing"
+
+	"github.com/mp-hl-2021/unarXiv/internal/domain/model"
+)
+
+func newTestReplayer(t *testing.T) *WARCReplayer {
+	f, err := os.Open(filepath.Join("testdata", "arxiv.warc.gz"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	replayer, err := NewWARCReplayer(f)
+	if err != nil {
+		t.Fatalf("NewWARCReplayer() error = %v", err)
+	}
+	return replayer
+}
+
+// replayCrawl crawls from start breadth first the way a pipeline does,
+// without the queue in the database. It returns the articles that were
+// stored and the URLs that were not found.
+func replayCrawl(t *testing.T, c *Crawler, cfg *Configuration, start string) (upserted []model.ArticleId, notFound []string) {
+	ctx := context.Background()
+	queue := []string{start}
+	seen := map[string]bool{start: true}
+	for len(queue) > 0 {
+		url := queue[0]
+		queue = queue[1:]
+		response, err := c.fetcher.Fetch(ctx, url, http.Header{})
+		if err != nil {
+			t.Fatalf("Fetch(%s) error = %v", url, err)
+		}
+		if response.StatusCode == http.StatusNotFound {
+			response.Body.Close()
+			notFound = append(notFound, url)
+			continue
+		}
+		page, failure := c.parsePage(cfg, fetchedPage{url: url, response: response})
+		if failure != nil {
+			t.Fatalf("parsePage(%s) error = %v", url, failure.err)
+		}
+		for _, link := range page.links {
+			if !seen[link] {
+				seen[link] = true
+				queue = append(queue, link)
+			}
+		}
+		if page.article == nil {
+			continue
+		}
+		up, err := c.upsertArticle(page.article.Article, page.article.Versions)
+		if err != nil {
+			t.Fatalf("upsertArticle(%s) error = %v", page.article.Id, err)
+		}
+		if up {
+			upserted = append(upserted, page.article.Id)
+		}
+		if up && cfg.IndexFullText {
+			data, err := c.downloadPDF(ctx, c.pdfURL(cfg, page.article.Id))
+			if err == nil {
+				err = c.indexFullText(page.article.Id, data)
+			}
+			if err != nil {
+				t.Logf("full text of %s: %v", page.article.Id, err)
+			}
+		}
+	}
+	return upserted, notFound
+}
+
+func TestCrawlRecordedPages(t *testing.T) {
+	articles := newMemoryArticles()
+	c := &Crawler{articlesRepo: articles, fetcher: newTestReplayer(t)}
+	cfg := &Configuration{
+		RootURL:       "https://arxiv.org/",
+		IndexFullText: true,
+		Exclude:       []*regexp.Regexp{regexp.MustCompile(`^/a/`)},
+		Mode:          ModeDiscover,
+	}
+
+	upserted, notFound := replayCrawl(t, c, cfg, "https://arxiv.org/list/cs.LG/recent")
+	if want := []model.ArticleId{"2101.00001", "2101.00002"}; !reflect.DeepEqual(upserted, want) {
+		t.Errorf("upserted = %q, want %q", upserted, want)
+	}
+	if want := []string{"https://arxiv.org/abs/2101.00003"}; !reflect.DeepEqual(notFound, want) {
+		t.Errorf("not found = %q, want %q", notFound, want)
+	}
+	if got, want := articles.ids(), []model.ArticleId{"2101.00001", "2101.00002"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("crawled articles = %q, want %q", got, want)
+	}
+
+	first, _ := articles.ArticleById("2101.00001")
+	submitted := parseVersionDate("Fri, 1 Jan 2021 10:00:00 UTC")
+	latest := parseVersionDate("Mon, 4 Jan 2021 18:00:02 UTC")
+	want := model.ArticleMeta{
+		Id:                  "2101.00001",
+		Title:               "Sparse Attention for Long Documents",
+		Authors:             []string{"Ada Lovelace", "Alan Turing"},
+		Abstract:            "We show that attention over long documents can be sparse.",
+		LastUpdateTimestamp: latest,
+		Categories:          []string{"cs.LG", "cs.CL"},
+		SubmittedAt:         submitted,
+		LatestVersionAt:     latest,
+		DOI:                 "10.1000/sparse.1",
+		JournalRef:          "J. Sparse Models 1 (2021) 1-12",
+		Comments:            "12 pages, 3 figures",
+		License:             "http://creativecommons.org/licenses/by/4.0/",
+	}
+	if !reflect.DeepEqual(first.ArticleMeta, want) {
+		t.Errorf("article = %+v, want %+v", first.ArticleMeta, want)
+	}
+	if got := first.FullDocumentURL.String(); got != "https://arxiv.org/abs/2101.00001" {
+		t.Errorf("FullDocumentURL = %q, want %q", got, "https://arxiv.org/abs/2101.00001")
+	}
+	versions, _ := articles.ArticleVersions("2101.00001")
+	if len(versions) != 2 || versions[0].SubmittedAt != submitted || versions[0].Recorded ||
+		versions[1].SubmittedAt != latest || !versions[1].Recorded || versions[1].Title != want.Title {
+		t.Errorf("versions = %+v, want v1 and a recorded v2", versions)
+	}
+	if got, want := articles.bodies["2101.00001"], "Page one\n\nPage two\nLast line"; got != want {
+		t.Errorf("body = %q, want %q", got, want)
+	}
+
+	second, _ := articles.ArticleById("2101.00002")
+	if second.Title != "Dense Retrieval Revisited" || !reflect.DeepEqual(second.Authors, []string{"Grace Hopper"}) ||
+		!reflect.DeepEqual(second.Categories, []string{"cs.IR"}) {
+		t.Errorf("article = %+v, want Dense Retrieval Revisited by Grace Hopper in cs.IR", second.ArticleMeta)
+	}
+	// the recorded PDF of the second article is not a PDF
+	if body, ok := articles.bodies["2101.00002"]; ok {
+		t.Errorf("body = %q, want none", body)
+	}
+
+	// nothing changes when the same pages are crawled again
+	if upserted, _ := replayCrawl(t, c, cfg, "https://arxiv.org/list/cs.LG/recent"); len(upserted) != 0 {
+		t.Errorf("upserted again = %q, want none", upserted)
+	}
+}
+
+func TestWARCReplayerRedirects(t *testing.T) {
+	replayer := newTestReplayer(t)
+	response, err := replayer.Fetch(context.Background(), "https://arxiv.org/list/cs.LG/recent", nil)
+	if err != nil {
+		t.Fatalf("Fetch() error = %v", err)
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		t.Errorf("StatusCode = %d, want %d", response.StatusCode, http.StatusOK)
+	}
+	// links are resolved against the URL the response came from
+	if got, want := response.Request.URL.String(), "https://arxiv.org/list/cs.LG/pastweek?show=25"; got != want {
+		t.Errorf("Request.URL = %q, want %q", got, want)
+	}
+	if got, want := response.Header.Get("Last-Modified"), "Mon, 04 Jan 2021 20:00:00 GMT"; got != want {
+		t.Errorf("Last-Modified = %q, want %q", got, want)
+	}
+}
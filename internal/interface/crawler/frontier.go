@@ -0,0 +1,153 @@
+package crawler
+
+import (
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// Priorities of queued URLs, higher ones are crawled first.
+const (
+	otherPriority = iota
+	listingPriority
+	articlePriority
+	// subscribedPriority is for recrawling articles someone is subscribed to.
+	subscribedPriority
+	// manualPriority is for articles queued by operators.
+	manualPriority
+)
+
+var (
+	// versionSuffix matches the version of an article page, /abs/x and
+	// /abs/xv2 show the same article, so only the former is queued.
+	versionSuffix = regexp.MustCompile(`v[0-9]+$`)
+
+	listingPrefixes = []string{"/list/", "/catchup", "/year/"}
+
+	trackingParams = map[string]bool{
+		"fbclid": true,
+		"gclid":  true,
+		"mc_cid": true,
+		"mc_eid": true,
+	}
+)
+
+// normalizeURL resolves href found on base and converts it to the canonical
+// form: the scheme and host of root when it is on the same site, lowercase
+// host, no default port, fragment or tracking parameters, sorted query and
+// article pages without the version. It reports false for links off the site
+// of root and for links that are not web pages.
+func normalizeURL(root, base *url.URL, href string) (string, bool) {
+	ref, err := url.Parse(strings.TrimSpace(href))
+	if err != nil {
+		return "", false
+	}
+	u := base.ResolveReference(ref)
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return "", false
+	}
+	if canonicalHost(u) != canonicalHost(root) {
+		return "", false
+	}
+	u.Scheme = root.Scheme
+	u.Host = strings.ToLower(root.Host)
+	u.User = nil
+	u.Fragment = ""
+	u.RawFragment = ""
+
+	p := u.Path
+	if p == "" {
+		p = "/"
+	}
+	trailingSlash := strings.HasSuffix(p, "/")
+	p = path.Clean(p)
+	if trailingSlash && p != "/" {
+		p += "/"
+	}
+	if strings.HasPrefix(p, "/abs/") {
+		p = versionSuffix.ReplaceAllString(p, "")
+	}
+	u.Path = p
+	u.RawPath = ""
+
+	query := u.Query()
+	for key := range query {
+		if strings.HasPrefix(strings.ToLower(key), "utm_") || trackingParams[strings.ToLower(key)] {
+			query.Del(key)
+		}
+	}
+	// Encode sorts by key
+	u.RawQuery = query.Encode()
+	u.ForceQuery = false
+	return u.String(), true
+}
+
+// canonicalHost is the host of u in lowercase, without the default port and www.
+func canonicalHost(u *url.URL) string {
+	host := strings.ToLower(u.Hostname())
+	port := u.Port()
+	if (u.Scheme == "http" && port == "80") || (u.Scheme == "https" && port == "443") {
+		port = ""
+	}
+	host = strings.TrimPrefix(host, "www.")
+	if port != "" {
+		return host + ":" + port
+	}
+	return host
+}
+
+// inScope checks the path and query of a normalized URL against the rules of
+// a configuration: it must match an include rule if there are any, and must
+// not match any exclude rule.
+func (cfg *Configuration) inScope(u *url.URL) bool {
+	target := u.RequestURI()
+	if len(cfg.Include) > 0 {
+		included := false
+		for _, rule := range cfg.Include {
+			if rule.MatchString(target) {
+				included = true
+				break
+			}
+		}
+		if !included {
+			return false
+		}
+	}
+	for _, rule := range cfg.Exclude {
+		if rule.MatchString(target) {
+			return false
+		}
+	}
+	return true
+}
+
+// urlPriority prefers article pages, and listings which link to them.
+func urlPriority(rawURL string) int {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return otherPriority
+	}
+	if strings.HasPrefix(u.Path, "/abs/") {
+		return articlePriority
+	}
+	for _, prefix := range listingPrefixes {
+		if strings.HasPrefix(u.Path, prefix) {
+			return listingPriority
+		}
+	}
+	return otherPriority
+}
+
+// compileRules compiles include or exclude rules of a configuration.
+func compileRules(patterns []string) ([]*regexp.Regexp, error) {
+	rules := make([]*regexp.Regexp, 0, len(patterns))
+	for _, pattern := range patterns {
+		rule, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
@@ -0,0 +1,127 @@
+package crawler
+
+import (
+	"net/url"
+	"regexp"
+	"testing"
+)
+
+func mustParseURL(t *testing.T, rawURL string) *url.URL {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return u
+}
+
+func TestNormalizeURL(t *testing.T) {
+	root := mustParseURL(t, "https://arxiv.org/list/cs.LG/recent")
+	base := mustParseURL(t, "https://arxiv.org/abs/2101.00001")
+	tests := []struct {
+		href string
+		want string
+		ok   bool
+	}{
+		{href: "/abs/2101.00002", want: "https://arxiv.org/abs/2101.00002", ok: true},
+		{href: "2101.00002", want: "https://arxiv.org/abs/2101.00002", ok: true},
+		{href: "  /abs/2101.00002\n", want: "https://arxiv.org/abs/2101.00002", ok: true},
+		{href: "", want: "https://arxiv.org/abs/2101.00001", ok: true},
+		// fragments
+		{href: "#references", want: "https://arxiv.org/abs/2101.00001", ok: true},
+		{href: "/abs/2101.00002#abstract", want: "https://arxiv.org/abs/2101.00002", ok: true},
+		// empty and reordered queries
+		{href: "/abs/2101.00002?", want: "https://arxiv.org/abs/2101.00002", ok: true},
+		{href: "/list/cs.LG/pastweek?skip=25&show=25", want: "https://arxiv.org/list/cs.LG/pastweek?show=25&skip=25", ok: true},
+		{href: "/list/cs.LG/pastweek?show=25&skip=25", want: "https://arxiv.org/list/cs.LG/pastweek?show=25&skip=25", ok: true},
+		// versions of article pages, but not of other ones
+		{href: "/abs/2101.00002v2", want: "https://arxiv.org/abs/2101.00002", ok: true},
+		{href: "/abs/hep-th/9901001v12", want: "https://arxiv.org/abs/hep-th/9901001", ok: true},
+		{href: "/pdf/2101.00002v2", want: "https://arxiv.org/pdf/2101.00002v2", ok: true},
+		// schemes, hosts and ports of the same site
+		{href: "http://arxiv.org/abs/2101.00002", want: "https://arxiv.org/abs/2101.00002", ok: true},
+		{href: "//arxiv.org/abs/2101.00002", want: "https://arxiv.org/abs/2101.00002", ok: true},
+		{href: "https://www.arxiv.org/abs/2101.00002", want: "https://arxiv.org/abs/2101.00002", ok: true},
+		{href: "HTTPS://ArXiv.ORG/abs/2101.00002", want: "https://arxiv.org/abs/2101.00002", ok: true},
+		{href: "https://arxiv.org:443/abs/2101.00002", want: "https://arxiv.org/abs/2101.00002", ok: true},
+		{href: "http://arxiv.org:80/abs/2101.00002", want: "https://arxiv.org/abs/2101.00002", ok: true},
+		{href: "https://user@arxiv.org/abs/2101.00002", want: "https://arxiv.org/abs/2101.00002", ok: true},
+		// tracking parameters
+		{href: "/abs/2101.00002?utm_source=feed&utm_medium=rss", want: "https://arxiv.org/abs/2101.00002", ok: true},
+		{href: "/list/cs.LG/new?UTM_Campaign=x&show=25&fbclid=1", want: "https://arxiv.org/list/cs.LG/new?show=25", ok: true},
+		// trailing slashes are kept, dot segments are not
+		{href: "/list/cs.LG/", want: "https://arxiv.org/list/cs.LG/", ok: true},
+		{href: "/list/cs.LG", want: "https://arxiv.org/list/cs.LG", ok: true},
+		{href: "/list/./cs.LG/../cs.AI//new", want: "https://arxiv.org/list/cs.AI/new", ok: true},
+		{href: "https://arxiv.org", want: "https://arxiv.org/", ok: true},
+		// off the site or not web pages
+		{href: "https://export.arxiv.org/abs/2101.00002"},
+		{href: "https://arxiv.org:8443/abs/2101.00002"},
+		{href: "https://example.com/abs/2101.00002"},
+		{href: "mailto:help@arxiv.org"},
+		{href: "javascript:void(0)"},
+		{href: "ftp://arxiv.org/pub/"},
+		{href: "http://[::1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.href, func(t *testing.T) {
+			got, ok := normalizeURL(root, base, tt.href)
+			if got != tt.want || ok != tt.ok {
+				t.Errorf("normalizeURL(%q) = %q, %v, want %q, %v", tt.href, got, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
+
+func TestCanonicalHost(t *testing.T) {
+	tests := map[string]string{
+		"https://arxiv.org/abs/x":      "arxiv.org",
+		"http://arxiv.org/abs/x":       "arxiv.org",
+		"https://WWW.ArXiv.org/":       "arxiv.org",
+		"https://arxiv.org:443/":       "arxiv.org",
+		"http://arxiv.org:80/":         "arxiv.org",
+		"https://arxiv.org:80/":        "arxiv.org:80",
+		"http://arxiv.org:443/":        "arxiv.org:443",
+		"http://localhost:8080/":       "localhost:8080",
+		"https://export.arxiv.org/api": "export.arxiv.org",
+		"https://www.example.com":      "example.com",
+	}
+	for rawURL, want := range tests {
+		if got := canonicalHost(mustParseURL(t, rawURL)); got != want {
+			t.Errorf("canonicalHost(%q) = %q, want %q", rawURL, got, want)
+		}
+	}
+}
+
+func TestInScope(t *testing.T) {
+	articlesAndListings := &Configuration{
+		Include: []*regexp.Regexp{regexp.MustCompile(`^/abs/`), regexp.MustCompile(`^/list/cs\.`)},
+		Exclude: []*regexp.Regexp{regexp.MustCompile(`[?&]skip=`)},
+	}
+	excludeOnly := &Configuration{
+		Exclude: []*regexp.Regexp{regexp.MustCompile(`^/pdf/`)},
+	}
+	tests := []struct {
+		name string
+		cfg  *Configuration
+		url  string
+		want bool
+	}{
+		{name: "no rules", cfg: &Configuration{}, url: "https://arxiv.org/pdf/2101.00001", want: true},
+		{name: "first include rule", cfg: articlesAndListings, url: "https://arxiv.org/abs/2101.00001", want: true},
+		{name: "second include rule", cfg: articlesAndListings, url: "https://arxiv.org/list/cs.LG/new", want: true},
+		{name: "no include rule", cfg: articlesAndListings, url: "https://arxiv.org/list/math.AG/new"},
+		{name: "rules are anchored to the path", cfg: articlesAndListings, url: "https://arxiv.org/help/abs/"},
+		{name: "include and exclude rule", cfg: articlesAndListings, url: "https://arxiv.org/list/cs.LG/pastweek?show=25&skip=25"},
+		{name: "query without an exclude rule", cfg: articlesAndListings, url: "https://arxiv.org/list/cs.LG/pastweek?show=25", want: true},
+		{name: "exclude rule only", cfg: excludeOnly, url: "https://arxiv.org/pdf/2101.00001"},
+		{name: "no exclude rule", cfg: excludeOnly, url: "https://arxiv.org/abs/2101.00001", want: true},
+		{name: "root", cfg: excludeOnly, url: "https://arxiv.org", want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.cfg.inScope(mustParseURL(t, tt.url)); got != tt.want {
+				t.Errorf("inScope(%q) = %v, want %v", tt.url, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,145 @@
+package crawler
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/mp-hl-2021/unarXiv/internal/interface/utils"
+)
+
+const (
+	// A claimed URL is leased to a worker until it is processed or the lease
+	// expires. Workers renew leases of their URLs on every heartbeat, so leases
+	// of a stopped worker expire soon and its URLs are claimed by others.
+	leaseTTL          = 5 * time.Minute
+	heartbeatInterval = time.Minute
+	// maxLeaseAge stops renewing a lease of a URL a live worker has lost track of.
+	maxLeaseAge = time.Hour
+	// staleWorkerAge is how long a worker without heartbeats is listed.
+	staleWorkerAge = 24 * time.Hour
+
+	claimBatch = 100
+)
+
+// claimQuery leases due unvisited URLs, most important first, skipping rows
+// other workers are claiming at the same time.
+const claimQuery = `
+WITH Claimed AS (
+    SELECT URL FROM CrawlStatus
+    WHERE RootURL = $5 AND State = 'queued' AND (NextAttemptAt IS NULL OR NextAttemptAt <= $1)
+        AND (NOT $6 OR LastAccess IS NOT NULL)
+    ORDER BY Priority DESC
+    LIMIT $2
+    FOR UPDATE SKIP LOCKED
+)
+UPDATE CrawlStatus c SET State = 'claimed', LeasedBy = $3, LeasedAt = $1, LeaseExpiresAt = $4
+FROM Claimed WHERE c.URL = Claimed.URL
+RETURNING c.URL, COALESCE(c.ETag, ''), COALESCE(c.LastModified, '');
+`
+
+// claimURLs leases a batch of URLs of a root to the worker, only ones that
+// were visited before if refreshOnly is set.
+func (c *Crawler) claimURLs(rootURL string, refreshOnly bool) ([]queuedURL, error) {
+	now := time.Now()
+	rows, err := c.db.Query(claimQuery, utils.Uint64Time(now), claimBatch, c.workerId, utils.Uint64Time(now.Add(leaseTTL)), rootURL, refreshOnly)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	urls := make([]queuedURL, 0, claimBatch)
+	for rows.Next() {
+		url := queuedURL{}
+		if err := rows.Scan(&url.url, &url.etag, &url.lastModified); err != nil {
+			return nil, err
+		}
+		urls = append(urls, url)
+	}
+	return urls, rows.Err()
+}
+
+// releaseURLs puts claimed URLs that were not sent to downloaders back to the queue.
+func (c *Crawler) releaseURLs(urls []queuedURL) error {
+	raw := make([]string, 0, len(urls))
+	for _, url := range urls {
+		raw = append(raw, url.url)
+	}
+	_, err := c.db.Exec("UPDATE CrawlStatus SET State = 'queued', LeasedBy = NULL, LeasedAt = NULL, LeaseExpiresAt = NULL WHERE URL = ANY($1) AND LeasedBy = $2;",
+		pq.Array(raw), c.workerId)
+	return err
+}
+
+// releaseOwnLeases puts URLs the worker claimed but didn't process back to
+// the queue, when a crawl stops or a restarted worker starts.
+func (c *Crawler) releaseOwnLeases() error {
+	_, err := c.db.Exec("UPDATE CrawlStatus SET State = 'queued', LeasedBy = NULL, LeasedAt = NULL, LeaseExpiresAt = NULL WHERE LeasedBy = $1;", c.workerId)
+	return err
+}
+
+// releaseLeases puts URLs of a root the worker claimed but didn't process back
+// to the queue, when the pipeline of the root stops.
+func (c *Crawler) releaseLeases(rootURL string) error {
+	_, err := c.db.Exec("UPDATE CrawlStatus SET State = 'queued', LeasedBy = NULL, LeasedAt = NULL, LeaseExpiresAt = NULL WHERE LeasedBy = $1 AND RootURL = $2;",
+		c.workerId, rootURL)
+	return err
+}
+
+// reclaimExpiredLeases puts URLs of workers that stopped heartbeating back to the queue.
+func (c *Crawler) reclaimExpiredLeases() error {
+	res, err := c.db.Exec("UPDATE CrawlStatus SET State = 'queued', LeasedBy = NULL, LeasedAt = NULL, LeaseExpiresAt = NULL WHERE LeaseExpiresAt <= $1;",
+		utils.Uint64Time(time.Now()))
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err == nil && n > 0 {
+		fmt.Println("Reclaimed", n, "URLs with expired leases")
+		totalLeasesReclaimed.Add(float64(n))
+	}
+	return nil
+}
+
+// heartbeat registers the worker as alive, renews its leases and reclaims
+// expired leases of other workers.
+func (c *Crawler) heartbeat(ctx context.Context) error {
+	started := utils.Uint64Time(time.Now())
+	ticker := time.NewTicker(heartbeatInterval)
+	defer ticker.Stop()
+	for {
+		now := time.Now()
+		_, err := c.db.Exec(`INSERT INTO CrawlWorkers (WorkerId, StartedAt, HeartbeatAt) VALUES ($1, $2, $3)
+ON CONFLICT (WorkerId) DO UPDATE SET StartedAt = EXCLUDED.StartedAt, HeartbeatAt = EXCLUDED.HeartbeatAt;`,
+			c.workerId, started, utils.Uint64Time(now))
+		if err != nil {
+			return err
+		}
+		_, err = c.db.Exec("UPDATE CrawlStatus SET LeaseExpiresAt = $2 WHERE LeasedBy = $1 AND LeasedAt > $3;",
+			c.workerId, utils.Uint64Time(now.Add(leaseTTL)), utils.Uint64Time(now.Add(-maxLeaseAge)))
+		if err != nil {
+			return err
+		}
+		if err := c.reclaimExpiredLeases(); err != nil {
+			return err
+		}
+		_, err = c.db.Exec("DELETE FROM CrawlWorkers WHERE HeartbeatAt < $1;", utils.Uint64Time(now.Add(-staleWorkerAge)))
+		if err != nil {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// DefaultWorkerId identifies a crawler process, the hostname is the container
+// id when crawler replicas run in docker-compose.
+func DefaultWorkerId() string {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "crawler"
+	}
+	return fmt.Sprintf("%s-%d", host, os.Getpid())
+}
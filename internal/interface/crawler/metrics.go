@@ -17,15 +17,60 @@ var (
 		Name: "crawler_total_articles_updated",
 		Help: "Number of articles updated by crawler",
 	}, []string{"inserted"})
+	totalFullTexts = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "crawler_total_full_texts",
+		Help: "Number of article PDFs processed by crawler",
+	}, []string{"result"})
+	totalURLsDeferred = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "crawler_total_urls_deferred",
+		Help: "Number of URLs whose download was delayed to respect a host's crawl delay",
+	})
+	totalURLsBlocked = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "crawler_total_urls_blocked",
+		Help: "Number of URLs not downloaded by crawler",
+	}, []string{"reason"})
+	totalURLFailures = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "crawler_total_url_failures",
+		Help: "Number of failed URL visits by whether they are retried, failed permanently or ran out of attempts",
+	}, []string{"kind"})
+	totalRecrawls = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "crawler_total_recrawls",
+		Help: "Number of article pages enqueued for recrawling",
+	})
+	totalNotModified = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "crawler_total_not_modified",
+		Help: "Number of conditional requests answered with 304 Not Modified",
+	})
+	totalLeasesReclaimed = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "crawler_total_leases_reclaimed",
+		Help: "Number of URLs put back to the queue after their lease expired",
+	})
+	pipelineState = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "crawler_pipeline_state",
+		Help: "Pipeline state seen by the worker, 1 for the current one",
+	}, []string{"state"})
+	totalStateChanges = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "crawler_total_state_changes",
+		Help: "Number of pipeline state changes made through the worker",
+	}, []string{"state"})
+	totalAdminRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "crawler_total_admin_requests",
+		Help: "Handled requests to the admin API",
+	}, []string{"action", "code"})
 	urlVisitDuration = promauto.NewHistogram(prometheus.HistogramOpts{
 		Name: "crawler_url_visit_duration_seconds",
 		Help: "Duration of a URL visit measured in seconds",
 	})
 )
 
-func (c *Crawler) RunMetricsServer() {
-	http.Handle("/metrics", promhttp.Handler())
-	if err := http.ListenAndServe(":8090", nil); err != nil {
+// RunMetricsServer serves metrics, and the admin API if adminToken is set.
+func (c *Crawler) RunMetricsServer(adminToken string) {
+	router := http.NewServeMux()
+	router.Handle("/metrics", promhttp.Handler())
+	if adminToken != "" {
+		router.Handle("/admin/", c.AdminRouter(adminToken))
+	}
+	if err := http.ListenAndServe(":8090", router); err != nil {
 		fmt.Println("Metrics server error:", err)
 	}
 }
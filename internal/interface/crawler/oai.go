@@ -0,0 +1,366 @@
+package crawler
+
+import (
+	"context"
+	"database/sql"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mp-hl-2021/unarXiv/internal/domain/model"
+	"github.com/mp-hl-2021/unarXiv/internal/interface/utils"
+)
+
+const (
+	// OAIFormatArXiv is the arXiv metadata format with structured author names.
+	OAIFormatArXiv = "arXiv"
+	// OAIFormatArXivRaw is the arXiv metadata format with the version history.
+	OAIFormatArXivRaw = "arXivRaw"
+
+	oaiDateLayout = "2006-01-02"
+	// oaiMaxRetries bounds retries of a request the repository asked to retry later.
+	oaiMaxRetries   = 5
+	oaiMaxRetryWait = 10 * time.Minute
+)
+
+// OAIConfig configures harvesting of an OAI-PMH repository such as http://export.arxiv.org/oai2.
+type OAIConfig struct {
+	BaseURL        string
+	MetadataPrefix string
+	// Set restricts harvesting to a set such as "cs" or "physics:hep-th", all records if empty.
+	Set string
+	// RequestDelay is the pause between consecutive requests.
+	RequestDelay time.Duration
+	// AbsURL is the prefix of abstract page URLs stored with articles.
+	AbsURL string
+	// UserAgent identifies requests, DefaultUserAgent if empty.
+	UserAgent string
+	Client    *http.Client
+}
+
+// harvestState is where harvesting of a list stopped. A non-empty ResumptionToken
+// means a list was interrupted, otherwise the next list starts at From.
+type harvestState struct {
+	From            string
+	ResumptionToken string
+}
+
+type oaiResponse struct {
+	Error *struct {
+		Code    string `xml:"code,attr"`
+		Message string `xml:",chardata"`
+	} `xml:"error"`
+	Records         []oaiRecord `xml:"ListRecords>record"`
+	ResumptionToken string      `xml:"ListRecords>resumptionToken"`
+}
+
+type oaiRecord struct {
+	Header struct {
+		Status     string `xml:"status,attr"`
+		Datestamp  string `xml:"datestamp"`
+		Identifier string `xml:"identifier"`
+	} `xml:"header"`
+	ArXiv    *oaiArXiv    `xml:"metadata>arXiv"`
+	ArXivRaw *oaiArXivRaw `xml:"metadata>arXivRaw"`
+}
+
+type oaiArXiv struct {
+	Id      string `xml:"id"`
+	Created string `xml:"created"`
+	Updated string `xml:"updated"`
+	Authors []struct {
+		Keyname   string `xml:"keyname"`
+		Forenames string `xml:"forenames"`
+		Suffix    string `xml:"suffix"`
+	} `xml:"authors>author"`
+	Title      string `xml:"title"`
+	Categories string `xml:"categories"`
+	Comments   string `xml:"comments"`
+	JournalRef string `xml:"journal-ref"`
+	DOI        string `xml:"doi"`
+	License    string `xml:"license"`
+	Abstract   string `xml:"abstract"`
+}
+
+type oaiArXivRaw struct {
+	Id       string `xml:"id"`
+	Versions []struct {
+		Version string `xml:"version,attr"`
+		Date    string `xml:"date"`
+	} `xml:"version"`
+	Title      string `xml:"title"`
+	Authors    string `xml:"authors"`
+	Categories string `xml:"categories"`
+	Comments   string `xml:"comments"`
+	JournalRef string `xml:"journal-ref"`
+	DOI        string `xml:"doi"`
+	License    string `xml:"license"`
+	Abstract   string `xml:"abstract"`
+}
+
+func collapseSpaces(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
+
+func (m *oaiArXiv) article() crawledArticle {
+	article := model.Article{ArticleMeta: model.ArticleMeta{
+		Id:         model.ArticleId(m.Id),
+		Title:      collapseSpaces(m.Title),
+		Abstract:   collapseSpaces(m.Abstract),
+		Categories: strings.Fields(m.Categories),
+		Comments:   collapseSpaces(m.Comments),
+		JournalRef: collapseSpaces(m.JournalRef),
+		DOI:        strings.TrimSpace(m.DOI),
+		License:    strings.TrimSpace(m.License),
+	}}
+	for _, a := range m.Authors {
+		article.Authors = append(article.Authors, collapseSpaces(strings.Join([]string{a.Forenames, a.Keyname, a.Suffix}, " ")))
+	}
+	// created is the date of the first version, updated of the latest one if there are several
+	if t, err := time.Parse(oaiDateLayout, m.Created); err == nil {
+		article.SubmittedAt = utils.Uint64Time(t)
+		article.LatestVersionAt = article.SubmittedAt
+	}
+	if t, err := time.Parse(oaiDateLayout, m.Updated); err == nil {
+		article.LatestVersionAt = utils.Uint64Time(t)
+	}
+	article.LastUpdateTimestamp = article.LatestVersionAt
+	return crawledArticle{Article: article}
+}
+
+func (m *oaiArXivRaw) article() crawledArticle {
+	article := model.Article{ArticleMeta: model.ArticleMeta{
+		Id:         model.ArticleId(m.Id),
+		Title:      collapseSpaces(m.Title),
+		Abstract:   collapseSpaces(m.Abstract),
+		Categories: strings.Fields(m.Categories),
+		Comments:   collapseSpaces(m.Comments),
+		JournalRef: collapseSpaces(m.JournalRef),
+		DOI:        strings.TrimSpace(m.DOI),
+		License:    strings.TrimSpace(m.License),
+	}}
+	authors := strings.ReplaceAll(collapseSpaces(m.Authors), " and ", ", ")
+	for _, a := range strings.Split(authors, ",") {
+		if a = strings.TrimSpace(a); a != "" {
+			article.Authors = append(article.Authors, a)
+		}
+	}
+	var versions []model.ArticleVersion
+	for _, v := range m.Versions {
+		version, err := strconv.ParseUint(strings.TrimPrefix(v.Version, "v"), 10, 32)
+		if err != nil {
+			continue
+		}
+		versions = append(versions, model.ArticleVersion{
+			ArticleId:   article.Id,
+			Version:     uint32(version),
+			SubmittedAt: parseVersionDate(v.Date),
+		})
+	}
+	if len(versions) > 0 {
+		article.SubmittedAt = versions[0].SubmittedAt
+		article.LatestVersionAt = versions[len(versions)-1].SubmittedAt
+		article.LastUpdateTimestamp = article.LatestVersionAt
+	}
+	return crawledArticle{Article: article, Versions: withSnapshot(article, versions)}
+}
+
+// harvestStates stores where harvesting of lists stopped.
+type harvestStates interface {
+	load(cfg *OAIConfig) (harvestState, error)
+	save(cfg *OAIConfig, state harvestState) error
+}
+
+// dbHarvestStates keeps harvest states in the HarvestState table.
+type dbHarvestStates struct {
+	db *sql.DB
+}
+
+func (h dbHarvestStates) load(cfg *OAIConfig) (harvestState, error) {
+	var state harvestState
+	err := h.db.QueryRow("SELECT FromDatestamp, ResumptionToken FROM HarvestState WHERE BaseURL = $1 AND MetadataPrefix = $2 AND SetSpec = $3;",
+		cfg.BaseURL, cfg.MetadataPrefix, cfg.Set).Scan(&state.From, &state.ResumptionToken)
+	if err == sql.ErrNoRows {
+		return harvestState{}, nil
+	}
+	return state, err
+}
+
+func (h dbHarvestStates) save(cfg *OAIConfig, state harvestState) error {
+	_, err := h.db.Exec(`INSERT INTO HarvestState (BaseURL, MetadataPrefix, SetSpec, FromDatestamp, ResumptionToken, UpdatedAt)
+VALUES ($1, $2, $3, $4, $5, $6)
+ON CONFLICT (BaseURL, MetadataPrefix, SetSpec) DO UPDATE
+SET FromDatestamp = EXCLUDED.FromDatestamp, ResumptionToken = EXCLUDED.ResumptionToken, UpdatedAt = EXCLUDED.UpdatedAt;`,
+		cfg.BaseURL, cfg.MetadataPrefix, cfg.Set, state.From, state.ResumptionToken, utils.Uint64Time(time.Now()))
+	return err
+}
+
+func (cfg *OAIConfig) listRecordsURL(state harvestState) string {
+	v := url.Values{"verb": {"ListRecords"}}
+	if state.ResumptionToken != "" {
+		v.Set("resumptionToken", state.ResumptionToken)
+	} else {
+		v.Set("metadataPrefix", cfg.MetadataPrefix)
+		if state.From != "" {
+			v.Set("from", state.From)
+		}
+		if cfg.Set != "" {
+			v.Set("set", cfg.Set)
+		}
+	}
+	return cfg.BaseURL + "?" + v.Encode()
+}
+
+// fetchRecords requests a list page, waiting as long as the repository asks
+// with 503 and Retry-After.
+func (cfg *OAIConfig) fetchRecords(ctx context.Context, state harvestState) (*oaiResponse, error) {
+	client := cfg.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	for attempt := 0; ; attempt++ {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, cfg.listRecordsURL(state), nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("User-Agent", cfg.UserAgent)
+		resp, err := client.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode == http.StatusServiceUnavailable && attempt < oaiMaxRetries {
+			resp.Body.Close()
+			wait := oaiRetryAfter(resp.Header.Get("Retry-After"))
+			select {
+			case <-time.After(wait):
+				continue
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			io.Copy(io.Discard, resp.Body)
+			return nil, fmt.Errorf("unexpected status %s", resp.Status)
+		}
+		var r oaiResponse
+		if err := xml.NewDecoder(resp.Body).Decode(&r); err != nil {
+			return nil, err
+		}
+		return &r, nil
+	}
+}
+
+func oaiRetryAfter(header string) time.Duration {
+	seconds, err := strconv.Atoi(header)
+	if err != nil || seconds <= 0 {
+		return time.Minute
+	}
+	if wait := time.Duration(seconds) * time.Second; wait < oaiMaxRetryWait {
+		return wait
+	}
+	return oaiMaxRetryWait
+}
+
+// HarvestOAI harvests records changed since the previous harvest, resuming an
+// interrupted list if there is one. The state is saved after every page, so
+// harvesting continues where it stopped after a restart.
+func (c *Crawler) HarvestOAI(ctx context.Context, cfg OAIConfig) error {
+	return c.harvestOAI(ctx, cfg, dbHarvestStates{db: c.db})
+}
+
+func (c *Crawler) harvestOAI(ctx context.Context, cfg OAIConfig, states harvestStates) error {
+	fmt.Println("Harvesting", cfg.BaseURL, cfg.MetadataPrefix, cfg.Set)
+	if cfg.UserAgent == "" {
+		cfg.UserAgent = DefaultUserAgent
+	}
+	state, err := states.load(&cfg)
+	if err != nil {
+		return err
+	}
+	latest := state.From
+	for {
+		resp, err := cfg.fetchRecords(ctx, state)
+		if err != nil {
+			return err
+		}
+		if resp.Error != nil {
+			if resp.Error.Code == "noRecordsMatch" {
+				return nil
+			}
+			if resp.Error.Code == "badResumptionToken" && state.ResumptionToken != "" {
+				// expired token, start the list over
+				state.ResumptionToken = ""
+				if err := states.save(&cfg, state); err != nil {
+					return err
+				}
+				continue
+			}
+			return fmt.Errorf("OAI-PMH error %s: %s", resp.Error.Code, strings.TrimSpace(resp.Error.Message))
+		}
+		for i := range resp.Records {
+			record := &resp.Records[i]
+			if record.Header.Datestamp > latest {
+				latest = record.Header.Datestamp
+			}
+			if err := c.harvestRecord(&cfg, record); err != nil {
+				return err
+			}
+		}
+		state.ResumptionToken = strings.TrimSpace(resp.ResumptionToken)
+		if state.ResumptionToken == "" {
+			// the list is complete, the next one starts from the latest change seen
+			state.From = latest
+		}
+		if err := states.save(&cfg, state); err != nil {
+			return err
+		}
+		if state.ResumptionToken == "" {
+			return nil
+		}
+		select {
+		case <-time.After(cfg.RequestDelay):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func (c *Crawler) harvestRecord(cfg *OAIConfig, record *oaiRecord) error {
+	if record.Header.Status == "deleted" {
+		return nil
+	}
+	var article crawledArticle
+	switch {
+	case record.ArXiv != nil:
+		article = record.ArXiv.article()
+	case record.ArXivRaw != nil:
+		article = record.ArXivRaw.article()
+	default:
+		return nil
+	}
+	if article.Id == "" || article.Title == "" {
+		fmt.Fprintf(os.Stderr, "Skipping incomplete record %s\n", record.Header.Identifier)
+		return nil
+	}
+	if absURL, err := url.Parse(cfg.AbsURL + string(article.Id)); err == nil {
+		article.FullDocumentURL = *absURL
+	}
+	if article.LastUpdateTimestamp == 0 {
+		article.LastUpdateTimestamp = utils.Uint64Time(time.Now())
+	}
+	up, err := c.upsertArticle(article.Article, article.Versions)
+	if err != nil {
+		return err
+	}
+	if up {
+		fmt.Println("Upserted article", article.Id)
+	}
+	return nil
+}
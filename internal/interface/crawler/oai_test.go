@@ -0,0 +1,230 @@
+package crawler
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/mp-hl-2021/unarXiv/internal/domain/model"
+)
+
+// memoryHarvestStates keeps harvest states of lists in memory.
+type memoryHarvestStates struct {
+	mu     sync.Mutex
+	states map[string]harvestState
+}
+
+func newMemoryHarvestStates() *memoryHarvestStates {
+	return &memoryHarvestStates{states: make(map[string]harvestState)}
+}
+
+func harvestKey(cfg *OAIConfig) string {
+	return cfg.BaseURL + " " + cfg.MetadataPrefix + " " + cfg.Set
+}
+
+func (m *memoryHarvestStates) load(cfg *OAIConfig) (harvestState, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.states[harvestKey(cfg)], nil
+}
+
+func (m *memoryHarvestStates) save(cfg *OAIConfig, state harvestState) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.states[harvestKey(cfg)] = state
+	return nil
+}
+
+func oaiRecordXML(id, datestamp, title string) string {
+	return fmt.Sprintf(`<record>
+<header><identifier>oai:arXiv.org:%[1]s</identifier><datestamp>%[2]s</datestamp></header>
+<metadata><arXiv xmlns="http://arxiv.org/OAI/arXiv/">
+<id>%[1]s</id><created>2021-01-01</created>
+<authors><author><keyname>Turing</keyname><forenames>Alan</forenames></author></authors>
+<title>%[3]s</title><categories>cs.LG stat.ML</categories>
+<abstract>  Abstract of
+  %[3]s. </abstract>
+</arXiv></metadata>
+</record>`, id, datestamp, title)
+}
+
+func oaiDeletedRecordXML(id, datestamp string) string {
+	return fmt.Sprintf(`<record><header status="deleted"><identifier>oai:arXiv.org:%s</identifier><datestamp>%s</datestamp></header></record>`, id, datestamp)
+}
+
+func oaiListXML(resumptionToken string, records ...string) string {
+	return `<?xml version="1.0" encoding="UTF-8"?>
+<OAI-PMH xmlns="http://www.openarchives.org/OAI/2.0/"><ListRecords>` +
+		strings.Join(records, "\n") +
+		`<resumptionToken cursor="0">` + resumptionToken + `</resumptionToken></ListRecords></OAI-PMH>`
+}
+
+func oaiErrorXML(code string) string {
+	return `<?xml version="1.0" encoding="UTF-8"?>
+<OAI-PMH xmlns="http://www.openarchives.org/OAI/2.0/"><error code="` + code + `">Error ` + code + `</error></OAI-PMH>`
+}
+
+// oaiServer answers ListRecords requests by their query and records the
+// queries it received.
+type oaiServer struct {
+	*httptest.Server
+	mu        sync.Mutex
+	responses map[string]string
+	requests  []string
+}
+
+func newOAIServer(t *testing.T, responses map[string]string) *oaiServer {
+	s := &oaiServer{responses: responses}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		query.Del("verb")
+		key, _ := url.QueryUnescape(query.Encode())
+		s.mu.Lock()
+		s.requests = append(s.requests, key)
+		s.mu.Unlock()
+		response, ok := s.responses[key]
+		if !ok {
+			t.Errorf("unexpected request %s", r.URL)
+			response = oaiErrorXML("badArgument")
+		}
+		w.Header().Set("Content-Type", "text/xml")
+		fmt.Fprint(w, response)
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *oaiServer) takeRequests() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	requests := s.requests
+	s.requests = nil
+	return requests
+}
+
+func (s *oaiServer) config() OAIConfig {
+	return OAIConfig{
+		BaseURL:        s.URL,
+		MetadataPrefix: "arXiv",
+		Set:            "cs",
+		AbsURL:         "https://arxiv.org/abs/",
+		Client:         s.Client(),
+	}
+}
+
+func TestHarvestOAI(t *testing.T) {
+	server := newOAIServer(t, map[string]string{
+		"metadataPrefix=arXiv&set=cs": oaiListXML("token-1",
+			oaiRecordXML("2101.00001", "2021-01-03", "First"),
+			oaiRecordXML("2101.00002", "2021-01-02", "Second"),
+		),
+		"resumptionToken=token-1": oaiListXML("",
+			oaiRecordXML("2101.00003", "2021-01-04", "Third"),
+			oaiDeletedRecordXML("2101.00004", "2021-01-05"),
+		),
+		"from=2021-01-05&metadataPrefix=arXiv&set=cs": oaiListXML("",
+			oaiRecordXML("2101.00001", "2021-01-06", "First revised"),
+		),
+		"from=2021-01-06&metadataPrefix=arXiv&set=cs": oaiErrorXML("noRecordsMatch"),
+	})
+	articles := newMemoryArticles()
+	states := newMemoryHarvestStates()
+	c := &Crawler{articlesRepo: articles}
+	cfg := server.config()
+
+	if err := c.harvestOAI(context.Background(), cfg, states); err != nil {
+		t.Fatalf("harvestOAI() error = %v", err)
+	}
+	if got, want := server.takeRequests(), []string{"metadataPrefix=arXiv&set=cs", "resumptionToken=token-1"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("first harvest requests = %q, want %q", got, want)
+	}
+	if got, want := articles.ids(), []model.ArticleId{"2101.00001", "2101.00002", "2101.00003"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("harvested articles = %q, want %q", got, want)
+	}
+	article, _ := articles.ArticleById("2101.00001")
+	if article.Abstract != "Abstract of First." {
+		t.Errorf("Abstract = %q, want %q", article.Abstract, "Abstract of First.")
+	}
+	if !reflect.DeepEqual(article.Authors, []string{"Alan Turing"}) {
+		t.Errorf("Authors = %q, want %q", article.Authors, []string{"Alan Turing"})
+	}
+	if got := article.FullDocumentURL.String(); got != "https://arxiv.org/abs/2101.00001" {
+		t.Errorf("FullDocumentURL = %q, want %q", got, "https://arxiv.org/abs/2101.00001")
+	}
+	// deleted records count towards the datestamp the next list starts from
+	if got, want := states.states[harvestKey(&cfg)], (harvestState{From: "2021-01-05"}); got != want {
+		t.Errorf("saved state = %+v, want %+v", got, want)
+	}
+
+	if err := c.harvestOAI(context.Background(), cfg, states); err != nil {
+		t.Fatalf("second harvestOAI() error = %v", err)
+	}
+	if got, want := server.takeRequests(), []string{"from=2021-01-05&metadataPrefix=arXiv&set=cs"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("second harvest requests = %q, want %q", got, want)
+	}
+	article, _ = articles.ArticleById("2101.00001")
+	if article.Title != "First revised" {
+		t.Errorf("Title = %q, want %q", article.Title, "First revised")
+	}
+
+	if err := c.harvestOAI(context.Background(), cfg, states); err != nil {
+		t.Fatalf("harvestOAI() with no new records error = %v", err)
+	}
+	if got, want := server.takeRequests(), []string{"from=2021-01-06&metadataPrefix=arXiv&set=cs"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("third harvest requests = %q, want %q", got, want)
+	}
+	if got, want := states.states[harvestKey(&cfg)], (harvestState{From: "2021-01-06"}); got != want {
+		t.Errorf("state after noRecordsMatch = %+v, want %+v", got, want)
+	}
+}
+
+func TestHarvestOAIResumesInterruptedList(t *testing.T) {
+	server := newOAIServer(t, map[string]string{
+		"resumptionToken=token-2": oaiListXML("",
+			oaiRecordXML("2101.00003", "2021-01-04", "Third"),
+		),
+	})
+	states := newMemoryHarvestStates()
+	cfg := server.config()
+	states.save(&cfg, harvestState{From: "2021-01-01", ResumptionToken: "token-2"})
+	c := &Crawler{articlesRepo: newMemoryArticles()}
+
+	if err := c.harvestOAI(context.Background(), cfg, states); err != nil {
+		t.Fatalf("harvestOAI() error = %v", err)
+	}
+	if got, want := server.takeRequests(), []string{"resumptionToken=token-2"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("requests = %q, want %q", got, want)
+	}
+	if got, want := states.states[harvestKey(&cfg)], (harvestState{From: "2021-01-04"}); got != want {
+		t.Errorf("saved state = %+v, want %+v", got, want)
+	}
+}
+
+func TestHarvestOAIErrors(t *testing.T) {
+	server := newOAIServer(t, map[string]string{
+		"resumptionToken=expired":                     oaiErrorXML("badResumptionToken"),
+		"from=2021-01-01&metadataPrefix=arXiv&set=cs": oaiErrorXML("cannotDisseminateFormat"),
+	})
+	states := newMemoryHarvestStates()
+	cfg := server.config()
+	states.save(&cfg, harvestState{From: "2021-01-01", ResumptionToken: "expired"})
+	c := &Crawler{articlesRepo: newMemoryArticles()}
+
+	err := c.harvestOAI(context.Background(), cfg, states)
+	if err == nil || !strings.Contains(err.Error(), "cannotDisseminateFormat") {
+		t.Errorf("harvestOAI() error = %v, want cannotDisseminateFormat", err)
+	}
+	// an expired token starts the list over from the saved datestamp
+	if got, want := server.takeRequests(), []string{"resumptionToken=expired", "from=2021-01-01&metadataPrefix=arXiv&set=cs"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("requests = %q, want %q", got, want)
+	}
+	if got, want := states.states[harvestKey(&cfg)], (harvestState{From: "2021-01-01"}); got != want {
+		t.Errorf("saved state = %+v, want %+v", got, want)
+	}
+}
@@ -0,0 +1,265 @@
+package crawler
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+const (
+	robotsTTL = 24 * time.Hour
+	// robotsRetryTTL is how long a host is not crawled when its robots.txt can't be fetched.
+	robotsRetryTTL = 10 * time.Minute
+)
+
+var (
+	ErrDisallowedByRobots = fmt.Errorf("disallowed by robots.txt")
+	// ErrRobotsUnreachable is returned for URLs of a host whose robots.txt
+	// could not be fetched, until it is tried again after robotsRetryTTL.
+	ErrRobotsUnreachable = fmt.Errorf("robots.txt is unreachable")
+)
+
+type crawlDelayKey struct{}
+
+// withCrawlDelay makes requests with ctx wait at least delay between requests
+// to a host, if it is longer than the other delays.
+func withCrawlDelay(ctx context.Context, delay time.Duration) context.Context {
+	return context.WithValue(ctx, crawlDelayKey{}, delay)
+}
+
+// Politeness is the fetcher of live pages. It schedules requests of all
+// downloaders so that every host gets at most one request per crawl delay,
+// and only for URLs its robots.txt allows.
+type Politeness struct {
+	userAgent    string
+	client       *http.Client
+	defaultDelay time.Duration
+	slots        hostSlots
+
+	mu    sync.Mutex
+	hosts map[string]*hostState
+}
+
+// hostSlots is a token bucket per host, handing out one request slot per delay.
+// A slot may be taken right away after a pause of at least one delay.
+type hostSlots interface {
+	// reserve takes the next slot of host and returns how long to wait for it.
+	reserve(ctx context.Context, host string, delay time.Duration) (time.Duration, error)
+}
+
+// memoryHostSlots are slots of the hosts requested by this process.
+type memoryHostSlots struct {
+	mu sync.Mutex
+	// next is when the bucket of a host has a token, it may be in the past by
+	// at most one delay
+	next map[string]time.Time
+}
+
+func (s *memoryHostSlots) reserve(ctx context.Context, host string, delay time.Duration) (time.Duration, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	next := s.next[host]
+	if earliest := now.Add(-delay); next.Before(earliest) {
+		next = earliest
+	}
+	next = next.Add(delay)
+	s.next[host] = next
+	if wait := next.Sub(now); wait > 0 {
+		return wait, nil
+	}
+	return 0, nil
+}
+
+// reserveHostSlotQuery is the token bucket of memoryHostSlots kept in a row
+// per host, which is locked while it is updated. Times are of the database
+// clock, so that clocks of crawler processes don't need to agree.
+const reserveHostSlotQuery = `
+INSERT INTO CrawlHosts (Host, NextSlotAt) VALUES ($1, (extract(epoch FROM now()) * 1e9)::bigint)
+ON CONFLICT (Host) DO UPDATE
+SET NextSlotAt = GREATEST(CrawlHosts.NextSlotAt, EXCLUDED.NextSlotAt - $2) + $2
+RETURNING NextSlotAt - (extract(epoch FROM now()) * 1e9)::bigint;
+`
+
+// dbHostSlots are slots of hosts shared by all crawler processes using the database.
+type dbHostSlots struct {
+	db *sql.DB
+}
+
+func (s dbHostSlots) reserve(ctx context.Context, host string, delay time.Duration) (time.Duration, error) {
+	var wait int64
+	if err := s.db.QueryRowContext(ctx, reserveHostSlotQuery, host, int64(delay)).Scan(&wait); err != nil {
+		return 0, err
+	}
+	if wait > 0 {
+		return time.Duration(wait), nil
+	}
+	return 0, nil
+}
+
+type hostState struct {
+	// robotsMu is held while robots.txt is fetched, so that it is fetched once
+	robotsMu sync.Mutex
+	// robots are the rules of the host, nil with robotsErr if robots.txt was unreachable
+	robots    *robotsRules
+	robotsErr error
+	expiresAt time.Time
+}
+
+// NewPoliteness creates a scheduler sending requests with client, identified
+// by userAgent. Hosts without a Crawl-delay are requested once per defaultDelay.
+// Delays are only kept between requests of this process.
+func NewPoliteness(userAgent string, client *http.Client, defaultDelay time.Duration) *Politeness {
+	return newPoliteness(userAgent, client, defaultDelay, &memoryHostSlots{next: make(map[string]time.Time)})
+}
+
+// NewSharedPoliteness creates a scheduler like NewPoliteness, keeping delays
+// between requests of all crawler processes sharing db, so that replicas
+// don't multiply the request rate of a host.
+func NewSharedPoliteness(userAgent string, client *http.Client, defaultDelay time.Duration, db *sql.DB) *Politeness {
+	return newPoliteness(userAgent, client, defaultDelay, dbHostSlots{db: db})
+}
+
+func newPoliteness(userAgent string, client *http.Client, defaultDelay time.Duration, slots hostSlots) *Politeness {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &Politeness{
+		userAgent:    userAgent,
+		client:       client,
+		defaultDelay: defaultDelay,
+		slots:        slots,
+		hosts:        make(map[string]*hostState),
+	}
+}
+
+func (p *Politeness) UserAgent() string {
+	return p.userAgent
+}
+
+func hostKey(u *url.URL) string {
+	return u.Scheme + "://" + u.Host
+}
+
+func (p *Politeness) host(u *url.URL) *hostState {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	key := hostKey(u)
+	h, ok := p.hosts[key]
+	if !ok {
+		h = &hostState{}
+		p.hosts[key] = h
+	}
+	return h
+}
+
+func (p *Politeness) rules(ctx context.Context, u *url.URL, h *hostState) (*robotsRules, error) {
+	h.robotsMu.Lock()
+	defer h.robotsMu.Unlock()
+	if time.Now().Before(h.expiresAt) {
+		return h.robots, h.robotsErr
+	}
+	robots, ttl, err := p.fetchRobots(ctx, u)
+	if ctx.Err() != nil {
+		// a canceled fetch tells nothing about the host, the next one tries again
+		return nil, ctx.Err()
+	}
+	h.robots, h.robotsErr, h.expiresAt = robots, err, time.Now().Add(ttl)
+	return robots, err
+}
+
+// fetchRobots follows RFC 9309: a missing robots.txt allows everything, an
+// unreachable one disallows everything until it is tried again, which is
+// reported with ErrRobotsUnreachable rather than as a disallow rule.
+func (p *Politeness) fetchRobots(ctx context.Context, u *url.URL) (*robotsRules, time.Duration, error) {
+	robotsURL := url.URL{Scheme: u.Scheme, Host: u.Host, Path: "/robots.txt"}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, robotsURL.String(), nil)
+	if err != nil {
+		return nil, robotsRetryTTL, ErrRobotsUnreachable
+	}
+	req.Header.Set("User-Agent", p.userAgent)
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, robotsRetryTTL, ErrRobotsUnreachable
+	}
+	defer resp.Body.Close()
+	switch {
+	case resp.StatusCode == http.StatusOK:
+		return parseRobots(resp.Body, p.userAgent), robotsTTL, nil
+	case resp.StatusCode >= 400 && resp.StatusCode < 500:
+		return allowAll, robotsTTL, nil
+	default:
+		return nil, robotsRetryTTL, ErrRobotsUnreachable
+	}
+}
+
+// Wait blocks until a request to rawURL is polite, or returns ErrDisallowedByRobots,
+// or ErrRobotsUnreachable if it is not known yet whether the URL is allowed.
+func (p *Politeness) Wait(ctx context.Context, rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return err
+	}
+	h := p.host(u)
+	robots, err := p.rules(ctx, u, h)
+	if err == ErrRobotsUnreachable {
+		totalURLsBlocked.WithLabelValues("robots_unreachable").Inc()
+	}
+	if err != nil {
+		return err
+	}
+	path := u.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	if u.RawQuery != "" {
+		path += "?" + u.RawQuery
+	}
+	if !robots.allowed(path) {
+		totalURLsBlocked.WithLabelValues("robots").Inc()
+		return ErrDisallowedByRobots
+	}
+	delay := p.defaultDelay
+	if robots.crawlDelay > delay {
+		delay = robots.crawlDelay
+	}
+	if ctxDelay, ok := ctx.Value(crawlDelayKey{}).(time.Duration); ok && ctxDelay > delay {
+		delay = ctxDelay
+	}
+	wait, err := p.slots.reserve(ctx, hostKey(u), delay)
+	if err != nil {
+		return err
+	}
+	if wait == 0 {
+		return nil
+	}
+	totalURLsDeferred.Inc()
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Fetch requests rawURL once it is polite to, with additional header fields.
+func (p *Politeness) Fetch(ctx context.Context, rawURL string, header http.Header) (*http.Response, error) {
+	if err := p.Wait(ctx, rawURL); err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	for key, values := range header {
+		req.Header[key] = values
+	}
+	req.Header.Set("User-Agent", p.userAgent)
+	return p.client.Do(req)
+}
@@ -0,0 +1,99 @@
+package crawler
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func newRobotsServer(t *testing.T, robots func(w http.ResponseWriter)) (*httptest.Server, *int32) {
+	var fetches int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/robots.txt" {
+			atomic.AddInt32(&fetches, 1)
+			robots(w)
+			return
+		}
+		fmt.Fprint(w, "page")
+	}))
+	t.Cleanup(server.Close)
+	return server, &fetches
+}
+
+func TestPolitenessDisallowed(t *testing.T) {
+	server, _ := newRobotsServer(t, func(w http.ResponseWriter) {
+		fmt.Fprint(w, "User-agent: *\nDisallow: /private/\n")
+	})
+	p := NewPoliteness(DefaultUserAgent, server.Client(), 0)
+	if err := p.Wait(context.Background(), server.URL+"/private/page"); err != ErrDisallowedByRobots {
+		t.Errorf("Wait() of a disallowed URL error = %v, want %v", err, ErrDisallowedByRobots)
+	}
+	if err := p.Wait(context.Background(), server.URL+"/public/page"); err != nil {
+		t.Errorf("Wait() of an allowed URL error = %v, want nil", err)
+	}
+}
+
+func TestPolitenessRobotsUnreachable(t *testing.T) {
+	server, fetches := newRobotsServer(t, func(w http.ResponseWriter) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	})
+	p := NewPoliteness(DefaultUserAgent, server.Client(), 0)
+	for i := 0; i < 2; i++ {
+		if err := p.Wait(context.Background(), server.URL+"/page"); err != ErrRobotsUnreachable {
+			t.Errorf("Wait() error = %v, want %v", err, ErrRobotsUnreachable)
+		}
+	}
+	// the host is not asked again until robotsRetryTTL passes
+	if n := atomic.LoadInt32(fetches); n != 1 {
+		t.Errorf("robots.txt fetched %d times, want 1", n)
+	}
+}
+
+func TestPolitenessCanceledRobotsFetchIsNotCached(t *testing.T) {
+	release := make(chan struct{})
+	var once sync.Once
+	unblock := func() { once.Do(func() { close(release) }) }
+	defer unblock()
+	server, fetches := newRobotsServer(t, func(w http.ResponseWriter) {
+		<-release
+	})
+	p := NewPoliteness(DefaultUserAgent, server.Client(), 0)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := p.Wait(ctx, server.URL+"/page"); err != context.DeadlineExceeded {
+		t.Errorf("Wait() with a canceled context error = %v, want %v", err, context.DeadlineExceeded)
+	}
+	unblock()
+
+	// the next request fetches robots.txt again instead of reusing the canceled result
+	if err := p.Wait(context.Background(), server.URL+"/page"); err != nil {
+		t.Errorf("Wait() error = %v, want nil", err)
+	}
+	if n := atomic.LoadInt32(fetches); n != 2 {
+		t.Errorf("robots.txt fetched %d times, want 2", n)
+	}
+}
+
+func TestMemoryHostSlots(t *testing.T) {
+	const delay = time.Hour
+	s := &memoryHostSlots{next: make(map[string]time.Time)}
+	var waits []time.Duration
+	for _, host := range []string{"https://a", "https://a", "https://b", "https://a"} {
+		wait, err := s.reserve(context.Background(), host, delay)
+		if err != nil {
+			t.Fatalf("reserve() error = %v", err)
+		}
+		// rounded, as some time passes between reservations
+		waits = append(waits, wait.Round(time.Minute))
+	}
+	want := []time.Duration{0, delay, 0, 2 * delay}
+	if fmt.Sprint(waits) != fmt.Sprint(want) {
+		t.Errorf("reserve() waits = %v, want %v", waits, want)
+	}
+}
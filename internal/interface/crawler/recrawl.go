@@ -0,0 +1,87 @@
+package crawler
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/mp-hl-2021/unarXiv/internal/interface/utils"
+)
+
+const (
+	// An article page is recrawled after its interval has passed since the last
+	// visit. The interval halves when the article has changed and doubles when
+	// it hasn't, so that it follows how often the article changes.
+	initialRecrawlInterval = 24 * time.Hour
+	minRecrawlInterval     = 6 * time.Hour
+	maxRecrawlInterval     = 60 * 24 * time.Hour
+	// subscribedRecrawlFactor shortens intervals of articles someone is subscribed to.
+	subscribedRecrawlFactor = 4
+
+	recrawlCheckPeriod = time.Minute
+	recrawlBatch       = 100
+)
+
+// queuedURL is a URL to crawl with the validators of its last response, for
+// a conditional request.
+type queuedURL struct {
+	url          string
+	etag         string
+	lastModified string
+}
+
+// enqueueDueQuery puts article pages due for recrawling back to the queue,
+// subscribed ones first and with a higher priority.
+const enqueueDueQuery = `
+WITH Due AS (
+    SELECT c.URL, s.Subscribed
+    FROM CrawlStatus c
+    CROSS JOIN LATERAL (SELECT EXISTS (
+        SELECT 1 FROM Articles a JOIN AccountArticleRelations r ON r.ArticleId = a.Id
+        WHERE a.FullDocumentURL = c.URL AND r.IsSubscribed
+    )) AS s(Subscribed)
+    WHERE c.State = 'parsed' AND c.RecrawlInterval IS NOT NULL
+        AND c.LastAccess + c.RecrawlInterval / CASE WHEN s.Subscribed THEN $2 ELSE 1 END <= $1
+    ORDER BY s.Subscribed DESC, c.LastAccess
+    LIMIT $3
+)
+UPDATE CrawlStatus c SET State = 'queued', Priority = CASE WHEN Due.Subscribed THEN $4 ELSE $5 END
+FROM Due WHERE c.URL = Due.URL;
+`
+
+// scheduleRecrawls periodically enqueues article pages due for recrawling.
+func (c *Crawler) scheduleRecrawls(ctx context.Context) error {
+	ticker := time.NewTicker(recrawlCheckPeriod)
+	defer ticker.Stop()
+	for {
+		res, err := c.db.Exec(enqueueDueQuery, utils.Uint64Time(time.Now()), subscribedRecrawlFactor, recrawlBatch, subscribedPriority, articlePriority)
+		if err != nil {
+			return err
+		}
+		if n, err := res.RowsAffected(); err == nil && n > 0 {
+			fmt.Println("Enqueued", n, "articles for recrawling")
+			totalRecrawls.Add(float64(n))
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// recrawled adapts the recrawl interval of an article page to whether the
+// article has changed since the previous visit.
+// Failures are only logged, the page is then recrawled with the old interval.
+func (c *Crawler) recrawled(url string, changed bool) {
+	_, err := c.db.Exec(`UPDATE CrawlStatus SET RecrawlInterval = CASE
+    WHEN RecrawlInterval IS NULL THEN $2
+    WHEN $3 THEN GREATEST($4, RecrawlInterval / 2)
+    ELSE LEAST($5, RecrawlInterval * 2) END
+WHERE URL = $1;`,
+		url, int64(initialRecrawlInterval), changed, int64(minRecrawlInterval), int64(maxRecrawlInterval))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to reschedule %s: %v\n", url, err)
+	}
+}
@@ -0,0 +1,122 @@
+package crawler
+
+import (
+	"bufio"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// robotsRules are the rules of a robots.txt group that applies to the crawler.
+type robotsRules struct {
+	rules      []robotsRule
+	crawlDelay time.Duration
+}
+
+type robotsRule struct {
+	allow   bool
+	pattern string
+}
+
+var allowAll = &robotsRules{}
+
+// parseRobots reads the group of robots.txt for the product token of userAgent,
+// matched whole and case-insensitively, falling back to the group for "*".
+// Groups with several user agents and repeated groups for the same agent are
+// merged, as RFC 9309 requires.
+func parseRobots(r io.Reader, userAgent string) *robotsRules {
+	product := strings.ToLower(userAgent)
+	if i := strings.IndexAny(product, "/ "); i >= 0 {
+		product = product[:i]
+	}
+	var specific, general robotsRules
+	var foundSpecific bool
+	var current []*robotsRules
+	inAgents := false
+	scanner := bufio.NewScanner(io.LimitReader(r, 512<<10))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = line[:i]
+		}
+		colon := strings.IndexByte(line, ':')
+		if colon < 0 {
+			continue
+		}
+		key := strings.ToLower(strings.TrimSpace(line[:colon]))
+		value := strings.TrimSpace(line[colon+1:])
+		if key == "user-agent" {
+			if !inAgents {
+				current = nil
+				inAgents = true
+			}
+			agent := strings.ToLower(value)
+			switch {
+			case agent == "*":
+				current = append(current, &general)
+			case agent != "" && agent == product:
+				current = append(current, &specific)
+				foundSpecific = true
+			}
+			continue
+		}
+		inAgents = false
+		for _, group := range current {
+			switch key {
+			case "allow", "disallow":
+				if value != "" {
+					group.rules = append(group.rules, robotsRule{allow: key == "allow", pattern: value})
+				}
+			case "crawl-delay":
+				if seconds, err := strconv.ParseFloat(value, 64); err == nil && seconds > 0 {
+					group.crawlDelay = time.Duration(seconds * float64(time.Second))
+				}
+			}
+		}
+	}
+	if foundSpecific {
+		return &specific
+	}
+	return &general
+}
+
+// allowed reports whether a path with query may be crawled. The longest matching
+// rule wins, allow winning ties.
+func (r *robotsRules) allowed(path string) bool {
+	best, allow := -1, true
+	for _, rule := range r.rules {
+		if !robotsMatch(rule.pattern, path) {
+			continue
+		}
+		if len(rule.pattern) > best || len(rule.pattern) == best && rule.allow {
+			best, allow = len(rule.pattern), rule.allow
+		}
+	}
+	return allow
+}
+
+// robotsMatch matches a path against a pattern where "*" is any sequence of
+// characters and a trailing "$" anchors the end of the path.
+func robotsMatch(pattern, path string) bool {
+	anchored := strings.HasSuffix(pattern, "$")
+	if anchored {
+		pattern = pattern[:len(pattern)-1]
+	}
+	parts := strings.Split(pattern, "*")
+	if !strings.HasPrefix(path, parts[0]) {
+		return false
+	}
+	pos := len(parts[0])
+	for i, part := range parts[1:] {
+		if anchored && i == len(parts)-2 {
+			return strings.HasSuffix(path[pos:], part)
+		}
+		j := strings.Index(path[pos:], part)
+		if j < 0 {
+			return false
+		}
+		pos += j + len(part)
+	}
+	return !anchored || pos == len(path)
+}
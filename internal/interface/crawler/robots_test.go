@@ -0,0 +1,39 @@
+package crawler
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseRobotsMatchesProductToken(t *testing.T) {
+	robots := `User-agent: unarXiv
+Disallow: /prefix/
+
+User-agent: UNARXIV-Crawler
+Disallow: /exact/
+
+User-agent: unarXiv-crawler-bot
+Disallow: /longer/
+
+User-agent: *
+Disallow: /general/
+`
+	rules := parseRobots(strings.NewReader(robots), DefaultUserAgent)
+	tests := map[string]bool{
+		"/exact/page":   false,
+		"/prefix/page":  true,
+		"/longer/page":  true,
+		"/general/page": true,
+	}
+	for path, want := range tests {
+		if got := rules.allowed(path); got != want {
+			t.Errorf("allowed(%q) = %v, want %v", path, got, want)
+		}
+	}
+
+	// a group for a prefix of the product token is not one for the crawler
+	rules = parseRobots(strings.NewReader("User-agent: unarXiv\nDisallow: /\n\nUser-agent: *\nDisallow: /general/\n"), DefaultUserAgent)
+	if !rules.allowed("/page") || rules.allowed("/general/page") {
+		t.Errorf("rules = %+v, want the group for *", rules)
+	}
+}
@@ -0,0 +1,22 @@
+package crawler
+
+// A URL in CrawlStatus is in one of the states:
+//
+//	queued  - waiting to be claimed, maybe not before NextAttemptAt
+//	claimed - leased to a worker, which is downloading it
+//	fetched - downloaded by the leasing worker, which is parsing it
+//	parsed  - crawled, links and the article of the page are stored
+//	failed  - given up on, the URL is in CrawlFailures
+//
+// Workers move URLs they lease to parsed or failed, or back to queued to be
+// retried. Claimed and fetched URLs go back to queued when a worker stops
+// without crawling them or its leases expire, so no URL is lost. Parsed URLs
+// are queued again by the recrawl scheduler, failed ones by operators.
+
+// urlFetched records a successful response and its validators for the next
+// conditional request.
+func (c *Crawler) urlFetched(url, etag, lastModified string) error {
+	_, err := c.db.Exec(`UPDATE CrawlStatus SET State = 'fetched', ETag = NULLIF($3, ''), LastModified = NULLIF($4, '')
+WHERE URL = $1 AND LeasedBy = $2;`, url, c.workerId, etag, lastModified)
+	return err
+}
@@ -0,0 +1,92 @@
+package crawler
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/mp-hl-2021/unarXiv/internal/domain/model"
+	"github.com/mp-hl-2021/unarXiv/internal/interface/utils"
+)
+
+// versionDateLayout is how submission dates of versions are written, both on
+// abstract pages and in arXivRaw records.
+const versionDateLayout = "Mon, 2 Jan 2006 15:04:05 MST"
+
+// submissionHistoryRegexp matches entries of the submission history on an
+// abstract page such as "[v2] Mon, 4 Jan 2021 18:00:02 UTC (1,234 KB)".
+var submissionHistoryRegexp = regexp.MustCompile(`\[v([0-9]+)\]\s*([A-Z][a-z]{2}, [0-9]{1,2} [A-Z][a-z]{2} [0-9]{4} [0-9]{2}:[0-9]{2}:[0-9]{2} [A-Z]+)`)
+
+// crawledArticle is an article with its versions as far as the source tells.
+// URL is the crawled URL the article was found at, empty for API sources.
+type crawledArticle struct {
+	model.Article
+	Versions []model.ArticleVersion
+	URL      string
+}
+
+// withSnapshot returns versions where the latest one is recorded as the current
+// state of the article.
+func withSnapshot(article model.Article, versions []model.ArticleVersion) []model.ArticleVersion {
+	if len(versions) == 0 {
+		return nil
+	}
+	latest := &versions[len(versions)-1]
+	latest.Recorded = true
+	latest.Title = article.Title
+	latest.Abstract = article.Abstract
+	latest.Authors = article.Authors
+	latest.Comment = article.Comments
+	return versions
+}
+
+func parseVersionDate(date string) uint64 {
+	t, err := time.Parse(versionDateLayout, strings.TrimSpace(date))
+	if err != nil {
+		return 0
+	}
+	return utils.Uint64Time(t)
+}
+
+// parseSubmissionHistory extracts versions from an abstract page, oldest first.
+func (c *Crawler) parseSubmissionHistory(id model.ArticleId, dom *goquery.Document) []model.ArticleVersion {
+	var versions []model.ArticleVersion
+	history := dom.Find(".submission-history").Text()
+	for _, m := range submissionHistoryRegexp.FindAllStringSubmatch(history, -1) {
+		version, err := strconv.ParseUint(m[1], 10, 32)
+		if err != nil {
+			continue
+		}
+		versions = append(versions, model.ArticleVersion{
+			ArticleId:   id,
+			Version:     uint32(version),
+			SubmittedAt: parseVersionDate(m[2]),
+		})
+	}
+	return versions
+}
+
+// versionsChanged reports whether there are versions or a snapshot of the latest
+// one that are not stored yet.
+func (c *Crawler) versionsChanged(versions []model.ArticleVersion) (bool, error) {
+	if len(versions) == 0 {
+		return false, nil
+	}
+	stored, err := c.articlesRepo.ArticleVersions(versions[0].ArticleId)
+	if err != nil {
+		return false, err
+	}
+	known := make(map[uint32]bool, len(stored))
+	for _, v := range stored {
+		known[v.Version] = v.Recorded
+	}
+	for _, v := range versions {
+		recorded, ok := known[v.Version]
+		if !ok || v.Recorded && !recorded {
+			return true, nil
+		}
+	}
+	return false, nil
+}
@@ -13,13 +13,32 @@ var dummyArticle = model.ArticleMeta{
     Abstract:            "abstract",
     LastUpdateTimestamp: 0,
 }
+var dummyVersion = model.ArticleVersion{
+    ArticleId: "dummy",
+    Version:   1,
+    Recorded:  true,
+    Title:     "bunny",
+    Abstract:  "abstract",
+    Authors:   []string{"ya"},
+}
+var dummyUserArticle = model.UserArticleMeta{
+    ArticleMeta: dummyArticle,
+    Relation: &model.ArticleUserRelation{
+        Viewed:       true,
+        LastViewedAt: 293,
+        Subscribed:   true,
+    },
+}
 var dummyArticleSubscription = model.UserArticleSubscription{
     UserId:    "0",
     ArticleId: "dummy",
 }
+var dummySearchQuery = model.SearchQuery{
+    Query: "dummy",
+}
 var dummySearchSubscription = model.UserSearchSubscription{
     UserId: "0",
-    Query:  "dummy",
+    Query:  dummySearchQuery,
 }
 
 type DummyUsecases struct{}
@@ -42,17 +61,33 @@ func (d *DummyUsecases) AccessArticle(articleId model.ArticleId, userId *model.U
     }, nil
 }
 
+func (d *DummyUsecases) RelatedArticles(articleId model.ArticleId, limit uint32, userId *model.UserId) ([]model.RelatedArticle, error) {
+    return []model.RelatedArticle{{UserArticleMeta: dummyUserArticle, Score: 0.5}}, nil
+}
+
+func (d *DummyUsecases) ArticleVersions(articleId model.ArticleId) ([]model.ArticleVersion, error) {
+    return []model.ArticleVersion{dummyVersion}, nil
+}
+
+func (d *DummyUsecases) DiffArticleVersions(articleId model.ArticleId, from, to uint32) (model.VersionDiff, error) {
+    return dummyVersion.Diff(dummyVersion), nil
+}
+
+func (d *DummyUsecases) Suggest(prefix string, limit uint32) ([]model.Suggestion, error) {
+    return []model.Suggestion{{Text: dummySearchQuery.Query, Source: model.SuggestedQuery}}, nil
+}
+
 func (d *DummyUsecases) Search(query model.SearchQuery, userId *model.UserId) (model.SearchResult, error) {
     return model.SearchResult{
         TotalMatchesCount: 3,
-        Articles: []model.ArticleMeta{dummyArticle},
+        Articles: []model.SearchHit{{UserArticleMeta: dummyUserArticle}},
     }, nil
 }
 
-func (d *DummyUsecases) GetSearchHistory(id model.UserId) (model.UserSearchHistory, error) {
+func (d *DummyUsecases) GetSearchHistory(id model.UserId, page model.PageRequest) (model.UserSearchHistory, error) {
     return model.UserSearchHistory{
         UserId:  "0",
-        Queries: []string{"dummy"},
+        Queries: []model.SearchQuery{dummySearchQuery},
     }, nil
 }
 
@@ -60,10 +95,10 @@ func (d *DummyUsecases) ClearSearchHistory(id model.UserId) error {
     return nil
 }
 
-func (d *DummyUsecases) GetArticleHistory(id model.UserId) (model.UserArticleHistory, error) {
+func (d *DummyUsecases) GetArticleHistory(id model.UserId, page model.PageRequest) (model.UserArticleHistory, error) {
     return model.UserArticleHistory{
         UserId:   "0",
-        Articles: []model.ArticleMeta{dummyArticle},
+        Articles: []model.UserArticleMeta{dummyUserArticle},
     }, nil
 }
 
@@ -79,10 +114,10 @@ func (d *DummyUsecases) GetArticleLastAccess(userId model.UserId, articleId mode
 	}, nil
 }
 
-func (d *DummyUsecases) GetSearchLastAccess(userId model.UserId, query string) (model.UserSearchAccess, error) {
+func (d *DummyUsecases) GetSearchLastAccess(userId model.UserId, query model.SearchQuery) (model.UserSearchAccess, error) {
     return model.UserSearchAccess{
         UserId:    "0",
-        Query:     "dummy",
+        Query:     dummySearchQuery,
         Timestamp: 2394,
     }, nil
 }
@@ -99,30 +134,30 @@ func (d *DummyUsecases) CheckArticleSubscription(userId model.UserId, articleId
     return &dummyArticleSubscription, nil
 }
 
-func (d *DummyUsecases) GetArticleSubscriptions(userId model.UserId) ([]model.UserArticleSubscription, error) {
-    return []model.UserArticleSubscription{dummyArticleSubscription}, nil
+func (d *DummyUsecases) GetArticleSubscriptions(userId model.UserId, page model.PageRequest) ([]model.UserArticleSubscription, model.PageKey, error) {
+    return []model.UserArticleSubscription{dummyArticleSubscription}, nil, nil
 }
 
-func (d *DummyUsecases) GetArticleUpdates(userId model.UserId) ([]model.ArticleMeta, error) {
-    return []model.ArticleMeta{dummyArticle}, nil
+func (d *DummyUsecases) GetArticleUpdates(userId model.UserId, page model.PageRequest) ([]model.UserArticleMeta, model.PageKey, error) {
+    return []model.UserArticleMeta{dummyUserArticle}, nil, nil
 }
 
-func (d *DummyUsecases) SubscribeForSearch(userId model.UserId, query string) (model.UserSearchSubscription, error) {
+func (d *DummyUsecases) SubscribeForSearch(userId model.UserId, query model.SearchQuery) (model.UserSearchSubscription, error) {
     return dummySearchSubscription, nil
 }
 
-func (d *DummyUsecases) UnsubscribeFromSearch(userId model.UserId, query string) error {
+func (d *DummyUsecases) UnsubscribeFromSearch(userId model.UserId, query model.SearchQuery) error {
     return nil
 }
 
-func (d *DummyUsecases) CheckSearchSubscription(userId model.UserId, query string) (*model.UserSearchSubscription, error) {
+func (d *DummyUsecases) CheckSearchSubscription(userId model.UserId, query model.SearchQuery) (*model.UserSearchSubscription, error) {
     return &dummySearchSubscription, nil
 }
 
-func (d *DummyUsecases) GetSearchSubscriptions(userId model.UserId) ([]model.UserSearchSubscription, error) {
-    return []model.UserSearchSubscription{dummySearchSubscription}, nil
+func (d *DummyUsecases) GetSearchSubscriptions(userId model.UserId, page model.PageRequest) ([]model.UserSearchSubscription, model.PageKey, error) {
+    return []model.UserSearchSubscription{dummySearchSubscription}, nil, nil
 }
 
-func (d *DummyUsecases) GetSearchUpdates(userId model.UserId) ([]string, error) {
-    return []string{"dummy"}, nil
+func (d *DummyUsecases) GetSearchUpdates(userId model.UserId, page model.PageRequest) ([]model.SearchQuery, model.PageKey, error) {
+    return []model.SearchQuery{dummySearchQuery}, nil, nil
 }
@@ -0,0 +1,117 @@
+package httpapi
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/mp-hl-2021/unarXiv/internal/domain/model"
+)
+
+var errInvalidCursor = errors.New("invalid cursor")
+
+// cursorCodec turns page keys into opaque tokens signed with a server secret,
+// so that clients can neither read nor forge them.
+type cursorCodec struct {
+	secret []byte
+}
+
+type cursorPayload struct {
+	// Scope binds a cursor to the list it was issued for.
+	Scope string   `json:"s"`
+	Key   []string `json:"k"`
+}
+
+func (c cursorCodec) sign(payload []byte) []byte {
+	mac := hmac.New(sha256.New, c.secret)
+	mac.Write(payload)
+	return mac.Sum(nil)
+}
+
+// encode returns an empty cursor for an empty key, i.e. on the last page.
+func (c cursorCodec) encode(scope string, key model.PageKey) string {
+	if len(key) == 0 {
+		return ""
+	}
+	payload, err := json.Marshal(cursorPayload{Scope: scope, Key: key})
+	if err != nil {
+		panic(err) // strings always marshal
+	}
+	return base64.RawURLEncoding.EncodeToString(payload) + "." + base64.RawURLEncoding.EncodeToString(c.sign(payload))
+}
+
+func (c cursorCodec) decode(scope string, cursor string) (model.PageKey, error) {
+	parts := strings.Split(cursor, ".")
+	if len(parts) != 2 {
+		return nil, errInvalidCursor
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, errInvalidCursor
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil || !hmac.Equal(signature, c.sign(payload)) {
+		return nil, errInvalidCursor
+	}
+	var p cursorPayload
+	if err := json.Unmarshal(payload, &p); err != nil || p.Scope != scope || len(p.Key) == 0 {
+		return nil, errInvalidCursor
+	}
+	return p.Key, nil
+}
+
+// unscopedParams only change how a page is presented or which page it is, all
+// other params select the list. Offset only applies to the first page, so the
+// next ones are requested with a cursor alone.
+var unscopedParams = map[string]bool{
+	"limit":               true,
+	"cursor":              true,
+	"offset":              true,
+	"highlight":           true,
+	"highlight_start":     true,
+	"highlight_stop":      true,
+	"highlight_fragments": true,
+}
+
+// cursorScope identifies the list a request pages through: the path, which
+// includes the search query, and the params, such as the sort order, which
+// defines the key format, and the filters. Params are sorted by name.
+func cursorScope(r *http.Request) string {
+	params := url.Values{}
+	for name, values := range r.Form {
+		if !unscopedParams[name] {
+			params[name] = values
+		}
+	}
+	return r.URL.Path + "?" + params.Encode()
+}
+
+// pageFromRequest reads optional "limit" and "cursor" params. Form must be already parsed.
+func (a *HttpApi) pageFromRequest(r *http.Request) (model.PageRequest, error) {
+	var page model.PageRequest
+	if s := r.Form.Get("limit"); s != "" {
+		limit, err := strconv.ParseUint(s, 10, 32)
+		if err != nil {
+			return model.PageRequest{}, err
+		}
+		page.Limit = uint32(limit)
+	}
+	if s := r.Form.Get("cursor"); s != "" {
+		key, err := a.cursors.decode(cursorScope(r), s)
+		if err != nil {
+			return model.PageRequest{}, err
+		}
+		page.After = key
+	}
+	return page, nil
+}
+
+func (a *HttpApi) nextCursor(r *http.Request, next model.PageKey) string {
+	return a.cursors.encode(cursorScope(r), next)
+}
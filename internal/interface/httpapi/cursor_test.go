@@ -0,0 +1,67 @@
+package httpapi
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/mp-hl-2021/unarXiv/internal/domain/model"
+)
+
+func newSearchRequest(t *testing.T, target string) *http.Request {
+	r := httptest.NewRequest(http.MethodGet, target, nil)
+	if err := r.ParseForm(); err != nil {
+		t.Fatal(err)
+	}
+	return mux.SetURLVars(r, map[string]string{"query": "transformer"})
+}
+
+func TestCursorScope(t *testing.T) {
+	a := New(nil, []byte("secret"))
+	key := model.PageKey{"0.5", "2101.00001"}
+	first := newSearchRequest(t, "/search/transformer?sort=newest&category=cs.LG&offset=20&limit=10&highlight=true")
+	cursor := a.nextCursor(first, key)
+
+	tests := []struct {
+		name   string
+		target string
+		valid  bool
+	}{
+		{name: "same list", target: "/search/transformer?sort=newest&category=cs.LG&cursor=" + cursor, valid: true},
+		{name: "another limit and highlighting", target: "/search/transformer?category=cs.LG&sort=newest&limit=50&cursor=" + cursor, valid: true},
+		{name: "another filter", target: "/search/transformer?sort=newest&category=cs.CL&cursor=" + cursor},
+		{name: "no filter", target: "/search/transformer?sort=newest&cursor=" + cursor},
+		{name: "another sort order", target: "/search/transformer?sort=relevance&category=cs.LG&cursor=" + cursor},
+		{name: "another query", target: "/search/attention?sort=newest&category=cs.LG&cursor=" + cursor},
+		{name: "tampered", target: "/search/transformer?sort=newest&category=cs.LG&cursor=x" + cursor},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			page, err := a.pageFromRequest(newSearchRequest(t, tt.target))
+			if !tt.valid {
+				if err != errInvalidCursor {
+					t.Errorf("pageFromRequest() error = %v, want %v", err, errInvalidCursor)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("pageFromRequest() error = %v", err)
+			}
+			if !reflect.DeepEqual(page.After, key) {
+				t.Errorf("page.After = %v, want %v", page.After, key)
+			}
+		})
+	}
+}
+
+func TestSearchRejectsOffsetWithCursor(t *testing.T) {
+	a := New(nil, []byte("secret"))
+	cursor := a.nextCursor(newSearchRequest(t, "/search/transformer?offset=20"), model.PageKey{"0.5", "2101.00001"})
+	w := httptest.NewRecorder()
+	a.getSearch(w, newSearchRequest(t, "/search/transformer?offset=20&cursor="+cursor))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusBadRequest)
+	}
+}
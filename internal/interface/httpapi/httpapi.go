@@ -2,25 +2,35 @@ package httpapi
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/gorilla/mux"
+	"github.com/mp-hl-2021/unarXiv/internal/domain"
 	"github.com/mp-hl-2021/unarXiv/internal/domain/model"
+	"github.com/mp-hl-2021/unarXiv/internal/domain/searchquery"
 	"github.com/mp-hl-2021/unarXiv/internal/interface/prom"
+	"github.com/mp-hl-2021/unarXiv/internal/interface/utils"
 	"github.com/mp-hl-2021/unarXiv/internal/usecases"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"log"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
 	//"github.com/dgrijalva/jwt-go"
 )
 
 type HttpApi struct {
 	usecases usecases.Interface
+	cursors  cursorCodec
 }
 
-func New(usecases usecases.Interface) *HttpApi {
+// New creates the API. cursorSecret signs pagination cursors, cursors issued
+// with another secret are rejected.
+func New(usecases usecases.Interface, cursorSecret []byte) *HttpApi {
 	return &HttpApi{
 		usecases: usecases,
+		cursors:  cursorCodec{secret: cursorSecret},
 	}
 }
 
@@ -37,10 +47,24 @@ func (a *HttpApi) Router() http.Handler {
 	router.HandleFunc("/register", a.postRegister).Methods(http.MethodPost)
 	router.HandleFunc("/login", a.postLogin).Methods(http.MethodPost)
 
-	// offset is optional, should be passed as "?offset=smth"
+	// offset is optional, should be passed as "?offset=smth", and skips results
+	// of the first page only, it can't be combined with a cursor
+	// query syntax is described in searchquery.Parse
+	// filters, sort order and matching of full texts are optional, see searchQueryFromRequest
+	// highlighting is enabled with "?highlight=true", see highlightOptionsFromForm
+	// facet counts are requested with "?facets=authors,categories,years"
+	// lists are paged with optional "?limit=n&cursor=next_cursor", see pageFromRequest
 	router.Path("/search/{query}").HandlerFunc(a.extractAuth(a.getSearch)).Methods(http.MethodGet)
 
+	// completions of a partially typed query, "?prefix=smth&limit=n"
+	router.HandleFunc("/suggest", a.getSuggestions).Methods(http.MethodGet)
+
 	router.HandleFunc("/articles/{articleId}", a.extractAuth(a.getArticle)).Methods(http.MethodGet)
+	// number of related articles is optional, should be passed as "?limit=n"
+	router.HandleFunc("/articles/{articleId}/related", a.extractAuth(a.getRelatedArticles)).Methods(http.MethodGet)
+	router.HandleFunc("/articles/{articleId}/versions", a.getArticleVersions).Methods(http.MethodGet)
+	// versions to compare are optional, "?from=1&to=3", the latest two recorded ones by default
+	router.HandleFunc("/articles/{articleId}/versions/diff", a.getArticleVersionsDiff).Methods(http.MethodGet)
 
 	router.HandleFunc("/history/searches", a.extractAuth(a.getSearchHistory)).Methods(http.MethodGet)
 	router.HandleFunc("/history/articles", a.extractAuth(a.getArticlesHistory)).Methods(http.MethodGet)
@@ -48,6 +72,9 @@ func (a *HttpApi) Router() http.Handler {
 	router.HandleFunc("/updates/searches", a.extractAuth(a.getSearchQueriesUpdates)).Methods(http.MethodGet)
 	router.HandleFunc("/updates/articles", a.extractAuth(a.getArticlesUpdates)).Methods(http.MethodGet)
 
+	router.HandleFunc("/subscriptions/articles", a.extractAuth(a.getArticleSubscriptions)).Methods(http.MethodGet)
+	router.HandleFunc("/subscriptions/searches", a.extractAuth(a.getSearchSubscriptions)).Methods(http.MethodGet)
+
 	router.Path("/subscriptions/articles/{articleId}").
 		HandlerFunc(a.extractAuth(a.getArticleSubscriptionStatus)).Methods(http.MethodGet)
 	router.Path("/subscriptions/articles/{articleId}").
@@ -87,6 +114,18 @@ func respondWithJSON(w http.ResponseWriter, object interface{}, status int) erro
 	return nil
 }
 
+// respondWithQueryError responds with 400 and reports true if err is a malformed search query.
+func respondWithQueryError(w http.ResponseWriter, err error) bool {
+	var parseErr *searchquery.ParseError
+	if !errors.As(err, &parseErr) {
+		return false
+	}
+	if err := respondWithJSON(w, renderQueryError(parseErr), http.StatusBadRequest); err != nil {
+		log.Printf("Error happened while responding with a query error: %v", err)
+	}
+	return true
+}
+
 func userIdFromRequest(r *http.Request) (model.UserId, bool) {
 	userId, ok := r.Context().Value(contextKeyUserId).(model.UserId)
 	if userId == "" {
@@ -149,31 +188,163 @@ func (a *HttpApi) postLogin(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-func (a *HttpApi) getSearch(w http.ResponseWriter, r *http.Request) {
+// parseTimestamp accepts a date, an RFC 3339 time or nanoseconds since epoch as used in responses.
+func parseTimestamp(s string) (uint64, error) {
+	if ts, err := strconv.ParseUint(s, 10, 64); err == nil {
+		return ts, nil
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return utils.Uint64Time(t), nil
+	}
+	t, err := time.Parse("2006-01-02", s)
+	if err != nil {
+		return 0, err
+	}
+	return utils.Uint64Time(t), nil
+}
+
+// searchQueryFromRequest extracts the query from the path and its filters and sort order from the form:
+// updated_after, updated_before, author, category and sort (relevance, newest, oldest or title).
+func searchQueryFromRequest(r *http.Request) (model.SearchQuery, error) {
 	if err := r.ParseForm(); err != nil {
+		return model.SearchQuery{}, err
+	}
+	query := model.SearchQuery{
+		Query: mux.Vars(r)["query"],
+		Filters: model.SearchFilters{
+			Author:   r.Form.Get("author"),
+			Category: r.Form.Get("category"),
+		},
+		SortOrder: model.SearchSortOrder(r.Form.Get("sort")),
+	}
+	if !query.SortOrder.IsValid() {
+		return model.SearchQuery{}, fmt.Errorf("unknown sort order %q", query.SortOrder)
+	}
+	var err error
+	if s := r.Form.Get("updated_after"); s != "" {
+		if query.Filters.UpdatedAfter, err = parseTimestamp(s); err != nil {
+			return model.SearchQuery{}, err
+		}
+	}
+	if s := r.Form.Get("updated_before"); s != "" {
+		if query.Filters.UpdatedBefore, err = parseTimestamp(s); err != nil {
+			return model.SearchQuery{}, err
+		}
+	}
+	if s := r.Form.Get("include_body"); s != "" {
+		if query.IncludeBody, err = strconv.ParseBool(s); err != nil {
+			return model.SearchQuery{}, err
+		}
+	}
+	return query, nil
+}
+
+const (
+	defaultHighlightStartSel     = "<b>"
+	defaultHighlightStopSel      = "</b>"
+	defaultHighlightMaxFragments = 3
+	maxHighlightFragments        = 10
+)
+
+// highlightOptionsFromForm reads highlight=true and optional highlight_start,
+// highlight_stop and highlight_fragments. Form must be already parsed.
+func highlightOptionsFromForm(r *http.Request) (*model.HighlightOptions, error) {
+	if enabled, _ := strconv.ParseBool(r.Form.Get("highlight")); !enabled {
+		return nil, nil
+	}
+	opts := &model.HighlightOptions{
+		StartSel:     defaultHighlightStartSel,
+		StopSel:      defaultHighlightStopSel,
+		MaxFragments: defaultHighlightMaxFragments,
+	}
+	if s := r.Form.Get("highlight_start"); s != "" {
+		opts.StartSel = s
+	}
+	if s := r.Form.Get("highlight_stop"); s != "" {
+		opts.StopSel = s
+	}
+	if strings.ContainsRune(opts.StartSel+opts.StopSel, '"') {
+		return nil, errors.New("highlight markers must not contain '\"'")
+	}
+	if s := r.Form.Get("highlight_fragments"); s != "" {
+		n, err := strconv.ParseUint(s, 10, 32)
+		if err != nil {
+			return nil, err
+		}
+		if n > maxHighlightFragments {
+			n = maxHighlightFragments
+		}
+		opts.MaxFragments = uint32(n)
+	}
+	return opts, nil
+}
+
+// facetsFromForm reads a comma-separated list of facets, e.g. "facets=authors,years".
+// Form must be already parsed.
+func facetsFromForm(r *http.Request) ([]model.SearchFacet, error) {
+	s := r.Form.Get("facets")
+	if s == "" {
+		return nil, nil
+	}
+	var facets []model.SearchFacet
+	for _, name := range strings.Split(s, ",") {
+		facet := model.SearchFacet(strings.TrimSpace(name))
+		if !facet.IsValid() {
+			return nil, fmt.Errorf("unknown facet %q", facet)
+		}
+		facets = append(facets, facet)
+	}
+	return facets, nil
+}
+
+func (a *HttpApi) getSearch(w http.ResponseWriter, r *http.Request) {
+	searchQueryRequest, err := searchQueryFromRequest(r)
+	if err != nil {
 		w.WriteHeader(http.StatusBadRequest)
-		log.Printf("Error happened while parsing form params: %v", err)
+		log.Printf("Error happened while parsing search params: %v", err)
 		return
 	}
-	var searchQueryRequest = model.SearchQuery{}
-	searchQueryRequest.Query = mux.Vars(r)["query"]
 	if strOffset := r.Form.Get("offset"); len(strOffset) != 0 {
 		offset, err := strconv.Atoi(strOffset)
 		if err != nil || offset < 0 {
 			w.WriteHeader(http.StatusBadRequest)
 			return
 		}
+		if r.Form.Get("cursor") != "" {
+			// the cursor already points past the skipped results
+			w.WriteHeader(http.StatusBadRequest)
+			log.Printf("Error happened while parsing search params: offset given with a cursor")
+			return
+		}
 		searchQueryRequest.Offset = uint32(offset)
 	}
+	if searchQueryRequest.Highlight, err = highlightOptionsFromForm(r); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		log.Printf("Error happened while parsing highlight params: %v", err)
+		return
+	}
+	if searchQueryRequest.Facets, err = facetsFromForm(r); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		log.Printf("Error happened while parsing facets: %v", err)
+		return
+	}
+	if searchQueryRequest.Page, err = a.pageFromRequest(r); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		log.Printf("Error happened while parsing page params: %v", err)
+		return
+	}
 
 	result, err := a.usecases.Search(searchQueryRequest, userIdPtrFromRequest(r))
+	if respondWithQueryError(w, err) {
+		return
+	}
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
+		w.WriteHeader(pagedErrorStatus(err))
 		log.Printf("Error happened in usecases.Search: %v", err)
 		return
 	}
 
-	if err := respondWithJSON(w, renderSearchResults(result), http.StatusOK); err != nil {
+	if err := respondWithJSON(w, renderSearchResults(result, a.nextCursor(r, result.Next)), http.StatusOK); err != nil {
 		log.Printf("Error happened while responding to GetSearch: %v", err)
 	}
 }
@@ -194,15 +365,153 @@ func (a *HttpApi) getArticle(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-func (a *HttpApi) getArticlesHistory(w http.ResponseWriter, r *http.Request) {
-	result, err := a.usecases.GetArticleHistory("0") // TODO extract auth from headers
+func (a *HttpApi) getSuggestions(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	var limit uint64
+	if s := query.Get("limit"); s != "" {
+		var err error
+		if limit, err = strconv.ParseUint(s, 10, 32); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			log.Printf("Error happened while parsing limit: %v", err)
+			return
+		}
+	}
+
+	result, err := a.usecases.Suggest(query.Get("prefix"), uint32(limit))
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		log.Printf("Error happened in usecases.Suggest: %v", err)
+		return
+	}
+
+	if err := respondWithJSON(w, renderSuggestions(result), http.StatusOK); err != nil {
+		log.Printf("Error happened while responding to GetSuggestions: %v", err)
+	}
+}
+
+func (a *HttpApi) getRelatedArticles(w http.ResponseWriter, r *http.Request) {
+	articleId := model.ArticleId(mux.Vars(r)["articleId"])
+
+	var limit uint64
+	if s := r.URL.Query().Get("limit"); s != "" {
+		var err error
+		if limit, err = strconv.ParseUint(s, 10, 32); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			log.Printf("Error happened while parsing limit: %v", err)
+			return
+		}
+	}
+
+	result, err := a.usecases.RelatedArticles(articleId, uint32(limit), userIdPtrFromRequest(r))
+	if err == domain.ArticleNotFound {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		log.Printf("Error happened in usecases.RelatedArticles: %v", err)
+		return
+	}
+
+	if err := respondWithJSON(w, renderRelatedArticles(result), http.StatusOK); err != nil {
+		log.Printf("Error happened while responding to GetRelatedArticles: %v", err)
+	}
+}
+
+func (a *HttpApi) getArticleVersions(w http.ResponseWriter, r *http.Request) {
+	articleId := model.ArticleId(mux.Vars(r)["articleId"])
+
+	result, err := a.usecases.ArticleVersions(articleId)
+	if err == domain.ArticleNotFound {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
+		log.Printf("Error happened in usecases.ArticleVersions: %v", err)
+		return
+	}
+
+	if err := respondWithJSON(w, renderArticleVersions(articleId, result), http.StatusOK); err != nil {
+		log.Printf("Error happened while responding to GetArticleVersions: %v", err)
+	}
+}
+
+func (a *HttpApi) getArticleVersionsDiff(w http.ResponseWriter, r *http.Request) {
+	articleId := model.ArticleId(mux.Vars(r)["articleId"])
+
+	var versions [2]uint64
+	for i, name := range []string{"from", "to"} {
+		if s := r.URL.Query().Get(name); s != "" {
+			var err error
+			if versions[i], err = strconv.ParseUint(strings.TrimPrefix(s, "v"), 10, 32); err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				log.Printf("Error happened while parsing %s: %v", name, err)
+				return
+			}
+		}
+	}
+
+	result, err := a.usecases.DiffArticleVersions(articleId, uint32(versions[0]), uint32(versions[1]))
+	if err == domain.ArticleNotFound || err == domain.VersionNotFound || err == domain.VersionNotRecorded {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		log.Printf("Error happened in usecases.DiffArticleVersions: %v", err)
+		return
+	}
+
+	if err := respondWithJSON(w, renderVersionDiff(result), http.StatusOK); err != nil {
+		log.Printf("Error happened while responding to GetArticleVersionsDiff: %v", err)
+	}
+}
+
+// pagedErrorStatus treats a page key the storage can't continue from as a client error.
+func pagedErrorStatus(err error) int {
+	if err == domain.InvalidPageKey {
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
+
+// parsePage reads page params and responds with 400 if they are malformed.
+func (a *HttpApi) parsePage(w http.ResponseWriter, r *http.Request) (model.PageRequest, bool) {
+	err := r.ParseForm()
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		log.Printf("Error happened while parsing form params: %v", err)
+		return model.PageRequest{}, false
+	}
+	page, err := a.pageFromRequest(r)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		log.Printf("Error happened while parsing page params: %v", err)
+		return model.PageRequest{}, false
+	}
+	return page, true
+}
+
+func (a *HttpApi) getArticlesHistory(w http.ResponseWriter, r *http.Request) {
+	userId, ok := userIdFromRequest(r)
+	if !ok {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	page, ok := a.parsePage(w, r)
+	if !ok {
+		return
+	}
+
+	result, err := a.usecases.GetArticleHistory(userId, page)
+	if err != nil {
+		w.WriteHeader(pagedErrorStatus(err))
 		log.Printf("Error happened in usecases.GetArticlesHistory: %v", err)
 		return
 	}
 
-	if err := respondWithJSON(w, renderUserArticleHistory(result), http.StatusOK); err != nil {
+	if err := respondWithJSON(w, renderUserArticleHistory(result, a.nextCursor(r, result.Next)), http.StatusOK); err != nil {
 		log.Printf("Error happened while responding to GetArticlesHistory: %v", err)
 	}
 }
@@ -213,15 +522,19 @@ func (a *HttpApi) getSearchHistory(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusUnauthorized)
 		return
 	}
+	page, ok := a.parsePage(w, r)
+	if !ok {
+		return
+	}
 
-	result, err := a.usecases.GetSearchHistory(userId)
+	result, err := a.usecases.GetSearchHistory(userId, page)
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
+		w.WriteHeader(pagedErrorStatus(err))
 		log.Printf("Error happened in usecases.GetSearchHistory: %v", err)
 		return
 	}
 
-	if err := respondWithJSON(w, renderUserSearchHistory(result), http.StatusOK); err != nil {
+	if err := respondWithJSON(w, renderUserSearchHistory(result, a.nextCursor(r, result.Next)), http.StatusOK); err != nil {
 		log.Printf("Error happened while responding to GetSearchHistory: %v", err)
 	}
 }
@@ -232,15 +545,19 @@ func (a *HttpApi) getSearchQueriesUpdates(w http.ResponseWriter, r *http.Request
 		w.WriteHeader(http.StatusUnauthorized)
 		return
 	}
+	page, ok := a.parsePage(w, r)
+	if !ok {
+		return
+	}
 
-	response, err := a.usecases.GetSearchUpdates(userId)
+	result, next, err := a.usecases.GetSearchUpdates(userId, page)
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
+		w.WriteHeader(pagedErrorStatus(err))
 		log.Printf("Error happened in usecases.GetSearchQueriesUpdates: %v", err)
 		return
 	}
 
-	if err := respondWithJSON(w, response, http.StatusOK); err != nil {
+	if err := respondWithJSON(w, renderSearchQueries(result, a.nextCursor(r, next)), http.StatusOK); err != nil {
 		log.Printf("Error happened while responding to GetSearchQueriesUpdates: %v", err)
 	}
 }
@@ -251,21 +568,66 @@ func (a *HttpApi) getArticlesUpdates(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusUnauthorized)
 		return
 	}
+	page, ok := a.parsePage(w, r)
+	if !ok {
+		return
+	}
 
-	result, err := a.usecases.GetArticleUpdates(userId)
+	result, next, err := a.usecases.GetArticleUpdates(userId, page)
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
+		w.WriteHeader(pagedErrorStatus(err))
 		log.Printf("Error happened in usecases.GetArticlesUpdates: %v", err)
 		return
 	}
 
-	response := make([]ArticleMetaResponse, len(result))
-	for i := range result {
-		response[i] = renderArticleMeta(result[i])
+	if err := respondWithJSON(w, renderArticleMetas(result, a.nextCursor(r, next)), http.StatusOK); err != nil {
+		log.Printf("Error happened while responding to GetArticlesUpdates: %v", err)
 	}
+}
 
-	if err := respondWithJSON(w, response, http.StatusOK); err != nil {
-		log.Printf("Error happened while responding to GetArticlesUpdates: %v", err)
+func (a *HttpApi) getArticleSubscriptions(w http.ResponseWriter, r *http.Request) {
+	userId, ok := userIdFromRequest(r)
+	if !ok {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	page, ok := a.parsePage(w, r)
+	if !ok {
+		return
+	}
+
+	result, next, err := a.usecases.GetArticleSubscriptions(userId, page)
+	if err != nil {
+		w.WriteHeader(pagedErrorStatus(err))
+		log.Printf("Error happened in usecases.GetArticleSubscriptions: %v", err)
+		return
+	}
+
+	if err := respondWithJSON(w, renderUserArticleSubscriptions(userId, result, a.nextCursor(r, next)), http.StatusOK); err != nil {
+		log.Printf("Error happened while responding to GetArticleSubscriptions: %v", err)
+	}
+}
+
+func (a *HttpApi) getSearchSubscriptions(w http.ResponseWriter, r *http.Request) {
+	userId, ok := userIdFromRequest(r)
+	if !ok {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	page, ok := a.parsePage(w, r)
+	if !ok {
+		return
+	}
+
+	result, next, err := a.usecases.GetSearchSubscriptions(userId, page)
+	if err != nil {
+		w.WriteHeader(pagedErrorStatus(err))
+		log.Printf("Error happened in usecases.GetSearchSubscriptions: %v", err)
+		return
+	}
+
+	if err := respondWithJSON(w, renderUserSearchSubscriptions(userId, result, a.nextCursor(r, next)), http.StatusOK); err != nil {
+		log.Printf("Error happened while responding to GetSearchSubscriptions: %v", err)
 	}
 }
 
@@ -337,7 +699,12 @@ func (a *HttpApi) deleteArticleSubscriptionStatus(w http.ResponseWriter, r *http
 }
 
 func (a *HttpApi) getSearchQuerySubscriptionStatus(w http.ResponseWriter, r *http.Request) {
-	query := mux.Vars(r)["query"]
+	query, err := searchQueryFromRequest(r)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		log.Printf("Error happened while parsing search params: %v", err)
+		return
+	}
 	userId, ok := userIdFromRequest(r)
 	if !ok {
 		w.WriteHeader(http.StatusUnauthorized)
@@ -363,7 +730,12 @@ func (a *HttpApi) getSearchQuerySubscriptionStatus(w http.ResponseWriter, r *htt
 }
 
 func (a *HttpApi) postSearchQuerySubscriptionStatus(w http.ResponseWriter, r *http.Request) {
-	query := mux.Vars(r)["query"]
+	query, err := searchQueryFromRequest(r)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		log.Printf("Error happened while parsing search params: %v", err)
+		return
+	}
 
 	userId, ok := userIdFromRequest(r)
 	if !ok {
@@ -372,6 +744,9 @@ func (a *HttpApi) postSearchQuerySubscriptionStatus(w http.ResponseWriter, r *ht
 	}
 
 	result, err := a.usecases.SubscribeForSearch(userId, query)
+	if respondWithQueryError(w, err) {
+		return
+	}
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		log.Printf("Error happened in usecases.PostSearchQuerySubscriptionStatus: %v", err)
@@ -384,13 +759,18 @@ func (a *HttpApi) postSearchQuerySubscriptionStatus(w http.ResponseWriter, r *ht
 }
 
 func (a *HttpApi) deleteSearchQuerySubscriptionStatus(w http.ResponseWriter, r *http.Request) {
-	query := mux.Vars(r)["query"]
+	query, err := searchQueryFromRequest(r)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		log.Printf("Error happened while parsing search params: %v", err)
+		return
+	}
 	userId, ok := userIdFromRequest(r)
 	if !ok {
 		w.WriteHeader(http.StatusUnauthorized)
 		return
 	}
-	err := a.usecases.UnsubscribeFromSearch(userId, query)
+	err = a.usecases.UnsubscribeFromSearch(userId, query)
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		log.Printf("Error happened in usecases.PostSearchQuerySubscriptionStatus: %v", err)
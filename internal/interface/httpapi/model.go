@@ -2,6 +2,7 @@ package httpapi
 
 import (
     "github.com/mp-hl-2021/unarXiv/internal/domain/model"
+    "github.com/mp-hl-2021/unarXiv/internal/domain/searchquery"
     "github.com/mp-hl-2021/unarXiv/internal/usecases"
 )
 
@@ -16,7 +17,21 @@ type ArticleMetaResponse struct {
     Title               string          `json:"title"`
     Authors             []string        `json:"authors"`
     Abstract            string          `json:"abstract"`
+    Categories          []string        `json:"categories"`
+    PrimaryCategory     string          `json:"primary_category,omitempty"`
+    CrossLists          []string        `json:"cross_lists,omitempty"`
     LastUpdateTimestamp uint64          `json:"last_update"`
+    SubmittedAt         uint64          `json:"submitted_at,omitempty"`
+    LatestVersionAt     uint64          `json:"latest_version_at,omitempty"`
+    DOI                 string          `json:"doi,omitempty"`
+    JournalRef          string          `json:"journal_ref,omitempty"`
+    Comments            string          `json:"comments,omitempty"`
+    License             string          `json:"license,omitempty"`
+
+    // Per-user fields, omitted for anonymous requests.
+    Viewed       *bool   `json:"viewed,omitempty"`
+    LastViewedAt *uint64 `json:"last_viewed_at,omitempty"`
+    Subscribed   *bool   `json:"subscribed,omitempty"`
 }
 
 func renderArticleMeta(article model.ArticleMeta) ArticleMetaResponse {
@@ -25,8 +40,162 @@ func renderArticleMeta(article model.ArticleMeta) ArticleMetaResponse {
         Title:               article.Title,
         Authors:             article.Authors,
         Abstract:            article.Abstract,
+        Categories:          article.Categories,
+        PrimaryCategory:     article.PrimaryCategory(),
+        CrossLists:          article.CrossLists(),
         LastUpdateTimestamp: article.LastUpdateTimestamp,
+        SubmittedAt:         article.SubmittedAt,
+        LatestVersionAt:     article.LatestVersionAt,
+        DOI:                 article.DOI,
+        JournalRef:          article.JournalRef,
+        Comments:            article.Comments,
+        License:             article.License,
+    }
+}
+
+func renderUserArticleMeta(article model.UserArticleMeta) ArticleMetaResponse {
+    r := renderArticleMeta(article.ArticleMeta)
+    if relation := article.Relation; relation != nil {
+        r.Viewed = &relation.Viewed
+        r.Subscribed = &relation.Subscribed
+        if relation.Viewed {
+            r.LastViewedAt = &relation.LastViewedAt
+        }
+    }
+    return r
+}
+
+type ArticleMetasResponse struct {
+    Articles   []ArticleMetaResponse `json:"articles"`
+    NextCursor string                `json:"next_cursor,omitempty"`
+}
+
+func renderArticleMetas(articles []model.UserArticleMeta, nextCursor string) ArticleMetasResponse {
+    r := ArticleMetasResponse{
+        Articles:   make([]ArticleMetaResponse, len(articles)),
+        NextCursor: nextCursor,
+    }
+    for i := range articles {
+        r.Articles[i] = renderUserArticleMeta(articles[i])
+    }
+    return r
+}
+
+type SuggestionResponse struct {
+    Text   string                 `json:"text"`
+    Source model.SuggestionSource `json:"source"`
+}
+
+type SuggestionsResponse struct {
+    Suggestions []SuggestionResponse `json:"suggestions"`
+}
+
+func renderSuggestions(suggestions []model.Suggestion) SuggestionsResponse {
+    r := SuggestionsResponse{
+        Suggestions: make([]SuggestionResponse, len(suggestions)),
+    }
+    for i := range suggestions {
+        r.Suggestions[i] = SuggestionResponse{
+            Text:   suggestions[i].Text,
+            Source: suggestions[i].Source,
+        }
     }
+    return r
+}
+
+type RelatedArticleResponse struct {
+    ArticleMetaResponse
+    Score float64 `json:"score"`
+}
+
+type RelatedArticlesResponse struct {
+    Articles []RelatedArticleResponse `json:"articles"`
+}
+
+func renderRelatedArticles(related []model.RelatedArticle) RelatedArticlesResponse {
+    r := RelatedArticlesResponse{
+        Articles: make([]RelatedArticleResponse, len(related)),
+    }
+    for i := range related {
+        r.Articles[i] = RelatedArticleResponse{
+            ArticleMetaResponse: renderUserArticleMeta(related[i].UserArticleMeta),
+            Score:               related[i].Score,
+        }
+    }
+    return r
+}
+
+type ArticleVersionResponse struct {
+    Version     uint32 `json:"version"`
+    SubmittedAt uint64 `json:"submitted_at,omitempty"`
+    Recorded    bool   `json:"recorded"`
+
+    // Snapshot of the article, omitted for versions that were not recorded.
+    Title    string   `json:"title,omitempty"`
+    Abstract string   `json:"abstract,omitempty"`
+    Authors  []string `json:"authors,omitempty"`
+    Comment  string   `json:"comment,omitempty"`
+}
+
+type ArticleVersionsResponse struct {
+    Id       model.ArticleId          `json:"article_id"`
+    Versions []ArticleVersionResponse `json:"versions"`
+}
+
+func renderArticleVersions(id model.ArticleId, versions []model.ArticleVersion) ArticleVersionsResponse {
+    r := ArticleVersionsResponse{
+        Id:       id,
+        Versions: make([]ArticleVersionResponse, len(versions)),
+    }
+    for i, v := range versions {
+        r.Versions[i] = ArticleVersionResponse{
+            Version:     v.Version,
+            SubmittedAt: v.SubmittedAt,
+            Recorded:    v.Recorded,
+            Title:       v.Title,
+            Abstract:    v.Abstract,
+            Authors:     v.Authors,
+            Comment:     v.Comment,
+        }
+    }
+    return r
+}
+
+type FieldChangeResponse struct {
+    Field   model.ArticleField `json:"field"`
+    Old     *string            `json:"old,omitempty"`
+    New     *string            `json:"new,omitempty"`
+    Added   []string           `json:"added,omitempty"`
+    Removed []string           `json:"removed,omitempty"`
+}
+
+type VersionDiffResponse struct {
+    Id      model.ArticleId       `json:"article_id"`
+    From    uint32                `json:"from"`
+    To      uint32                `json:"to"`
+    Changes []FieldChangeResponse `json:"changes"`
+}
+
+func renderVersionDiff(diff model.VersionDiff) VersionDiffResponse {
+    r := VersionDiffResponse{
+        Id:      diff.ArticleId,
+        From:    diff.From,
+        To:      diff.To,
+        Changes: make([]FieldChangeResponse, len(diff.Changes)),
+    }
+    for i := range diff.Changes {
+        change := &diff.Changes[i]
+        r.Changes[i] = FieldChangeResponse{Field: change.Field}
+        if change.Field == model.AuthorsField {
+            r.Changes[i].Added = change.Added
+            r.Changes[i].Removed = change.Removed
+        } else {
+            // an empty value is still a value of a text field
+            r.Changes[i].Old = &change.Old
+            r.Changes[i].New = &change.New
+        }
+    }
+    return r
 }
 
 type ArticleResponse struct {
@@ -53,62 +222,202 @@ func renderUserArticleSubscription(subscription model.UserArticleSubscription) U
     }
 }
 
+type UserArticleSubscriptionsResponse struct {
+    UserId     model.UserId      `json:"user_id"`
+    ArticleIds []model.ArticleId `json:"article_ids"`
+    NextCursor string            `json:"next_cursor,omitempty"`
+}
+
+func renderUserArticleSubscriptions(userId model.UserId, subscriptions []model.UserArticleSubscription, nextCursor string) UserArticleSubscriptionsResponse {
+    r := UserArticleSubscriptionsResponse{
+        UserId:     userId,
+        ArticleIds: make([]model.ArticleId, len(subscriptions)),
+        NextCursor: nextCursor,
+    }
+    for i := range subscriptions {
+        r.ArticleIds[i] = subscriptions[i].ArticleId
+    }
+    return r
+}
+
+type SearchQueryResponse struct {
+    Query         string `json:"query"`
+    UpdatedAfter  uint64 `json:"updated_after,omitempty"`
+    UpdatedBefore uint64 `json:"updated_before,omitempty"`
+    Author        string `json:"author,omitempty"`
+    Category      string `json:"category,omitempty"`
+    SortOrder     string `json:"sort,omitempty"`
+    IncludeBody   bool   `json:"include_body,omitempty"`
+}
+
+func renderSearchQuery(query model.SearchQuery) SearchQueryResponse {
+    return SearchQueryResponse{
+        Query:         query.Query,
+        UpdatedAfter:  query.Filters.UpdatedAfter,
+        UpdatedBefore: query.Filters.UpdatedBefore,
+        Author:        query.Filters.Author,
+        Category:      query.Filters.Category,
+        SortOrder:     string(query.SortOrder),
+        IncludeBody:   query.IncludeBody,
+    }
+}
+
+type SearchQueriesResponse struct {
+    Queries    []SearchQueryResponse `json:"queries"`
+    NextCursor string                `json:"next_cursor,omitempty"`
+}
+
+func renderSearchQueries(queries []model.SearchQuery, nextCursor string) SearchQueriesResponse {
+    r := SearchQueriesResponse{
+        Queries:    make([]SearchQueryResponse, len(queries)),
+        NextCursor: nextCursor,
+    }
+    for i := range queries {
+        r.Queries[i] = renderSearchQuery(queries[i])
+    }
+    return r
+}
+
 type UserSearchSubscriptionResponse struct {
     UserId model.UserId `json:"user_id"`
-    Query  string       `json:"query"`
+    SearchQueryResponse
 }
 
 func renderUserSearchSubscription(subscription model.UserSearchSubscription) UserSearchSubscriptionResponse {
     return UserSearchSubscriptionResponse{
-        UserId: subscription.UserId,
-        Query:  subscription.Query,
+        UserId:              subscription.UserId,
+        SearchQueryResponse: renderSearchQuery(subscription.Query),
+    }
+}
+
+type UserSearchSubscriptionsResponse struct {
+    UserId model.UserId `json:"user_id"`
+    SearchQueriesResponse
+}
+
+func renderUserSearchSubscriptions(userId model.UserId, subscriptions []model.UserSearchSubscription, nextCursor string) UserSearchSubscriptionsResponse {
+    queries := make([]model.SearchQuery, len(subscriptions))
+    for i := range subscriptions {
+        queries[i] = subscriptions[i].Query
+    }
+    return UserSearchSubscriptionsResponse{
+        UserId:                userId,
+        SearchQueriesResponse: renderSearchQueries(queries, nextCursor),
     }
 }
 
 type UserSearchHistoryResponse struct {
-    UserId  model.UserId `json:"user_id"`
-    Queries []string     `json:"queries"`
+    UserId model.UserId `json:"user_id"`
+    SearchQueriesResponse
 }
 
-func renderUserSearchHistory(history model.UserSearchHistory) UserSearchHistoryResponse {
+func renderUserSearchHistory(history model.UserSearchHistory, nextCursor string) UserSearchHistoryResponse {
     return UserSearchHistoryResponse{
-        UserId:  history.UserId,
-        Queries: history.Queries,
+        UserId:                history.UserId,
+        SearchQueriesResponse: renderSearchQueries(history.Queries, nextCursor),
     }
 }
 
 type UserArticleHistoryResponse struct {
-    UserId   model.UserId          `json:"user_id"`
-    Articles []ArticleMetaResponse `json:"articles"`
+    UserId model.UserId `json:"user_id"`
+    ArticleMetasResponse
 }
 
-func renderUserArticleHistory(history model.UserArticleHistory) UserArticleHistoryResponse {
-    articles := make([]ArticleMetaResponse, len(history.Articles))
-    for i := range history.Articles {
-        articles[i] = renderArticleMeta(history.Articles[i])
-    }
+func renderUserArticleHistory(history model.UserArticleHistory, nextCursor string) UserArticleHistoryResponse {
     return UserArticleHistoryResponse{
-        UserId:   history.UserId,
-        Articles: articles,
+        UserId:               history.UserId,
+        ArticleMetasResponse: renderArticleMetas(history.Articles, nextCursor),
     }
 }
 
+type SearchHighlightsResponse struct {
+    Title    string `json:"title"`
+    Abstract string `json:"abstract"`
+}
+
+type SearchHitResponse struct {
+    ArticleMetaResponse
+    Highlights *SearchHighlightsResponse `json:"highlights,omitempty"`
+}
+
+func renderSearchHit(hit model.SearchHit) SearchHitResponse {
+    r := SearchHitResponse{
+        ArticleMetaResponse: renderUserArticleMeta(hit.UserArticleMeta),
+    }
+    if hit.Highlights != nil {
+        r.Highlights = &SearchHighlightsResponse{
+            Title:    hit.Highlights.Title,
+            Abstract: hit.Highlights.Abstract,
+        }
+    }
+    return r
+}
+
+type FacetBucketResponse struct {
+    Value string `json:"value"`
+    Count uint32 `json:"count"`
+}
+
+func renderFacetBuckets(buckets []model.FacetBucket) []FacetBucketResponse {
+    if buckets == nil {
+        return nil
+    }
+    r := make([]FacetBucketResponse, len(buckets))
+    for i := range buckets {
+        r[i] = FacetBucketResponse{
+            Value: buckets[i].Value,
+            Count: buckets[i].Count,
+        }
+    }
+    return r
+}
+
+type SearchFacetsResponse struct {
+    Authors    []FacetBucketResponse `json:"authors,omitempty"`
+    Categories []FacetBucketResponse `json:"categories,omitempty"`
+    Years      []FacetBucketResponse `json:"years,omitempty"`
+}
+
 type SearchResultResponse struct {
     TotalMatchesCount uint32                `json:"total_matches"`
-    Articles          []ArticleMetaResponse `json:"articles"`
+    Articles          []SearchHitResponse   `json:"articles"`
+    Facets            *SearchFacetsResponse `json:"facets,omitempty"`
+    NextCursor        string                `json:"next_cursor,omitempty"`
+    DidYouMean        string                `json:"did_you_mean,omitempty"`
 }
 
-func renderSearchResults(result model.SearchResult) SearchResultResponse {
+func renderSearchResults(result model.SearchResult, nextCursor string) SearchResultResponse {
     r := SearchResultResponse{
         TotalMatchesCount: result.TotalMatchesCount,
-        Articles:          make([]ArticleMetaResponse, len(result.Articles)),
+        Articles:          make([]SearchHitResponse, len(result.Articles)),
+        NextCursor:        nextCursor,
+        DidYouMean:        result.DidYouMean,
     }
     for i := range result.Articles {
-        r.Articles[i] = renderArticleMeta(result.Articles[i])
+        r.Articles[i] = renderSearchHit(result.Articles[i])
+    }
+    if result.Facets != nil {
+        r.Facets = &SearchFacetsResponse{
+            Authors:    renderFacetBuckets(result.Facets.Authors),
+            Categories: renderFacetBuckets(result.Facets.Categories),
+            Years:      renderFacetBuckets(result.Facets.Years),
+        }
     }
     return r
 }
 
+type QueryErrorResponse struct {
+    Error    string `json:"error"`
+    Position int    `json:"position"`
+}
+
+func renderQueryError(err *searchquery.ParseError) QueryErrorResponse {
+    return QueryErrorResponse{
+        Error:    err.Msg,
+        Position: err.Pos,
+    }
+}
+
 type AuthTokenResponse struct {
     Token string `json:"token"`
 }
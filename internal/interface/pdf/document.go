@@ -0,0 +1,287 @@
+package pdf
+
+import (
+	"bytes"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+)
+
+var (
+	ErrNotPDF    = errors.New("not a PDF document")
+	ErrNoPages   = errors.New("no pages found")
+	ErrMalformed = errors.New("malformed PDF document")
+)
+
+// maxDecodedStream bounds the size of a single decoded stream.
+const maxDecodedStream = 64 << 20
+
+var objectHeaderRegexp = regexp.MustCompile(`(\d+)\s+(\d+)\s+obj\b`)
+
+// document is a PDF file loaded by scanning for objects rather than by reading
+// cross-reference tables, which makes it tolerant to broken or truncated files.
+type document struct {
+	objects map[int64]object
+	root    dict
+}
+
+func loadDocument(data []byte) (*document, error) {
+	if !bytes.HasPrefix(bytes.TrimLeft(data, "\x00\t\n\f\r "), []byte("%PDF-")) {
+		return nil, ErrNotPDF
+	}
+	d := &document{objects: make(map[int64]object)}
+	var trailers []dict
+	for _, m := range objectHeaderRegexp.FindAllSubmatchIndex(data, -1) {
+		// object numbers too large for int64 are parsed as float64
+		n, _ := parseNumber(string(data[m[2]:m[3]]))
+		num, ok := n.(int64)
+		if !ok {
+			continue
+		}
+		l := &lexer{data: data, pos: m[1]}
+		o, err := l.object()
+		if err != nil {
+			continue
+		}
+		if dd, ok := o.(dict); ok {
+			if s, ok := l.streamAfter(dd); ok {
+				o = s
+			}
+			if dd["Type"] == name("XRef") {
+				trailers = append(trailers, dd)
+			}
+		}
+		// later objects belong to incremental updates and replace earlier ones
+		d.objects[num] = o
+	}
+	d.loadObjectStreams()
+
+	for _, i := range allIndices(data, []byte("trailer")) {
+		l := &lexer{data: data, pos: i + len("trailer")}
+		if o, err := l.object(); err == nil {
+			if t, ok := o.(dict); ok {
+				trailers = append(trailers, t)
+			}
+		}
+	}
+	for i := len(trailers) - 1; i >= 0 && d.root == nil; i-- {
+		d.root, _ = d.resolve(trailers[i]["Root"]).(dict)
+	}
+	if d.root == nil {
+		for _, o := range d.objects {
+			if dd, ok := o.(dict); ok && dd["Type"] == name("Catalog") {
+				d.root = dd
+				break
+			}
+		}
+	}
+	if d.root == nil {
+		return nil, ErrNoPages
+	}
+	return d, nil
+}
+
+func allIndices(data, sep []byte) []int {
+	var indices []int
+	for start := 0; ; {
+		i := bytes.Index(data[start:], sep)
+		if i < 0 {
+			return indices
+		}
+		indices = append(indices, start+i)
+		start += i + len(sep)
+	}
+}
+
+// streamAfter reads stream data following its dictionary if there is any.
+func (l *lexer) streamAfter(d dict) (*stream, bool) {
+	saved := l.pos
+	if t, err := l.token(); err != nil || t != keyword("stream") {
+		l.pos = saved
+		return nil, false
+	}
+	start := l.pos
+	if start < len(l.data) && l.data[start] == '\r' {
+		start++
+	}
+	if start < len(l.data) && l.data[start] == '\n' {
+		start++
+	}
+	// /Length may be an indirect object not loaded yet, so it is only trusted if
+	// "endstream" follows, otherwise the data is delimited by "endstream" itself.
+	if n, ok := d["Length"].(int64); ok && n >= 0 && start+int(n) <= len(l.data) {
+		rest := bytes.TrimLeft(l.data[start+int(n):], "\x00\t\n\f\r ")
+		if bytes.HasPrefix(rest, []byte("endstream")) {
+			return &stream{dict: d, data: l.data[start : start+int(n)]}, true
+		}
+	}
+	end := bytes.Index(l.data[start:], []byte("endstream"))
+	if end < 0 {
+		return &stream{dict: d, data: l.data[start:]}, true
+	}
+	data := bytes.TrimRight(l.data[start:start+end], "\r\n")
+	return &stream{dict: d, data: data}, true
+}
+
+// loadObjectStreams adds objects compressed into object streams, unless they are
+// defined directly.
+func (d *document) loadObjectStreams() {
+	var streams []*stream
+	for _, o := range d.objects {
+		if s, ok := o.(*stream); ok && s.dict["Type"] == name("ObjStm") {
+			streams = append(streams, s)
+		}
+	}
+	for _, s := range streams {
+		data, err := d.decode(s)
+		if err != nil && len(data) == 0 {
+			continue
+		}
+		n, _ := d.resolve(s.dict["N"]).(int64)
+		first, _ := d.resolve(s.dict["First"]).(int64)
+		header := &lexer{data: data}
+		for i := int64(0); i < n; i++ {
+			num, err1 := header.token()
+			offset, err2 := header.token()
+			objNum, ok1 := num.(int64)
+			objOffset, ok2 := offset.(int64)
+			if err1 != nil || err2 != nil || !ok1 || !ok2 {
+				break
+			}
+			if _, defined := d.objects[objNum]; defined {
+				continue
+			}
+			l := &lexer{data: data, pos: int(first + objOffset)}
+			if l.pos < 0 || l.pos >= len(data) {
+				continue
+			}
+			if o, err := l.object(); err == nil {
+				d.objects[objNum] = o
+			}
+		}
+	}
+}
+
+// resolve follows references, returning nil for missing objects.
+func (d *document) resolve(o object) object {
+	for i := 0; i < 32; i++ {
+		r, ok := o.(ref)
+		if !ok {
+			return o
+		}
+		o = d.objects[r.num]
+	}
+	return nil
+}
+
+func (d *document) dict(o object) dict {
+	switch o := d.resolve(o).(type) {
+	case dict:
+		return o
+	case *stream:
+		return o.dict
+	}
+	return nil
+}
+
+// decode returns decoded stream data. On a decoding error the data decoded
+// so far is returned along with the error.
+func (d *document) decode(s *stream) ([]byte, error) {
+	var filters []object
+	switch f := d.resolve(s.dict["Filter"]).(type) {
+	case name:
+		filters = []object{f}
+	case array:
+		filters = f
+	}
+	data := s.data
+	for _, f := range filters {
+		var err error
+		switch d.resolve(f) {
+		case name("FlateDecode"), name("Fl"):
+			data, err = inflate(data)
+		case name("ASCIIHexDecode"), name("AHx"):
+			if end := bytes.IndexByte(data, '>'); end >= 0 {
+				data = data[:end]
+			}
+			data = decodeHex(data)
+		default:
+			return nil, fmt.Errorf("unsupported filter %v", f)
+		}
+		if err != nil {
+			return data, err
+		}
+	}
+	return data, nil
+}
+
+func inflate(data []byte) ([]byte, error) {
+	r, err := zlib.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return io.ReadAll(io.LimitReader(r, maxDecodedStream))
+}
+
+// pages returns page dictionaries in document order. Inherited resources are
+// copied into pages.
+func (d *document) pages() []dict {
+	var pages []dict
+	visited := make(map[int64]bool)
+	var walk func(node dict, resources object, depth int)
+	walk = func(node dict, resources object, depth int) {
+		if node == nil || depth > 64 {
+			return
+		}
+		if r, ok := node["Resources"]; ok {
+			resources = r
+		}
+		kids, isTree := d.resolve(node["Kids"]).(array)
+		if !isTree {
+			page := dict{}
+			for k, v := range node {
+				page[k] = v
+			}
+			page["Resources"] = resources
+			pages = append(pages, page)
+			return
+		}
+		for _, kid := range kids {
+			// page trees of broken files may have cycles
+			if r, ok := kid.(ref); ok {
+				if visited[r.num] {
+					continue
+				}
+				visited[r.num] = true
+			}
+			walk(d.dict(kid), resources, depth+1)
+		}
+	}
+	walk(d.dict(d.root["Pages"]), nil, 0)
+	return pages
+}
+
+// contents returns the concatenated content streams of a page.
+func (d *document) contents(page dict) []byte {
+	var streams []object
+	switch c := d.resolve(page["Contents"]).(type) {
+	case *stream:
+		streams = []object{c}
+	case array:
+		streams = c
+	}
+	var buf bytes.Buffer
+	for _, o := range streams {
+		s, ok := d.resolve(o).(*stream)
+		if !ok {
+			continue
+		}
+		data, _ := d.decode(s)
+		buf.Write(data)
+		buf.WriteByte('\n')
+	}
+	return buf.Bytes()
+}
@@ -0,0 +1,201 @@
+package pdf
+
+import (
+	"strconv"
+	"strings"
+	"unicode/utf16"
+)
+
+// font turns character codes of shown strings into text.
+type font struct {
+	// codeLength is the number of bytes per code, 2 for composite fonts
+	codeLength int
+	toUnicode  map[uint32]string
+	// encoding maps single byte codes of simple fonts without ToUnicode
+	encoding *[256]rune
+}
+
+func (f *font) decode(s []byte) string {
+	var b strings.Builder
+	n := f.codeLength
+	for i := 0; i+n <= len(s); i += n {
+		code := uint32(0)
+		for _, c := range s[i : i+n] {
+			code = code<<8 | uint32(c)
+		}
+		if text, ok := f.toUnicode[code]; ok {
+			b.WriteString(text)
+		} else if f.encoding != nil {
+			if r := f.encoding[code]; r != 0 {
+				b.WriteRune(r)
+			}
+		}
+	}
+	return b.String()
+}
+
+// loadFont reads the encoding of a font dictionary. Composite fonts without
+// ToUnicode can't be decoded and produce no text.
+func (d *document) loadFont(fontDict dict) *font {
+	f := &font{codeLength: 1}
+	if d.resolve(fontDict["Subtype"]) == name("Type0") {
+		f.codeLength = 2
+	}
+	if s, ok := d.resolve(fontDict["ToUnicode"]).(*stream); ok {
+		if data, err := d.decode(s); err == nil || len(data) != 0 {
+			f.toUnicode, f.codeLength = parseCMap(data, f.codeLength)
+		}
+	}
+	if f.codeLength == 1 {
+		f.encoding = d.simpleEncoding(fontDict)
+	}
+	return f
+}
+
+// simpleEncoding starts with Latin-1, which agrees with standard encodings on
+// letters and digits, and applies /Differences by glyph names.
+func (d *document) simpleEncoding(fontDict dict) *[256]rune {
+	var enc [256]rune
+	for i := range enc {
+		if i >= 32 {
+			enc[i] = rune(i)
+		}
+	}
+	encDict, ok := d.resolve(fontDict["Encoding"]).(dict)
+	if !ok {
+		return &enc
+	}
+	differences, _ := d.resolve(encDict["Differences"]).(array)
+	code := int64(-1)
+	for _, o := range differences {
+		switch v := d.resolve(o).(type) {
+		case int64:
+			code = v
+		case name:
+			if code >= 0 && code < 256 {
+				enc[code] = glyphRune(string(v))
+				code++
+			}
+		}
+	}
+	return &enc
+}
+
+// glyphs maps glyph names that are not a single letter or digit.
+var glyphs = map[string]rune{
+	"space": ' ', "exclam": '!', "quotedbl": '"', "numbersign": '#', "dollar": '$',
+	"percent": '%', "ampersand": '&', "quoteright": '\'', "quotesingle": '\'',
+	"parenleft": '(', "parenright": ')', "asterisk": '*', "plus": '+', "comma": ',',
+	"hyphen": '-', "minus": '-', "endash": '-', "emdash": '-', "period": '.', "slash": '/',
+	"colon": ':', "semicolon": ';', "less": '<', "equal": '=', "greater": '>',
+	"question": '?', "at": '@', "bracketleft": '[', "backslash": '\\', "bracketright": ']',
+	"underscore": '_', "quoteleft": '\'', "braceleft": '{', "bar": '|', "braceright": '}',
+	"quotedblleft": '"', "quotedblright": '"',
+	"zero": '0', "one": '1', "two": '2', "three": '3', "four": '4',
+	"five": '5', "six": '6', "seven": '7', "eight": '8', "nine": '9',
+	"fi": 'ﬁ', "fl": 'ﬂ', "ff": 'ﬀ', "ffi": 'ﬃ', "ffl": 'ﬄ',
+	"dotlessi": 'ı', "germandbls": 'ß', "ae": 'æ', "oe": 'œ', "oslash": 'ø',
+	"alpha": 'α', "beta": 'β', "gamma": 'γ', "delta": 'δ', "epsilon": 'ε',
+	"lambda": 'λ', "mu": 'μ', "pi": 'π', "sigma": 'σ', "tau": 'τ', "phi": 'φ', "omega": 'ω',
+}
+
+func glyphRune(glyph string) rune {
+	if r, ok := glyphs[glyph]; ok {
+		return r
+	}
+	if len(glyph) == 1 {
+		return rune(glyph[0])
+	}
+	if strings.HasPrefix(glyph, "uni") && len(glyph) == 7 {
+		if v, err := strconv.ParseUint(glyph[3:], 16, 16); err == nil {
+			return rune(v)
+		}
+	}
+	return 0
+}
+
+// parseCMap reads bfchar and bfrange mappings of a ToUnicode CMap. The code
+// length is taken from the codespace range, if there is one.
+func parseCMap(data []byte, codeLength int) (map[uint32]string, int) {
+	m := make(map[uint32]string)
+	l := &lexer{data: data}
+	var operands []object
+	for {
+		t, err := l.object()
+		if err != nil {
+			return m, codeLength
+		}
+		kw, ok := t.(keyword)
+		if !ok {
+			operands = append(operands, t)
+			continue
+		}
+		switch kw {
+		case "endcodespacerange":
+			if len(operands) >= 1 {
+				if lo, ok := operands[0].([]byte); ok && len(lo) > 0 {
+					codeLength = len(lo)
+				}
+			}
+		case "endbfchar":
+			for i := 0; i+1 < len(operands); i += 2 {
+				src, ok1 := operands[i].([]byte)
+				dst, ok2 := operands[i+1].([]byte)
+				if ok1 && ok2 {
+					m[codeOf(src)] = utf16Text(dst)
+				}
+			}
+		case "endbfrange":
+			for i := 0; i+2 < len(operands); i += 3 {
+				lo, ok1 := operands[i].([]byte)
+				hi, ok2 := operands[i+1].([]byte)
+				if !ok1 || !ok2 {
+					continue
+				}
+				start, end := codeOf(lo), codeOf(hi)
+				if end < start || end-start > 0xffff {
+					continue
+				}
+				switch dst := operands[i+2].(type) {
+				case []byte:
+					for code := start; code <= end; code++ {
+						m[code] = utf16Text(incrementLast(dst, code-start))
+					}
+				case array:
+					for j, o := range dst {
+						if s, ok := o.([]byte); ok && start+uint32(j) <= end {
+							m[start+uint32(j)] = utf16Text(s)
+						}
+					}
+				}
+			}
+		}
+		operands = operands[:0]
+	}
+}
+
+func codeOf(b []byte) uint32 {
+	code := uint32(0)
+	for _, c := range b {
+		code = code<<8 | uint32(c)
+	}
+	return code
+}
+
+// incrementLast adds n to the last UTF-16 unit of a big-endian string.
+func incrementLast(b []byte, n uint32) []byte {
+	c := append([]byte(nil), b...)
+	if len(c) >= 2 {
+		v := uint32(c[len(c)-2])<<8 | uint32(c[len(c)-1]) + n
+		c[len(c)-2], c[len(c)-1] = byte(v>>8), byte(v)
+	}
+	return c
+}
+
+func utf16Text(b []byte) string {
+	units := make([]uint16, 0, len(b)/2)
+	for i := 0; i+1 < len(b); i += 2 {
+		units = append(units, uint16(b[i])<<8|uint16(b[i+1]))
+	}
+	return string(utf16.Decode(units))
+}
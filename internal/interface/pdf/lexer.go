@@ -0,0 +1,315 @@
+package pdf
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+// PDF objects are represented by Go values:
+// nil, bool, int64, float64, name, []byte (strings), array, dict, ref and *stream.
+type object interface{}
+
+type name string
+
+type array []object
+
+type dict map[name]object
+
+type ref struct {
+	num, gen int64
+}
+
+type stream struct {
+	dict dict
+	data []byte // raw, still encoded
+}
+
+// keyword is a bare word such as an operator of a content stream or
+// one of the delimiters "[", "]", "<<" and ">>".
+type keyword string
+
+var (
+	errUnexpectedEOF = errors.New("unexpected end of data")
+	errTooDeep       = errors.New("arrays and dictionaries nested too deep")
+)
+
+// maxNesting bounds nesting of arrays and dictionaries, which are read recursively.
+const maxNesting = 64
+
+type lexer struct {
+	data []byte
+	pos  int
+	// depth is the number of arrays and dictionaries being read
+	depth int
+}
+
+func isSpace(c byte) bool {
+	switch c {
+	case 0, '\t', '\n', '\f', '\r', ' ':
+		return true
+	}
+	return false
+}
+
+func isDelimiter(c byte) bool {
+	switch c {
+	case '(', ')', '<', '>', '[', ']', '{', '}', '/', '%':
+		return true
+	}
+	return false
+}
+
+func (l *lexer) skipSpace() {
+	for l.pos < len(l.data) {
+		c := l.data[l.pos]
+		switch {
+		case isSpace(c):
+			l.pos++
+		case c == '%':
+			for l.pos < len(l.data) && l.data[l.pos] != '\n' && l.data[l.pos] != '\r' {
+				l.pos++
+			}
+		default:
+			return
+		}
+	}
+}
+
+// token reads a single token: a keyword, a name, a number or a string.
+func (l *lexer) token() (object, error) {
+	l.skipSpace()
+	if l.pos >= len(l.data) {
+		return nil, errUnexpectedEOF
+	}
+	c := l.data[l.pos]
+	switch {
+	case c == '/':
+		return l.name(), nil
+	case c == '(':
+		return l.literalString()
+	case c == '<':
+		if l.pos+1 < len(l.data) && l.data[l.pos+1] == '<' {
+			l.pos += 2
+			return keyword("<<"), nil
+		}
+		return l.hexString()
+	case c == '>':
+		if l.pos+1 < len(l.data) && l.data[l.pos+1] == '>' {
+			l.pos += 2
+			return keyword(">>"), nil
+		}
+		l.pos++
+		return keyword(">"), nil
+	case c == '[' || c == ']' || c == '{' || c == '}' || c == ')':
+		l.pos++
+		return keyword(c), nil
+	}
+	start := l.pos
+	for l.pos < len(l.data) && !isSpace(l.data[l.pos]) && !isDelimiter(l.data[l.pos]) {
+		l.pos++
+	}
+	word := string(l.data[start:l.pos])
+	switch word {
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	case "null":
+		return nil, nil
+	}
+	if n, ok := parseNumber(word); ok {
+		return n, nil
+	}
+	return keyword(word), nil
+}
+
+func parseNumber(word string) (object, bool) {
+	if word == "" {
+		return nil, false
+	}
+	if c := word[0]; c != '+' && c != '-' && c != '.' && (c < '0' || c > '9') {
+		return nil, false
+	}
+	if i, err := strconv.ParseInt(word, 10, 64); err == nil {
+		return i, true
+	}
+	if f, err := strconv.ParseFloat(word, 64); err == nil {
+		return f, true
+	}
+	return nil, false
+}
+
+func (l *lexer) name() name {
+	l.pos++ // '/'
+	var b []byte
+	for l.pos < len(l.data) && !isSpace(l.data[l.pos]) && !isDelimiter(l.data[l.pos]) {
+		c := l.data[l.pos]
+		if c == '#' && l.pos+2 < len(l.data) {
+			if v, err := strconv.ParseUint(string(l.data[l.pos+1:l.pos+3]), 16, 8); err == nil {
+				b = append(b, byte(v))
+				l.pos += 3
+				continue
+			}
+		}
+		b = append(b, c)
+		l.pos++
+	}
+	return name(b)
+}
+
+func (l *lexer) literalString() ([]byte, error) {
+	l.pos++ // '('
+	var b []byte
+	depth := 1
+	for l.pos < len(l.data) {
+		c := l.data[l.pos]
+		l.pos++
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				return b, nil
+			}
+		case '\\':
+			if l.pos >= len(l.data) {
+				return b, errUnexpectedEOF
+			}
+			c = l.data[l.pos]
+			l.pos++
+			switch c {
+			case 'n':
+				c = '\n'
+			case 'r':
+				c = '\r'
+			case 't':
+				c = '\t'
+			case 'b':
+				c = '\b'
+			case 'f':
+				c = '\f'
+			case '\r':
+				if l.pos < len(l.data) && l.data[l.pos] == '\n' {
+					l.pos++
+				}
+				continue
+			case '\n':
+				continue
+			default:
+				if c >= '0' && c <= '7' {
+					v := int(c - '0')
+					for i := 0; i < 2 && l.pos < len(l.data) && l.data[l.pos] >= '0' && l.data[l.pos] <= '7'; i++ {
+						v = v*8 + int(l.data[l.pos]-'0')
+						l.pos++
+					}
+					c = byte(v)
+				}
+			}
+		}
+		b = append(b, c)
+	}
+	return b, errUnexpectedEOF
+}
+
+func (l *lexer) hexString() ([]byte, error) {
+	l.pos++ // '<'
+	end := bytes.IndexByte(l.data[l.pos:], '>')
+	if end < 0 {
+		return nil, errUnexpectedEOF
+	}
+	s := l.data[l.pos : l.pos+end]
+	l.pos += end + 1
+	return decodeHex(s), nil
+}
+
+// decodeHex decodes hex digits ignoring whitespace, a missing final digit is zero.
+func decodeHex(s []byte) []byte {
+	var digits []byte
+	for _, c := range s {
+		if !isSpace(c) {
+			digits = append(digits, c)
+		}
+	}
+	if len(digits)%2 == 1 {
+		digits = append(digits, '0')
+	}
+	b := make([]byte, 0, len(digits)/2)
+	for i := 0; i < len(digits); i += 2 {
+		v, err := strconv.ParseUint(string(digits[i:i+2]), 16, 8)
+		if err != nil {
+			break
+		}
+		b = append(b, byte(v))
+	}
+	return b
+}
+
+// object reads a complete object: arrays and dictionaries are read with their
+// contents and "n g R" is read as a reference.
+func (l *lexer) object() (object, error) {
+	t, err := l.token()
+	if err != nil {
+		return nil, err
+	}
+	switch t := t.(type) {
+	case keyword:
+		if t == "[" || t == "<<" {
+			if l.depth >= maxNesting {
+				return nil, errTooDeep
+			}
+			l.depth++
+			defer func() { l.depth-- }()
+		}
+		switch t {
+		case "[":
+			var a array
+			for {
+				l.skipSpace()
+				if l.pos < len(l.data) && l.data[l.pos] == ']' {
+					l.pos++
+					return a, nil
+				}
+				o, err := l.object()
+				if err != nil {
+					return a, err
+				}
+				a = append(a, o)
+			}
+		case "<<":
+			d := dict{}
+			for {
+				k, err := l.token()
+				if err != nil {
+					return d, err
+				}
+				if k == keyword(">>") {
+					return d, nil
+				}
+				key, ok := k.(name)
+				if !ok {
+					return d, fmt.Errorf("expected a name as a dictionary key, got %v", k)
+				}
+				v, err := l.object()
+				if err != nil {
+					return d, err
+				}
+				d[key] = v
+			}
+		}
+	case int64:
+		// lookahead for "gen R"
+		saved := l.pos
+		if gen, err := l.token(); err == nil {
+			if g, ok := gen.(int64); ok {
+				if r, err := l.token(); err == nil && r == keyword("R") {
+					return ref{num: t, gen: g}, nil
+				}
+			}
+		}
+		l.pos = saved
+	}
+	return t, nil
+}
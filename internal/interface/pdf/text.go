@@ -0,0 +1,241 @@
+// Package pdf extracts plain text from PDF documents for full-text indexing.
+//
+// It aims at documents produced by TeX and similar tools: text is taken from
+// text showing operators in content order, decoded with ToUnicode maps or font
+// encodings. Layout is only approximated with spaces and line breaks.
+package pdf
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// spaceThreshold is the TJ adjustment, in thousandths of a text space unit,
+// that is treated as a space between words.
+const spaceThreshold = 200
+
+var ligatures = strings.NewReplacer("ﬀ", "ff", "ﬁ", "fi", "ﬂ", "fl", "ﬃ", "ffi", "ﬄ", "ffl", "­", "")
+
+// ExtractText returns text of all pages of a document, pages separated with
+// empty lines. Damaged parts of a document are skipped, an error is only
+// returned if there is no document at all, or ErrMalformed if the document
+// is damaged in a way the extraction doesn't expect.
+func ExtractText(data []byte) (text string, err error) {
+	// documents come from the network, a bug triggered by one of them must
+	// not take down the caller
+	defer func() {
+		if r := recover(); r != nil {
+			text, err = "", fmt.Errorf("%w: %v", ErrMalformed, r)
+		}
+	}()
+	d, err := loadDocument(data)
+	if err != nil {
+		return "", err
+	}
+	pages := d.pages()
+	if len(pages) == 0 {
+		return "", ErrNoPages
+	}
+	var w textWriter
+	for _, page := range pages {
+		d.showPage(page, &w)
+		w.paragraph()
+	}
+	return strings.TrimSpace(ligatures.Replace(w.b.String())), nil
+}
+
+// textWriter joins shown strings, collapsing whitespace. A space is only
+// written before the next word, so that lines don't end with spaces.
+type textWriter struct {
+	b            strings.Builder
+	pendingSpace bool
+	// lineStart is true at the beginning of the text and after line breaks.
+	lineStart bool
+}
+
+func (w *textWriter) write(s string) {
+	for _, r := range s {
+		if unicode.IsSpace(r) {
+			w.space()
+			continue
+		}
+		if !unicode.IsPrint(r) {
+			continue
+		}
+		if w.pendingSpace {
+			w.b.WriteByte(' ')
+		}
+		w.b.WriteRune(r)
+		w.pendingSpace, w.lineStart = false, false
+	}
+}
+
+func (w *textWriter) space() {
+	if !w.lineStart && w.b.Len() > 0 {
+		w.pendingSpace = true
+	}
+}
+
+func (w *textWriter) newline() {
+	if !w.lineStart && w.b.Len() > 0 {
+		w.b.WriteByte('\n')
+		w.pendingSpace, w.lineStart = false, true
+	}
+}
+
+func (w *textWriter) paragraph() {
+	w.newline()
+	if w.b.Len() > 0 {
+		w.b.WriteByte('\n')
+	}
+}
+
+func (d *document) pageFonts(page dict) map[name]*font {
+	fonts := make(map[name]*font)
+	resources := d.dict(page["Resources"])
+	for k, v := range d.dict(resources["Font"]) {
+		if fontDict := d.dict(v); fontDict != nil {
+			fonts[k] = d.loadFont(fontDict)
+		}
+	}
+	return fonts
+}
+
+func (d *document) showPage(page dict, w *textWriter) {
+	fonts := d.pageFonts(page)
+	current := &font{codeLength: 1}
+	l := &lexer{data: d.contents(page)}
+	var operands []object
+	// lineY is the vertical position of the current line, set by Tm
+	var lineY float64
+	for {
+		t, err := l.object()
+		if err != nil {
+			return
+		}
+		op, ok := t.(keyword)
+		if !ok {
+			operands = append(operands, t)
+			continue
+		}
+		switch op {
+		case "Tf":
+			if len(operands) >= 1 {
+				if f, ok := fonts[nameOf(operands[0])]; ok {
+					current = f
+				} else {
+					current = &font{codeLength: 1}
+				}
+			}
+		case "Tj":
+			if len(operands) >= 1 {
+				w.write(decodeOperand(current, operands[0]))
+			}
+		case "'":
+			w.newline()
+			if len(operands) >= 1 {
+				w.write(decodeOperand(current, operands[0]))
+			}
+		case "\"":
+			w.newline()
+			if len(operands) >= 3 {
+				w.write(decodeOperand(current, operands[2]))
+			}
+		case "TJ":
+			if len(operands) >= 1 {
+				showArray(current, operands[0], w)
+			}
+		case "Td", "TD":
+			if len(operands) >= 2 {
+				if ty := number(operands[1]); ty != 0 {
+					w.newline()
+				} else if number(operands[0]) > 0 {
+					w.space()
+				}
+			}
+		case "T*":
+			w.newline()
+		case "Tm":
+			if len(operands) >= 6 {
+				if y := number(operands[5]); y != lineY {
+					w.newline()
+					lineY = y
+				} else {
+					w.space()
+				}
+			}
+		case "ET":
+			w.space()
+		case "BI":
+			skipInlineImage(l)
+		}
+		operands = operands[:0]
+	}
+}
+
+func showArray(f *font, o object, w *textWriter) {
+	a, ok := o.(array)
+	if !ok {
+		return
+	}
+	for _, item := range a {
+		switch v := item.(type) {
+		case []byte:
+			w.write(f.decode(v))
+		case int64, float64:
+			// positive adjustments move left, i.e. kern; negative ones leave a gap
+			if number(v) < -spaceThreshold {
+				w.space()
+			}
+		}
+	}
+}
+
+func decodeOperand(f *font, o object) string {
+	if s, ok := o.([]byte); ok {
+		return f.decode(s)
+	}
+	return ""
+}
+
+func nameOf(o object) name {
+	n, _ := o.(name)
+	return n
+}
+
+func number(o object) float64 {
+	switch v := o.(type) {
+	case int64:
+		return float64(v)
+	case float64:
+		return v
+	}
+	return 0
+}
+
+// skipInlineImage skips binary data of an inline image up to the EI operator.
+func skipInlineImage(l *lexer) {
+	id := bytes.Index(l.data[l.pos:], []byte("ID"))
+	if id < 0 {
+		l.pos = len(l.data)
+		return
+	}
+	l.pos += id + 2
+	for {
+		ei := bytes.Index(l.data[l.pos:], []byte("EI"))
+		if ei < 0 {
+			l.pos = len(l.data)
+			return
+		}
+		l.pos += ei + 2
+		before, after := l.data[l.pos-3], byte(' ')
+		if l.pos < len(l.data) {
+			after = l.data[l.pos]
+		}
+		if isSpace(before) && (isSpace(after) || isDelimiter(after)) {
+			return
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package pdf
+
+import (
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestExtractText(t *testing.T) {
+	tests := []struct {
+		file string
+		want string
+	}{
+		{
+			file: "simple.pdf",
+			want: "Attention Is All You Need\n" +
+				"The dominant sequence transduction models\n" +
+				"are based on complex (recurrent) networks with an efficient decoder.",
+		},
+		{
+			file: "compressed.pdf",
+			want: "Page one\n\nPage two\nLast line",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			data, err := ioutil.ReadFile(filepath.Join("testdata", tt.file))
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := ExtractText(data)
+			if err != nil {
+				t.Fatalf("ExtractText() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("ExtractText() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExtractTextTruncated(t *testing.T) {
+	data, err := ioutil.ReadFile(filepath.Join("testdata", "compressed.pdf"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// every prefix must either fail cleanly or produce part of the text
+	for n := 0; n < len(data); n += 7 {
+		if _, err := ExtractText(data[:n]); err != nil && !errors.Is(err, ErrNotPDF) && !errors.Is(err, ErrNoPages) {
+			t.Errorf("ExtractText() of %d bytes error = %v", n, err)
+		}
+	}
+}
+
+func TestExtractTextMalformed(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want error
+	}{
+		{
+			name: "not a PDF",
+			data: "<html></html>",
+			want: ErrNotPDF,
+		},
+		{
+			name: "object number out of range",
+			data: "%PDF-1.4\n99999999999999999999 0 obj\n<< /Type /Catalog /Pages 2 0 R >>\nendobj\n",
+			want: ErrNoPages,
+		},
+		{
+			name: "deeply nested arrays",
+			data: "%PDF-1.4\n1 0 obj\n" + strings.Repeat("[", 1<<20) + "\nendobj\n",
+			want: ErrNoPages,
+		},
+		{
+			name: "deeply nested dictionaries",
+			data: "%PDF-1.4\n1 0 obj\n" + strings.Repeat("<< /A ", 1<<18) + "\nendobj\n",
+			want: ErrNoPages,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ExtractText([]byte(tt.data)); !errors.Is(err, tt.want) {
+				t.Errorf("ExtractText() error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestExtractTextDeeplyNestedContent(t *testing.T) {
+	content := "BT /F1 12 Tf (before) Tj " + strings.Repeat("[", 1<<16) + " ET"
+	data := "%PDF-1.4\n" +
+		"1 0 obj\n<< /Type /Catalog /Pages 2 0 R >>\nendobj\n" +
+		"2 0 obj\n<< /Type /Pages /Kids [3 0 R] /Count 1 >>\nendobj\n" +
+		"3 0 obj\n<< /Type /Page /Parent 2 0 R /Resources << /Font << /F1 << /Subtype /Type1 >> >> >> /Contents 4 0 R >>\nendobj\n" +
+		"4 0 obj\n<< >>\nstream\n" + content + "\nendstream\nendobj\n"
+	got, err := ExtractText([]byte(data))
+	if err != nil {
+		t.Fatalf("ExtractText() error = %v", err)
+	}
+	if got != "before" {
+		t.Errorf("ExtractText() = %q, want %q", got, "before")
+	}
+}
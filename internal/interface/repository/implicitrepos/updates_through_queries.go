@@ -1,9 +1,10 @@
 package implicitrepos
 
 import (
-	"github.com/mp-hl-2021/unarXiv/internal/domain"
+	"errors"
 	"github.com/mp-hl-2021/unarXiv/internal/domain/model"
 	"github.com/mp-hl-2021/unarXiv/internal/domain/repository"
+	"github.com/mp-hl-2021/unarXiv/internal/domain/searchquery"
 )
 
 type UpdatesRepoThroughQueries struct {
@@ -23,32 +24,45 @@ func NewUpdatesRepoThroughQueries(
 	}
 }
 
-func (u *UpdatesRepoThroughQueries) GetArticleSubscriptionsUpdates(id model.UserId) ([]model.ArticleMeta, error) {
-	subs, err := u.articleUserRelationsRepo.GetArticleSubscriptions(id)
-	if err != nil {
-		return nil, err
+// nextChunk asks for as many subscriptions as there are results left to fill the page,
+// so that the key of the last checked subscription is always the key of the page end.
+func nextChunk(page model.PageRequest, found int, after model.PageKey) model.PageRequest {
+	if page.Limit == 0 {
+		return model.PageRequest{After: after}
 	}
-	var result []model.ArticleMeta
-	for _, articleId := range subs {
-		articleMeta, err := u.articleRepo.ArticleMetaById(articleId)
-		if err == domain.ArticleNotFound {
-			continue
-		} else if err != nil {
-			return nil, err
+	return model.PageRequest{Limit: page.Limit - uint32(found), After: after}
+}
+
+func (u *UpdatesRepoThroughQueries) GetArticleSubscriptionsUpdates(id model.UserId, page model.PageRequest) ([]model.UserArticleMeta, model.PageKey, error) {
+	var result []model.UserArticleMeta
+	after := page.After
+	for {
+		subs, next, err := u.articleUserRelationsRepo.GetArticleSubscriptions(id, nextChunk(page, len(result), after))
+		if err != nil {
+			return nil, nil, err
 		}
-		lastAccessTimestamp, err := u.articleUserRelationsRepo.GetArticleLastAccessTimestamp(id, articleId)
-		if err == domain.NeverAccessed {
-			result = append(result, articleMeta)
-			continue
+		articleMetas, err := u.articleRepo.ArticleMetasByIds(subs)
+		if err != nil {
+			return nil, nil, err
 		}
+		relations, err := u.articleUserRelationsRepo.GetArticleRelations(id, subs)
 		if err != nil {
-			return nil, err
+			return nil, nil, err
 		}
-		if lastAccessTimestamp < articleMeta.LastUpdateTimestamp {
-			result = append(result, articleMeta)
+		for _, articleMeta := range articleMetas {
+			relation := relations[articleMeta.Id]
+			if relation.SeenAt() < articleMeta.LastUpdateTimestamp {
+				result = append(result, model.UserArticleMeta{ArticleMeta: articleMeta, Relation: &relation})
+			}
+		}
+		if next == nil {
+			return result, nil, nil
 		}
+		if page.Limit != 0 && len(result) == int(page.Limit) {
+			return result, next, nil
+		}
+		after = next
 	}
-	return result, nil
 }
 
 /*
@@ -66,37 +80,52 @@ func (u *UpdatesRepoThroughQueries) GetArticleSubscriptionsUpdates(id model.User
 - Никак не поднять, товарищ командир!
 - А чего вы ожидали? Сорок шесть тонн!
 */
-func (u *UpdatesRepoThroughQueries) GetSearchSubscriptionsUpdates(id model.UserId) ([]string, error) {
-	subs, err := u.searchUserRelationsRepo.GetSearchSubscriptions(id)
-	if err != nil {
-		return nil, err
-	}
-	var result []string
-	for _, query := range subs {
-		articles, err := u.articleRepo.Search(model.SearchQuery{
-			Query:  query,
-			Offset: 0,
-		}, 0)
+func (u *UpdatesRepoThroughQueries) GetSearchSubscriptionsUpdates(id model.UserId, page model.PageRequest) ([]model.SearchQuery, model.PageKey, error) {
+	var result []model.SearchQuery
+	after := page.After
+	for {
+		subs, next, err := u.searchUserRelationsRepo.GetSearchSubscriptions(id, nextChunk(page, len(result), after))
 		if err != nil {
-			return nil, err
+			return nil, nil, err
 		}
-		lastArticleUpdateTimestamp := uint64(0)
-		for _, articleMeta := range articles.Articles {
-			if lastArticleUpdateTimestamp < articleMeta.LastUpdateTimestamp {
-				lastArticleUpdateTimestamp = articleMeta.LastUpdateTimestamp
-			}
+		lastAccess, err := u.searchUserRelationsRepo.GetSearchLastAccessTimestamps(id, subs)
+		if err != nil {
+			return nil, nil, err
 		}
-		lastAccessTimestamp, err := u.searchUserRelationsRepo.GetSearchLastAccessTimestamp(id, query)
-		if err == domain.NeverAccessed {
-			result = append(result, query)
-			continue
+		for i, query := range subs {
+			// only the most recently updated match matters
+			latest := query
+			latest.SortOrder = model.SortByNewest
+			latest.Page = model.PageRequest{Limit: 1}
+			articles, err := u.articleRepo.Search(latest)
+			var parseErr *searchquery.ParseError
+			if errors.As(err, &parseErr) {
+				// subscribed before the query language was introduced, so its
+				// words are matched the way they were then
+				if latest.Query = searchquery.Literal(query.Query); latest.Query == "" {
+					continue
+				}
+				articles, err = u.articleRepo.Search(latest)
+			}
+			if err != nil {
+				return nil, nil, err
+			}
+			lastArticleUpdateTimestamp := uint64(0)
+			for _, articleMeta := range articles.Articles {
+				if lastArticleUpdateTimestamp < articleMeta.LastUpdateTimestamp {
+					lastArticleUpdateTimestamp = articleMeta.LastUpdateTimestamp
+				}
+			}
+			if lastAccess[i] < lastArticleUpdateTimestamp {
+				result = append(result, query)
+			}
 		}
-		if err != nil {
-			return nil, err
+		if next == nil {
+			return result, nil, nil
 		}
-		if lastAccessTimestamp < lastArticleUpdateTimestamp {
-			result = append(result, query)
+		if page.Limit != 0 && len(result) == int(page.Limit) {
+			return result, next, nil
 		}
+		after = next
 	}
-	return result, nil
 }
@@ -0,0 +1,127 @@
+package implicitrepos
+
+import (
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/mp-hl-2021/unarXiv/internal/domain/model"
+	"github.com/mp-hl-2021/unarXiv/internal/domain/repository"
+)
+
+// roundTrip stands for a query to the database in the fakes, a typical
+// latency of a simple indexed query over a local network.
+const roundTrip = 500 * time.Microsecond
+
+// fakeRepos keep search subscriptions of a single user, sleeping for a
+// roundTrip per call and counting calls. Methods updates don't use are
+// left to the embedded nil interfaces.
+type fakeRepos struct {
+	repository.ArticleRepo
+	repository.SearchUserRelationsRepo
+
+	subscriptions []model.SearchQuery
+	// lastAccess and latestUpdate are by query text
+	lastAccess   map[string]uint64
+	latestUpdate map[string]uint64
+	calls        int32
+}
+
+func (f *fakeRepos) roundTrip() {
+	atomic.AddInt32(&f.calls, 1)
+	time.Sleep(roundTrip)
+}
+
+func (f *fakeRepos) Search(query model.SearchQuery) (model.SearchResult, error) {
+	f.roundTrip()
+	updated, ok := f.latestUpdate[query.Query]
+	if !ok {
+		return model.SearchResult{}, nil
+	}
+	hit := model.SearchHit{UserArticleMeta: model.UserArticleMeta{ArticleMeta: model.ArticleMeta{LastUpdateTimestamp: updated}}}
+	return model.SearchResult{TotalMatchesCount: 1, Articles: []model.SearchHit{hit}}, nil
+}
+
+func (f *fakeRepos) GetSearchSubscriptions(id model.UserId, page model.PageRequest) ([]model.SearchQuery, model.PageKey, error) {
+	f.roundTrip()
+	start := 0
+	if len(page.After) > 0 {
+		fmt.Sscan(page.After[0], &start)
+	}
+	end := len(f.subscriptions)
+	if page.Limit != 0 && start+int(page.Limit) < end {
+		end = start + int(page.Limit)
+	}
+	var next model.PageKey
+	if end < len(f.subscriptions) {
+		next = model.PageKey{fmt.Sprint(end)}
+	}
+	return f.subscriptions[start:end], next, nil
+}
+
+func (f *fakeRepos) GetSearchLastAccessTimestamp(userId model.UserId, query model.SearchQuery) (uint64, error) {
+	f.roundTrip()
+	return f.lastAccess[query.Query], nil
+}
+
+func (f *fakeRepos) GetSearchLastAccessTimestamps(userId model.UserId, queries []model.SearchQuery) ([]uint64, error) {
+	f.roundTrip()
+	timestamps := make([]uint64, len(queries))
+	for i, query := range queries {
+		timestamps[i] = f.lastAccess[query.Query]
+	}
+	return timestamps, nil
+}
+
+func newFakeRepos(n int) *fakeRepos {
+	f := &fakeRepos{lastAccess: make(map[string]uint64), latestUpdate: make(map[string]uint64)}
+	for i := 0; i < n; i++ {
+		query := fmt.Sprintf("query %d", i)
+		f.subscriptions = append(f.subscriptions, model.SearchQuery{Query: query})
+		f.lastAccess[query] = 100
+		// every third subscription has a match updated since it was last accessed
+		if i%3 == 0 {
+			f.latestUpdate[query] = 200
+		} else {
+			f.latestUpdate[query] = 50
+		}
+	}
+	return f
+}
+
+func (f *fakeRepos) updates() *UpdatesRepoThroughQueries {
+	return NewUpdatesRepoThroughQueries(f, nil, f)
+}
+
+func TestGetSearchSubscriptionsUpdates(t *testing.T) {
+	f := newFakeRepos(10)
+	updates, next, err := f.updates().GetSearchSubscriptionsUpdates("1", model.PageRequest{})
+	if err != nil {
+		t.Fatalf("GetSearchSubscriptionsUpdates() error = %v", err)
+	}
+	var got []string
+	for _, query := range updates {
+		got = append(got, query.Query)
+	}
+	want := []string{"query 0", "query 3", "query 6", "query 9"}
+	if fmt.Sprint(got) != fmt.Sprint(want) || next != nil {
+		t.Errorf("GetSearchSubscriptionsUpdates() = %q, %v, want %q, nil", got, next, want)
+	}
+}
+
+func BenchmarkGetSearchSubscriptionsUpdates(b *testing.B) {
+	for _, n := range []int{10, 100} {
+		b.Run(fmt.Sprintf("%d subscriptions", n), func(b *testing.B) {
+			f := newFakeRepos(n)
+			updates := f.updates()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, _, err := updates.GetSearchSubscriptionsUpdates("1", model.PageRequest{}); err != nil {
+					b.Fatal(err)
+				}
+			}
+			b.ReportMetric(float64(atomic.LoadInt32(&f.calls))/float64(b.N), "queries/op")
+		})
+	}
+}
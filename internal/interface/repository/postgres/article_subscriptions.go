@@ -5,9 +5,10 @@ import (
 	"github.com/mp-hl-2021/unarXiv/internal/domain"
 	"github.com/mp-hl-2021/unarXiv/internal/domain/model"
 	"github.com/mp-hl-2021/unarXiv/internal/interface/utils"
+	"strconv"
 	"time"
 
-	_ "github.com/lib/pq"
+	"github.com/lib/pq"
 )
 
 type ArticleSubscriptionRepo struct {
@@ -18,22 +19,36 @@ func NewArticleSubscriptionRepo(db *sql.DB) *ArticleSubscriptionRepo {
 	return &ArticleSubscriptionRepo{db: db}
 }
 
-func (a *ArticleSubscriptionRepo) GetArticleSubscriptions(id model.UserId) ([]model.ArticleId, error) {
-	rows, err := a.db.Query("SELECT ArticleId FROM AccountArticleRelations where UserId = $1;", id)
+func (a *ArticleSubscriptionRepo) GetArticleSubscriptions(id model.UserId, page model.PageRequest) ([]model.ArticleId, model.PageKey, error) {
+	after, err := pageKeyArgs(page, 1)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
+	}
+	rows, err := a.db.Query(`
+		SELECT ArticleId FROM AccountArticleRelations
+		WHERE UserId = $1 AND IsSubscribed = true AND ($2::text IS NULL OR ArticleId > $2)
+		ORDER BY ArticleId LIMIT $3;`, id, after[0], pageLimitArg(page))
+	if err != nil {
+		return nil, nil, err
 	}
 	defer rows.Close()
 	subs := []model.ArticleId{}
 	for rows.Next() {
 		var articleId model.ArticleId
 		if err := rows.Scan(&articleId); err != nil {
-			return nil, err
+			return nil, nil, err
 		} else {
 			subs = append(subs, articleId)
 		}
 	}
-	return subs, nil
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+	if !hasNextPage(page, len(subs)) {
+		return subs, nil, nil
+	}
+	subs = subs[:page.Limit]
+	return subs, model.PageKey{string(subs[len(subs)-1])}, nil
 }
 
 func (a *ArticleSubscriptionRepo) IsSubscribedForArticle(userId model.UserId, articleId model.ArticleId) (bool, error) {
@@ -62,8 +77,8 @@ func (a *ArticleSubscriptionRepo) createRelationIfNotExists(userId model.UserId,
 	}
 	if !relationExists {
 		_, err := a.db.Exec(
-			"INSERT INTO AccountArticleRelations (UserId, ArticleId, IsSubscribed, LastAccess) VALUES ($1, $2, false, $3);",
-			userId, articleId, utils.Uint64Time(time.Now()))
+			"INSERT INTO AccountArticleRelations (UserId, ArticleId, IsSubscribed, LastAccess) VALUES ($1, $2, false, NULL);",
+			userId, articleId)
 		if err != nil {
 			return err
 		}
@@ -83,7 +98,9 @@ func (a *ArticleSubscriptionRepo) SubscribeForArticle(id model.UserId, articleId
 	if err != nil {
 		return err
 	}
-	_, err = a.db.Exec("UPDATE AccountArticleRelations SET IsSubscribed = true WHERE UserId = $1 AND ArticleID = $2;", id, articleId)
+	_, err = a.db.Exec(
+		"UPDATE AccountArticleRelations SET IsSubscribed = true, SubscribedAt = $3 WHERE UserId = $1 AND ArticleID = $2;",
+		id, articleId, utils.Uint64Time(time.Now()))
 	return err
 }
 
@@ -118,29 +135,83 @@ func (a *ArticleSubscriptionRepo) GetArticleLastAccessTimestamp(userId model.Use
 	}
 	defer rows.Close()
 	for rows.Next() {
-		var lastAccess uint64
-		err := rows.Scan(&lastAccess)
-		return lastAccess, err
+		var lastAccess sql.NullInt64
+		if err := rows.Scan(&lastAccess); err != nil {
+			return 0, err
+		}
+		if !lastAccess.Valid {
+			return 0, domain.NeverAccessed
+		}
+		return uint64(lastAccess.Int64), nil
 	}
 	return 0, domain.NeverAccessed
 }
 
-func (a *ArticleSubscriptionRepo) GetArticleHistory(userId model.UserId) ([]model.ArticleId, error) {
-	rows, err := a.db.Query("SELECT ArticleId FROM AccountArticleRelations WHERE UserId = $1;", userId)
+func (a *ArticleSubscriptionRepo) GetArticleRelations(userId model.UserId, articleIds []model.ArticleId) (map[model.ArticleId]model.ArticleUserRelation, error) {
+	ids := make([]string, len(articleIds))
+	for i := range articleIds {
+		ids[i] = string(articleIds[i])
+	}
+	rows, err := a.db.Query(
+		"SELECT ArticleId, IsSubscribed, LastAccess, SubscribedAt FROM AccountArticleRelations WHERE UserId = $1 AND ArticleId = ANY($2);",
+		userId, pq.Array(ids))
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
-	result := []model.ArticleId{}
+	relations := make(map[model.ArticleId]model.ArticleUserRelation, len(articleIds))
 	for rows.Next() {
 		var articleId model.ArticleId
-		if err := rows.Scan(&articleId); err != nil {
+		var isSubscribed bool
+		var lastAccess, subscribedAt sql.NullInt64
+		if err := rows.Scan(&articleId, &isSubscribed, &lastAccess, &subscribedAt); err != nil {
 			return nil, err
+		}
+		relations[articleId] = model.ArticleUserRelation{
+			Viewed:       lastAccess.Valid,
+			LastViewedAt: uint64(lastAccess.Int64),
+			Subscribed:   isSubscribed,
+			SubscribedAt: uint64(subscribedAt.Int64),
+		}
+	}
+	return relations, rows.Err()
+}
+
+func (a *ArticleSubscriptionRepo) GetArticleHistory(userId model.UserId, page model.PageRequest) ([]model.ArticleId, model.PageKey, error) {
+	after, err := pageKeyArgs(page, 2)
+	if err != nil {
+		return nil, nil, err
+	}
+	rows, err := a.db.Query(`
+		SELECT ArticleId, LastAccess FROM AccountArticleRelations
+		WHERE UserId = $1 AND LastAccess IS NOT NULL
+			AND ($2::bigint IS NULL OR LastAccess < $2 OR (LastAccess = $2 AND ArticleId > $3))
+		ORDER BY LastAccess DESC, ArticleId LIMIT $4;`, userId, after[0], after[1], pageLimitArg(page))
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+	result := []model.ArticleId{}
+	var lastAccess []uint64
+	for rows.Next() {
+		var articleId model.ArticleId
+		var access uint64
+		if err := rows.Scan(&articleId, &access); err != nil {
+			return nil, nil, err
 		} else {
 			result = append(result, articleId)
+			lastAccess = append(lastAccess, access)
 		}
 	}
-	return result, nil
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+	if !hasNextPage(page, len(result)) {
+		return result, nil, nil
+	}
+	result = result[:page.Limit]
+	last := len(result) - 1
+	return result, model.PageKey{strconv.FormatUint(lastAccess[last], 10), string(result[last])}, nil
 }
 
 func (a *ArticleSubscriptionRepo) ClearArticleHistory(userId model.UserId) error {
@@ -0,0 +1,83 @@
+package postgres
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/mp-hl-2021/unarXiv/internal/domain/model"
+	"github.com/mp-hl-2021/unarXiv/internal/interface/utils"
+)
+
+// recordVersionQuery upserts a version, keeping known values of what is passed as null.
+const recordVersionQuery = `
+INSERT INTO ArticleVersions (ArticleId, Version, SubmittedAt, Title, Abstract, Authors, Comment, RecordedAt)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+ON CONFLICT (ArticleId, Version) DO UPDATE SET
+    SubmittedAt = coalesce(EXCLUDED.SubmittedAt, ArticleVersions.SubmittedAt),
+    Title = coalesce(EXCLUDED.Title, ArticleVersions.Title),
+    Abstract = coalesce(EXCLUDED.Abstract, ArticleVersions.Abstract),
+    Authors = coalesce(EXCLUDED.Authors, ArticleVersions.Authors),
+    Comment = coalesce(EXCLUDED.Comment, ArticleVersions.Comment),
+    RecordedAt = coalesce(EXCLUDED.RecordedAt, ArticleVersions.RecordedAt);
+`
+
+func (a *ArticleRepo) RecordArticleVersions(versions []model.ArticleVersion) error {
+	tx, err := a.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	now := utils.Uint64Time(time.Now())
+	for _, v := range versions {
+		var submittedAt, recordedAt sql.NullInt64
+		var title, abstract, comment sql.NullString
+		var authors interface{}
+		if v.SubmittedAt != 0 {
+			submittedAt = sql.NullInt64{Int64: int64(v.SubmittedAt), Valid: true}
+		}
+		if v.Recorded {
+			title = sql.NullString{String: v.Title, Valid: true}
+			abstract = sql.NullString{String: v.Abstract, Valid: true}
+			comment = sql.NullString{String: v.Comment, Valid: true}
+			authors = pq.Array(append([]string{}, v.Authors...))
+			recordedAt = sql.NullInt64{Int64: int64(now), Valid: true}
+		}
+		_, err := tx.Exec(recordVersionQuery, string(v.ArticleId), v.Version, submittedAt, title, abstract, authors, comment, recordedAt)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (a *ArticleRepo) ArticleVersions(id model.ArticleId) ([]model.ArticleVersion, error) {
+	rows, err := a.db.Query(`SELECT Version, coalesce(SubmittedAt, 0), RecordedAt IS NOT NULL,
+    coalesce(Title, ''), coalesce(Abstract, ''), coalesce(Authors, '{}'), coalesce(Comment, '')
+FROM ArticleVersions WHERE ArticleId = $1 ORDER BY Version;`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var versions []model.ArticleVersion
+	for rows.Next() {
+		v := model.ArticleVersion{ArticleId: id}
+		var authors pq.StringArray
+		if err := rows.Scan(&v.Version, &v.SubmittedAt, &v.Recorded, &v.Title, &v.Abstract, &authors, &v.Comment); err != nil {
+			return nil, err
+		}
+		v.Authors = authors
+		versions = append(versions, v)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(versions) == 0 {
+		// an article crawled before versions were tracked has none
+		if _, err := a.ArticleMetaById(id); err != nil {
+			return nil, err
+		}
+		return []model.ArticleVersion{}, nil
+	}
+	return versions, nil
+}
@@ -5,48 +5,39 @@ import (
 	"fmt"
 	"github.com/mp-hl-2021/unarXiv/internal/domain"
 	"github.com/mp-hl-2021/unarXiv/internal/domain/model"
-	// "regexp"
-	// "strings"
+	"net/url"
+	"strings"
 
-	_ "github.com/lib/pq"
+	"github.com/lib/pq"
 )
 
 type ArticleRepo struct {
-	db *sql.DB
+	db         *sql.DB
+	textSearch TextSearchConfig
 }
 
-func NewArticleRepo(db *sql.DB) *ArticleRepo {
-	return &ArticleRepo{db: db}
+func NewArticleRepo(db *sql.DB, textSearch TextSearchConfig) *ArticleRepo {
+	return &ArticleRepo{db: db, textSearch: textSearch}
 }
 
 func (a *ArticleRepo) ArticleById(id model.ArticleId) (model.Article, error) {
-	rows, err := a.db.Query("SELECT Id, Title, Abstract, LastUpdateTimestamp FROM Articles WHERE Id = $1;", id)
+	metas, err := a.ArticleMetasByIds([]model.ArticleId{id})
 	if err != nil {
 		return model.Article{}, err
 	}
-	defer rows.Close()
-	for rows.Next() {
-		var article model.Article
-		if err := rows.Scan(&article.Id, &article.Title, &article.Abstract, &article.LastUpdateTimestamp); err != nil {
-			return model.Article{}, err
-		} else {
-			rows, err := a.db.Query("SELECT AuthorName FROM AuthorsOfArticles where ArticleId = $1;", id)
-			if err != nil {
-				return model.Article{}, err
-			}
-			defer rows.Close()
-			for rows.Next() {
-				var authorName string
-				if err := rows.Scan(&authorName); err != nil {
-					return model.Article{}, err
-				} else {
-					article.Authors = append(article.Authors, authorName)
-				}
-			}
-			return article, nil
-		}
+	if len(metas) == 0 {
+		return model.Article{}, domain.ArticleNotFound
+	}
+	article := model.Article{ArticleMeta: metas[0]}
+	var fullDocumentURL string
+	err = a.db.QueryRow("SELECT coalesce(FullDocumentURL, '') FROM Articles WHERE Id = $1;", id).Scan(&fullDocumentURL)
+	if err != nil {
+		return model.Article{}, err
+	}
+	if u, err := url.Parse(fullDocumentURL); err == nil {
+		article.FullDocumentURL = *u
 	}
-	return model.Article{}, domain.ArticleNotFound
+	return article, nil
 }
 
 func (a *ArticleRepo) ArticleMetaById(id model.ArticleId) (model.ArticleMeta, error) {
@@ -54,28 +45,112 @@ func (a *ArticleRepo) ArticleMetaById(id model.ArticleId) (model.ArticleMeta, er
 	return article.ArticleMeta, err
 }
 
+// articleMetasQuery returns articles without authors and categories.
+const articleMetasQuery = `
+SELECT a.Id, a.Title, a.Abstract, a.LastUpdateTimestamp,
+    coalesce(a.SubmittedAt, 0), coalesce(a.LatestVersionAt, 0),
+    coalesce(a.DOI, ''), coalesce(a.JournalRef, ''), coalesce(a.Comments, ''), coalesce(l.URL, '')
+FROM Articles a LEFT JOIN Licenses l ON l.Id = a.LicenseId
+WHERE a.Id = ANY($1);
+`
+
+// articleListsQuery returns authors and categories of articles as rows of
+// (id, kind, value, primary), primary being set for primary categories.
+const articleListsQuery = `
+SELECT ArticleId, 'author', AuthorName, false FROM AuthorsOfArticles WHERE ArticleId = ANY($1)
+UNION ALL
+SELECT ArticleId, 'category', Category, IsPrimary FROM CategoriesOfArticles WHERE ArticleId = ANY($1);
+`
+
+func (a *ArticleRepo) ArticleMetasByIds(ids []model.ArticleId) ([]model.ArticleMeta, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	strIds := make([]string, len(ids))
+	for i := range ids {
+		strIds[i] = string(ids[i])
+	}
+	rows, err := a.db.Query(articleMetasQuery, pq.Array(strIds))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	byId := make(map[model.ArticleId]*model.ArticleMeta, len(ids))
+	for rows.Next() {
+		var article model.ArticleMeta
+		err := rows.Scan(&article.Id, &article.Title, &article.Abstract, &article.LastUpdateTimestamp,
+			&article.SubmittedAt, &article.LatestVersionAt, &article.DOI, &article.JournalRef, &article.Comments, &article.License)
+		if err != nil {
+			return nil, err
+		}
+		byId[article.Id] = &article
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	listRows, err := a.db.Query(articleListsQuery, pq.Array(strIds))
+	if err != nil {
+		return nil, err
+	}
+	defer listRows.Close()
+	for listRows.Next() {
+		var id model.ArticleId
+		var kind, value string
+		var primary bool
+		if err := listRows.Scan(&id, &kind, &value, &primary); err != nil {
+			return nil, err
+		}
+		article, ok := byId[id]
+		if !ok {
+			continue
+		}
+		switch {
+		case kind == "author":
+			article.Authors = append(article.Authors, value)
+		case primary:
+			article.Categories = append([]string{value}, article.Categories...)
+		default:
+			article.Categories = append(article.Categories, value)
+		}
+	}
+	if err := listRows.Err(); err != nil {
+		return nil, err
+	}
+
+	result := make([]model.ArticleMeta, 0, len(byId))
+	for _, id := range ids {
+		if article, ok := byId[id]; ok {
+			result = append(result, *article)
+		}
+	}
+	return result, nil
+}
+
 func (a *ArticleRepo) UpdateArticle(article model.Article) error {
 	tx, err := a.db.Begin()
 	defer tx.Rollback()
 	if err != nil {
 		return err
 	}
+	licenseId, err := upsertLicense(tx, article.License)
+	if err != nil {
+		return err
+	}
 	_, err = a.ArticleById(article.Id)
 	if err != nil {
-		_, err = tx.Exec("INSERT INTO Articles (Id, Title, Abstract, LastUpdateTimestamp, FullDocumentURL) VALUES ($1, $2, $3, $4, $5);", string(article.ArticleMeta.Id), article.ArticleMeta.Title, article.ArticleMeta.Abstract, article.LastUpdateTimestamp, article.FullDocumentURL.String())
-		if err != nil {
-			return err
-		}
-		_, err = tx.Exec("INSERT INTO ArticlesFTS (Id, TextData) VALUES ($1, to_tsvector($2))", string(article.ArticleMeta.Id), fmt.Sprint(article))
+		_, err = tx.Exec(`INSERT INTO Articles (Id, Title, Abstract, LastUpdateTimestamp, FullDocumentURL,
+    SubmittedAt, LatestVersionAt, DOI, JournalRef, Comments, LicenseId) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11);`,
+			string(article.ArticleMeta.Id), article.ArticleMeta.Title, article.ArticleMeta.Abstract, article.LastUpdateTimestamp, article.FullDocumentURL.String(),
+			article.SubmittedAt, article.LatestVersionAt, article.DOI, article.JournalRef, article.Comments, licenseId)
 		if err != nil {
 			return err
 		}
 	} else {
-		_, err = tx.Exec("UPDATE Articles SET Title = $1, Abstract = $2, LastUpdateTimestamp = $3, FullDocumentURL = $4 WHERE Id = $5;", article.ArticleMeta.Title, article.ArticleMeta.Abstract, article.LastUpdateTimestamp, article.FullDocumentURL.String(), article.ArticleMeta.Id)
-		if err != nil {
-			return err
-		}
-		_, err = tx.Exec("UPDATE ArticlesFTS SET TextData = to_tsvector($1)", fmt.Sprint(article))
+		_, err = tx.Exec(`UPDATE Articles SET Title = $1, Abstract = $2, LastUpdateTimestamp = $3, FullDocumentURL = $4,
+    SubmittedAt = $5, LatestVersionAt = $6, DOI = $7, JournalRef = $8, Comments = $9, LicenseId = $10 WHERE Id = $11;`,
+			article.ArticleMeta.Title, article.ArticleMeta.Abstract, article.LastUpdateTimestamp, article.FullDocumentURL.String(),
+			article.SubmittedAt, article.LatestVersionAt, article.DOI, article.JournalRef, article.Comments, licenseId, article.ArticleMeta.Id)
 		if err != nil {
 			return err
 		}
@@ -93,6 +168,27 @@ func (a *ArticleRepo) UpdateArticle(article model.Article) error {
 		}
 	}
 
+	_, err = tx.Exec("DELETE FROM CategoriesOfArticles WHERE ArticleId = $1;", article.ArticleMeta.Id)
+	if err != nil {
+		return err
+	}
+
+	for i, category := range article.ArticleMeta.Categories {
+		_, err = tx.Exec("INSERT INTO CategoriesOfArticles (ArticleId, Category, IsPrimary) VALUES ($1, $2, $3);", article.ArticleMeta.Id, category, i == 0)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = a.indexArticles(tx, []indexedArticle{{
+		id:       string(article.Id),
+		title:    article.Title,
+		abstract: article.Abstract,
+	}})
+	if err != nil {
+		return err
+	}
+
 	err = tx.Commit()
 	if err != nil {
 		return err
@@ -100,48 +196,177 @@ func (a *ArticleRepo) UpdateArticle(article model.Article) error {
 	return nil
 }
 
+// upsertLicense returns the id of a license URL, adding it if it is new, and null for no license.
+func upsertLicense(tx *sql.Tx, license string) (sql.NullInt64, error) {
+	if license == "" {
+		return sql.NullInt64{}, nil
+	}
+	var id sql.NullInt64
+	err := tx.QueryRow("INSERT INTO Licenses (URL) VALUES ($1) ON CONFLICT (URL) DO UPDATE SET URL = EXCLUDED.URL RETURNING Id;", license).Scan(&id)
+	return id, err
+}
+
+// searchQueryTotalMatchesCount returns rows of (facet, value, count), the total
+// count of matches being the 'total' facet. Requested facets are appended to it.
 const searchQueryTotalMatchesCount = `
-SELECT COUNT(*)
-FROM ArticlesFTS
-WHERE TextData @@ plainto_tsquery($1);
+WITH Matched AS (
+    SELECT a.Id, a.LastUpdateTimestamp
+    FROM Articles a JOIN ArticlesFTS f ON f.Id = a.Id
+    WHERE %s
+)
+SELECT 'total', '', COUNT(*) FROM Matched
+%s;
 `
+
+const searchFacetLimit = 10
+
+var searchFacetQueries = map[model.SearchFacet]string{
+	model.AuthorsFacet: `
+UNION ALL (
+    SELECT 'authors', au.AuthorName, COUNT(*)
+    FROM Matched m JOIN AuthorsOfArticles au ON au.ArticleId = m.Id
+    GROUP BY au.AuthorName ORDER BY COUNT(*) DESC, au.AuthorName LIMIT %[1]d
+)`,
+	model.CategoriesFacet: `
+UNION ALL (
+    SELECT 'categories', ca.Category, COUNT(*)
+    FROM Matched m JOIN CategoriesOfArticles ca ON ca.ArticleId = m.Id
+    GROUP BY ca.Category ORDER BY COUNT(*) DESC, ca.Category LIMIT %[1]d
+)`,
+	model.YearsFacet: `
+UNION ALL (
+    SELECT 'years', EXTRACT(YEAR FROM to_timestamp(m.LastUpdateTimestamp / 1e9))::int::text, COUNT(*)
+    FROM Matched m
+    WHERE m.LastUpdateTimestamp IS NOT NULL
+    GROUP BY 2 ORDER BY 2
+)`,
+}
+
+func (a *ArticleRepo) searchTotals(compiled compiledSearch, facets []model.SearchFacet) (uint32, *model.SearchFacets, error) {
+	var facetQueries strings.Builder
+	for _, facet := range facets {
+		q, ok := searchFacetQueries[facet]
+		if !ok {
+			return 0, nil, fmt.Errorf("unknown facet %q", facet)
+		}
+		facetQueries.WriteString(fmt.Sprintf(q, searchFacetLimit))
+	}
+	rows, err := a.db.Query(fmt.Sprintf(searchQueryTotalMatchesCount, compiled.where, facetQueries.String()), compiled.args...)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer rows.Close()
+	var total uint32
+	var result *model.SearchFacets
+	if len(facets) != 0 {
+		result = &model.SearchFacets{}
+	}
+	for rows.Next() {
+		var bucket model.FacetBucket
+		var facet string
+		if err := rows.Scan(&facet, &bucket.Value, &bucket.Count); err != nil {
+			return 0, nil, err
+		}
+		switch model.SearchFacet(facet) {
+		case model.AuthorsFacet:
+			result.Authors = append(result.Authors, bucket)
+		case model.CategoriesFacet:
+			result.Categories = append(result.Categories, bucket)
+		case model.YearsFacet:
+			result.Years = append(result.Years, bucket)
+		default:
+			total = bucket.Count
+		}
+	}
+	return total, result, rows.Err()
+}
+
 const searchQuery = `
-SELECT Id, ts_rank(TextData, plainto_tsquery($1))
-FROM ArticlesFTS
-WHERE TextData @@ plainto_tsquery($1)
-ORDER BY ts_rank(TextData, plainto_tsquery($1)) DESC
-LIMIT $2 OFFSET $3;
+SELECT a.Id, a.Title, coalesce(a.LastUpdateTimestamp, 0), %s AS Rank, %s, %s
+FROM Articles a JOIN ArticlesFTS f ON f.Id = a.Id
+WHERE %s
+ORDER BY %s
+LIMIT %s OFFSET %s;
 `
 
-func (a *ArticleRepo) Search(query model.SearchQuery, limit uint32) (model.SearchResult, error) { // TODO
-	totalMatchesQ := a.db.QueryRow(searchQueryTotalMatchesCount, query.Query)
-	var totalMatches int
-	if err := totalMatchesQ.Scan(&totalMatches); err != nil {
+func (a *ArticleRepo) Search(query model.SearchQuery) (model.SearchResult, error) {
+	compiled, err := compileSearch(query, a.textSearch.configs())
+	if err != nil {
+		return model.SearchResult{}, err
+	}
+	totalMatches, facets, err := a.searchTotals(compiled, query.Facets)
+	if err != nil {
 		return model.SearchResult{}, err
 	}
 	resp := model.SearchResult{
-		TotalMatchesCount: uint32(totalMatches),
+		TotalMatchesCount: totalMatches,
 		Articles:          nil,
+		Facets:            facets,
+	}
+	where := compiled.where
+	after, err := compiled.afterCondition(query.SortOrder, query.Page.After)
+	if err != nil {
+		return model.SearchResult{}, err
 	}
-	if limit == 0 {
-		limit = 1e9
+	if after != "" {
+		where += " AND " + after
 	}
-	rows, err := a.db.Query(searchQuery, query.Query, limit, query.Offset)
+	titleHeadline, abstractHeadline := compiled.headlineExprs(query.Highlight)
+	args := compiled.args
+	q := fmt.Sprintf(searchQuery, compiled.rankExpr(), titleHeadline, abstractHeadline,
+		where, compiled.orderBy, args.add(pageLimitArg(query.Page)), args.add(query.Offset))
+	rows, err := a.db.Query(q, args...)
 	if err != nil {
 		return resp, err
 	}
 	defer rows.Close()
+	var ids []model.ArticleId
+	var ranks []float64
+	// keys of the rows, so that the next page follows the last row even if
+	// its article was deleted before its meta was loaded
+	var keys []model.ArticleMeta
 	for rows.Next() {
-		var aid string
+		var key model.ArticleMeta
 		var rank float64
-		if err := rows.Scan(&aid, &rank); err != nil {
+		var titleHl, abstractHl sql.NullString
+		if err := rows.Scan(&key.Id, &key.Title, &key.LastUpdateTimestamp, &rank, &titleHl, &abstractHl); err != nil {
 			return resp, err
 		}
-		article, err := a.ArticleById(model.ArticleId(aid))
-		if err != nil {
-			return resp, err
+		hit := model.SearchHit{}
+		if titleHl.Valid {
+			hit.Highlights = &model.SearchHighlights{
+				Title:    titleHl.String,
+				Abstract: abstractHl.String,
+			}
+		}
+		resp.Articles = append(resp.Articles, hit)
+		ids = append(ids, key.Id)
+		ranks = append(ranks, rank)
+		keys = append(keys, key)
+	}
+	if err := rows.Err(); err != nil {
+		return resp, err
+	}
+	more := hasNextPage(query.Page, len(ids))
+	if more {
+		resp.Articles, ids = resp.Articles[:query.Page.Limit], ids[:query.Page.Limit]
+		last := query.Page.Limit - 1
+		resp.Next = searchPageKey(query.SortOrder, ranks[last], keys[last])
+	}
+	metas, err := a.ArticleMetasByIds(ids)
+	if err != nil {
+		return resp, err
+	}
+	// articles deleted while searching are left out, making the page shorter
+	hits := resp.Articles[:0]
+	for i, j := 0, 0; i < len(ids) && j < len(metas); i++ {
+		if metas[j].Id != ids[i] {
+			continue
 		}
-		resp.Articles = append(resp.Articles, article.ArticleMeta)
+		resp.Articles[i].ArticleMeta = metas[j]
+		hits = append(hits, resp.Articles[i])
+		j++
 	}
+	resp.Articles = hits
 	return resp, nil
 }
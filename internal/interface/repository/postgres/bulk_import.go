@@ -0,0 +1,201 @@
+package postgres
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/mp-hl-2021/unarXiv/internal/domain/model"
+	"github.com/mp-hl-2021/unarXiv/internal/interface/utils"
+)
+
+// mergeImportedLicensesQuery adds licenses of staged articles that are new.
+const mergeImportedLicensesQuery = `
+INSERT INTO Licenses (URL)
+SELECT DISTINCT License FROM import_articles WHERE License <> ''
+ON CONFLICT (URL) DO NOTHING;
+`
+
+// mergeImportedArticlesQuery moves staged articles into Articles, replacing
+// existing ones unless they have a later version than the staged ones, as
+// when an older snapshot is imported after the crawler updated an article.
+// It returns ids of the articles it wrote.
+const mergeImportedArticlesQuery = `
+INSERT INTO Articles (Id, Title, Abstract, LastUpdateTimestamp, FullDocumentURL,
+    SubmittedAt, LatestVersionAt, DOI, JournalRef, Comments, LicenseId)
+SELECT i.Id, i.Title, i.Abstract, i.LastUpdateTimestamp, i.FullDocumentURL,
+    i.SubmittedAt, i.LatestVersionAt, i.DOI, i.JournalRef, i.Comments, l.Id
+FROM import_articles i LEFT JOIN Licenses l ON l.URL = i.License
+ON CONFLICT (Id) DO UPDATE SET Title = EXCLUDED.Title, Abstract = EXCLUDED.Abstract,
+    LastUpdateTimestamp = EXCLUDED.LastUpdateTimestamp, FullDocumentURL = EXCLUDED.FullDocumentURL,
+    SubmittedAt = EXCLUDED.SubmittedAt, LatestVersionAt = EXCLUDED.LatestVersionAt, DOI = EXCLUDED.DOI,
+    JournalRef = EXCLUDED.JournalRef, Comments = EXCLUDED.Comments, LicenseId = EXCLUDED.LicenseId
+WHERE Articles.LatestVersionAt IS NULL OR EXCLUDED.LatestVersionAt >= Articles.LatestVersionAt
+RETURNING Id;
+`
+
+// ImportProgress returns the number of lines of a source already imported.
+func (a *ArticleRepo) ImportProgress(source string) (int64, error) {
+	var lines int64
+	err := a.db.QueryRow("SELECT Lines FROM ImportProgress WHERE Source = $1;", source).Scan(&lines)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	return lines, err
+}
+
+// ImportArticles writes a batch of articles with COPY and records that the
+// source is imported up to the given line, both in one transaction, so an
+// interrupted import resumes after the last complete batch.
+func (a *ArticleRepo) ImportArticles(source string, lines int64, articles []model.Article) error {
+	articles = lastOfEachId(articles)
+	tx, err := a.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("CREATE TEMP TABLE import_articles (LIKE Articles, License text) ON COMMIT DROP;"); err != nil {
+		return err
+	}
+	columns := []string{"id", "title", "abstract", "lastupdatetimestamp", "fulldocumenturl",
+		"submittedat", "latestversionat", "doi", "journalref", "comments", "license"}
+	err = copyRows(tx, pq.CopyIn("import_articles", columns...), func(row func(...interface{}) error) error {
+		for _, article := range articles {
+			err := row(string(article.Id), article.Title, article.Abstract, int64(article.LastUpdateTimestamp), article.FullDocumentURL.String(),
+				int64(article.SubmittedAt), int64(article.LatestVersionAt), article.DOI, article.JournalRef, article.Comments, article.License)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec(mergeImportedLicensesQuery); err != nil {
+		return err
+	}
+	merged, err := mergedArticles(tx, articles)
+	if err != nil {
+		return err
+	}
+	// articles that were not written keep their authors, categories and index entries
+	articles = merged
+
+	ids := make([]string, len(articles))
+	indexed := make([]indexedArticle, len(articles))
+	for i, article := range articles {
+		ids[i] = string(article.Id)
+		indexed[i] = indexedArticle{id: ids[i], title: article.Title, abstract: article.Abstract}
+	}
+	if _, err := tx.Exec("DELETE FROM AuthorsOfArticles WHERE ArticleId = ANY($1);", pq.Array(ids)); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM CategoriesOfArticles WHERE ArticleId = ANY($1);", pq.Array(ids)); err != nil {
+		return err
+	}
+	err = copyRows(tx, pq.CopyIn("authorsofarticles", "articleid", "authorname"), func(row func(...interface{}) error) error {
+		for _, article := range articles {
+			for _, author := range article.Authors {
+				if err := row(string(article.Id), author); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	err = copyRows(tx, pq.CopyIn("categoriesofarticles", "articleid", "category", "isprimary"), func(row func(...interface{}) error) error {
+		for _, article := range articles {
+			for i, category := range article.Categories {
+				if err := row(string(article.Id), category, i == 0); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if err := a.indexArticles(tx, indexed); err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`INSERT INTO ImportProgress (Source, Lines, UpdatedAt) VALUES ($1, $2, $3)
+ON CONFLICT (Source) DO UPDATE SET Lines = EXCLUDED.Lines, UpdatedAt = EXCLUDED.UpdatedAt;`,
+		source, lines, utils.Uint64Time(time.Now()))
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// mergedArticles runs mergeImportedArticlesQuery and returns those of
+// articles it wrote.
+func mergedArticles(tx *sql.Tx, articles []model.Article) ([]model.Article, error) {
+	rows, err := tx.Query(mergeImportedArticlesQuery)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	written := make(map[model.ArticleId]bool, len(articles))
+	for rows.Next() {
+		var id model.ArticleId
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		written[id] = true
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	result := make([]model.Article, 0, len(written))
+	for _, article := range articles {
+		if written[article.Id] {
+			result = append(result, article)
+		}
+	}
+	return result, nil
+}
+
+// copyRows runs a COPY statement, write calling row for every row to copy.
+func copyRows(tx *sql.Tx, query string, write func(row func(...interface{}) error) error) error {
+	stmt, err := tx.Prepare(query)
+	if err != nil {
+		return err
+	}
+	err = write(func(values ...interface{}) error {
+		_, err := stmt.Exec(values...)
+		return err
+	})
+	if err == nil {
+		_, err = stmt.Exec()
+	}
+	if closeErr := stmt.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// lastOfEachId drops all but the last article with the same id, as a row
+// cannot be upserted twice by one statement.
+func lastOfEachId(articles []model.Article) []model.Article {
+	last := make(map[model.ArticleId]int, len(articles))
+	for i, article := range articles {
+		last[article.Id] = i
+	}
+	if len(last) == len(articles) {
+		return articles
+	}
+	result := make([]model.Article, 0, len(last))
+	for i, article := range articles {
+		if last[article.Id] == i {
+			result = append(result, article)
+		}
+	}
+	return result
+}
@@ -0,0 +1,79 @@
+package postgres
+
+import (
+	"database/sql"
+
+	"github.com/mp-hl-2021/unarXiv/internal/domain/model"
+)
+
+type LexiconRepo struct {
+	db *sql.DB
+}
+
+func NewLexiconRepo(db *sql.DB) *LexiconRepo {
+	return &LexiconRepo{db: db}
+}
+
+// Words are counted in the LexiconWords view with the 'simple' configuration
+// rather than taken from ArticlesFTS: stemmed lexemes of the index are not
+// what users type. Counting scans all articles, so it is only done by RefreshWords.
+const (
+	titleTermsQuery = `
+SELECT Word, TitleCount FROM LexiconWords
+WHERE TitleCount > 0
+ORDER BY TitleCount DESC, Word
+LIMIT $1;
+`
+	wordsQuery = `
+SELECT Word, Count FROM LexiconWords
+ORDER BY Count DESC, Word
+LIMIT $1;
+`
+	popularQueriesQuery = `
+SELECT Search, COUNT(DISTINCT UserId)
+FROM AccountSearchRelations
+WHERE Search ILIKE $1
+GROUP BY Search
+HAVING COUNT(DISTINCT UserId) >= $3
+ORDER BY COUNT(DISTINCT UserId) DESC, Search
+LIMIT $2;
+`
+)
+
+// minPopularQueryUsers keeps searches of single users out of suggestions,
+// which anyone can request.
+const minPopularQueryUsers = 5
+
+func (l *LexiconRepo) TitleTerms(limit uint32) ([]model.TermFrequency, error) {
+	return l.termFrequencies(titleTermsQuery, limit)
+}
+
+func (l *LexiconRepo) Words(limit uint32) ([]model.TermFrequency, error) {
+	return l.termFrequencies(wordsQuery, limit)
+}
+
+func (l *LexiconRepo) RefreshWords() error {
+	_, err := l.db.Exec("REFRESH MATERIALIZED VIEW CONCURRENTLY LexiconWords;")
+	return err
+}
+
+func (l *LexiconRepo) PopularQueries(prefix string, limit uint32) ([]model.TermFrequency, error) {
+	return l.termFrequencies(popularQueriesQuery, escapeLike(prefix)+"%", limit, minPopularQueryUsers)
+}
+
+func (l *LexiconRepo) termFrequencies(query string, args ...interface{}) ([]model.TermFrequency, error) {
+	rows, err := l.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var result []model.TermFrequency
+	for rows.Next() {
+		var tf model.TermFrequency
+		if err := rows.Scan(&tf.Term, &tf.Count); err != nil {
+			return nil, err
+		}
+		result = append(result, tf)
+	}
+	return result, rows.Err()
+}
@@ -0,0 +1,36 @@
+package postgres
+
+import (
+	"github.com/mp-hl-2021/unarXiv/internal/domain"
+	"github.com/mp-hl-2021/unarXiv/internal/domain/model"
+)
+
+// pageLimitArg is the LIMIT argument for a page. One extra row is fetched to
+// tell whether there is a next page. NULL means no limit.
+func pageLimitArg(page model.PageRequest) interface{} {
+	if page.Limit == 0 {
+		return nil
+	}
+	return int64(page.Limit) + 1
+}
+
+// hasNextPage reports whether n fetched rows include the extra row past the page.
+func hasNextPage(page model.PageRequest, n int) bool {
+	return page.Limit != 0 && n > int(page.Limit)
+}
+
+// pageKeyArgs returns the components of page.After as query arguments,
+// all of them NULL for the first page.
+func pageKeyArgs(page model.PageRequest, n int) ([]interface{}, error) {
+	args := make([]interface{}, n)
+	if len(page.After) == 0 {
+		return args, nil
+	}
+	if len(page.After) != n {
+		return nil, domain.InvalidPageKey
+	}
+	for i := range page.After {
+		args[i] = page.After[i]
+	}
+	return args, nil
+}
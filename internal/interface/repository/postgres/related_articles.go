@@ -0,0 +1,120 @@
+package postgres
+
+import (
+	"database/sql"
+	"strings"
+
+	"github.com/mp-hl-2021/unarXiv/internal/domain"
+	"github.com/mp-hl-2021/unarXiv/internal/domain/model"
+)
+
+const (
+	// relatedLexemeCount is how many of the most frequent lexemes of an article
+	// are used to look for similar ones.
+	relatedLexemeCount = 32
+	// relatedAuthorsWeight is the score bonus of an article written by
+	// all the authors of the source article.
+	relatedAuthorsWeight = 0.5
+)
+
+// relatedLexemesQuery returns the most frequent lexemes of an article, a single NULL
+// if it has none and no rows if there is no such article.
+const relatedLexemesQuery = `
+SELECT v.lexeme
+FROM Articles a
+LEFT JOIN ArticlesFTS f ON f.Id = a.Id
+LEFT JOIN LATERAL unnest(f.TextData) v ON true
+WHERE a.Id = $1
+ORDER BY coalesce(array_length(v.positions, 1), 1) DESC, v.lexeme
+LIMIT $2;
+`
+
+// relatedArticlesQuery scores articles by the rank of their index against the source
+// lexemes, normalized to [0, 1), plus a bonus for the share of source authors.
+// Lexemes are already normalized, so the query is built with the 'simple' configuration.
+const relatedArticlesQuery = `
+WITH SourceAuthors AS (
+    SELECT AuthorName FROM AuthorsOfArticles WHERE ArticleId = $1
+)
+SELECT f.Id,
+    ts_rank(f.TextData, to_tsquery('simple', $2), 32)
+    + $3::real * (
+        SELECT COUNT(*) FROM AuthorsOfArticles au
+        WHERE au.ArticleId = f.Id AND au.AuthorName IN (SELECT AuthorName FROM SourceAuthors)
+    )::real / GREATEST((SELECT COUNT(*) FROM SourceAuthors), 1) AS Score
+FROM ArticlesFTS f
+WHERE f.Id <> $1 AND (
+    f.TextData @@ to_tsquery('simple', $2)
+    OR f.Id IN (SELECT au.ArticleId FROM AuthorsOfArticles au JOIN SourceAuthors s ON s.AuthorName = au.AuthorName)
+)
+ORDER BY Score DESC, f.Id
+LIMIT $4;
+`
+
+func (a *ArticleRepo) relatedLexemes(id model.ArticleId) ([]string, error) {
+	rows, err := a.db.Query(relatedLexemesQuery, id, relatedLexemeCount)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	found := false
+	var lexemes []string
+	for rows.Next() {
+		found = true
+		var lexeme sql.NullString
+		if err := rows.Scan(&lexeme); err != nil {
+			return nil, err
+		}
+		if lexeme.Valid {
+			lexemes = append(lexemes, lexeme.String)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, domain.ArticleNotFound
+	}
+	return lexemes, nil
+}
+
+func (a *ArticleRepo) RelatedArticles(id model.ArticleId, limit uint32) ([]model.RelatedArticle, error) {
+	lexemes, err := a.relatedLexemes(id)
+	if err != nil {
+		return nil, err
+	}
+	for i := range lexemes {
+		lexemes[i] = quoteLexeme(lexemes[i])
+	}
+	rows, err := a.db.Query(relatedArticlesQuery, id, strings.Join(lexemes, " | "), relatedAuthorsWeight, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var ids []model.ArticleId
+	scores := make(map[model.ArticleId]float64)
+	for rows.Next() {
+		var aid model.ArticleId
+		var score float64
+		if err := rows.Scan(&aid, &score); err != nil {
+			return nil, err
+		}
+		ids = append(ids, aid)
+		scores[aid] = score
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	metas, err := a.ArticleMetasByIds(ids)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]model.RelatedArticle, len(metas))
+	for i := range metas {
+		result[i] = model.RelatedArticle{
+			UserArticleMeta: model.UserArticleMeta{ArticleMeta: metas[i]},
+			Score:           scores[metas[i].Id],
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,227 @@
+package postgres
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/mp-hl-2021/unarXiv/internal/domain"
+	"github.com/mp-hl-2021/unarXiv/internal/domain/model"
+	"github.com/mp-hl-2021/unarXiv/internal/domain/searchquery"
+)
+
+// queryArgs collects positional parameters of a dynamically built query.
+type queryArgs []interface{}
+
+func (q *queryArgs) add(v interface{}) string {
+	*q = append(*q, v)
+	return fmt.Sprintf("$%d", len(*q))
+}
+
+// compiledSearch is a search query translated to SQL over
+// "Articles a JOIN ArticlesFTS f ON f.Id = a.Id".
+type compiledSearch struct {
+	where string
+	// rank is a tsquery expression built from the positive full-text terms,
+	// empty if the query has none.
+	rank    string
+	orderBy string
+	args    queryArgs
+	// configs are text search configurations terms are normalized with.
+	configs     []string
+	includeBody bool
+}
+
+var searchOrderBy = map[model.SearchSortOrder]string{
+	"":                    "Rank DESC, a.Id",
+	model.SortByRelevance: "Rank DESC, a.Id",
+	model.SortByNewest:    "a.LastUpdateTimestamp DESC, a.Id",
+	model.SortByOldest:    "a.LastUpdateTimestamp, a.Id",
+	model.SortByTitle:     "a.Title, a.Id",
+}
+
+func compileSearch(query model.SearchQuery, configs []string) (compiledSearch, error) {
+	root, err := searchquery.Parse(query.Query)
+	if err != nil {
+		return compiledSearch{}, err
+	}
+	c := compiledSearch{configs: configs, includeBody: query.IncludeBody}
+	var ok bool
+	if c.orderBy, ok = searchOrderBy[query.SortOrder]; !ok {
+		return compiledSearch{}, fmt.Errorf("unknown sort order %q", query.SortOrder)
+	}
+	conditions := []string{c.compileNode(root)}
+	if f := query.Filters; f.UpdatedAfter != 0 {
+		conditions = append(conditions, "a.LastUpdateTimestamp >= "+c.args.add(f.UpdatedAfter))
+	}
+	if f := query.Filters; f.UpdatedBefore != 0 {
+		conditions = append(conditions, "a.LastUpdateTimestamp < "+c.args.add(f.UpdatedBefore))
+	}
+	if query.Filters.Author != "" {
+		conditions = append(conditions, c.authorCondition(query.Filters.Author))
+	}
+	if query.Filters.Category != "" {
+		conditions = append(conditions, c.categoryCondition(escapeLike(query.Filters.Category)))
+	}
+	c.where = strings.Join(conditions, " AND ")
+
+	var rankQueries []string
+	for _, term := range searchquery.PositiveTerms(root) {
+		if term.Field.IsText() {
+			rankQueries = append(rankQueries, c.tsquery(term))
+		}
+	}
+	c.rank = strings.Join(rankQueries, " || ")
+	return c, nil
+}
+
+func (c *compiledSearch) rankExpr() string {
+	if c.rank == "" {
+		return "0"
+	}
+	if c.includeBody {
+		return fmt.Sprintf("ts_rank(f.TextData || coalesce(f.BodyData, ''), %s)", c.rank)
+	}
+	return fmt.Sprintf("ts_rank(f.TextData, %s)", c.rank)
+}
+
+// afterCondition restricts matches to those following the page key in the sort order.
+// Keys are (rank, id), (timestamp, id) or (title, id) depending on the sort order.
+func (c *compiledSearch) afterCondition(sort model.SearchSortOrder, key model.PageKey) (string, error) {
+	if len(key) == 0 {
+		return "", nil
+	}
+	if len(key) != 2 {
+		return "", domain.InvalidPageKey
+	}
+	value, id := c.args.add(key[0]), c.args.add(key[1])
+	switch sort {
+	case model.SortByNewest:
+		return fmt.Sprintf("(a.LastUpdateTimestamp < %[1]s::bigint OR (a.LastUpdateTimestamp = %[1]s::bigint AND a.Id > %[2]s))", value, id), nil
+	case model.SortByOldest:
+		return fmt.Sprintf("(a.LastUpdateTimestamp > %[1]s::bigint OR (a.LastUpdateTimestamp = %[1]s::bigint AND a.Id > %[2]s))", value, id), nil
+	case model.SortByTitle:
+		return fmt.Sprintf("(a.Title, a.Id) > (%s, %s)", value, id), nil
+	}
+	rank := c.rankExpr()
+	return fmt.Sprintf("(%[1]s < %[2]s::real OR (%[1]s = %[2]s::real AND a.Id > %[3]s))", rank, value, id), nil
+}
+
+// searchPageKey is the key of a hit for afterCondition.
+func searchPageKey(sort model.SearchSortOrder, rank float64, article model.ArticleMeta) model.PageKey {
+	switch sort {
+	case model.SortByNewest, model.SortByOldest:
+		return model.PageKey{strconv.FormatUint(article.LastUpdateTimestamp, 10), string(article.Id)}
+	case model.SortByTitle:
+		return model.PageKey{article.Title, string(article.Id)}
+	}
+	// ts_rank is real, so the shortest float32 representation survives the round trip
+	return model.PageKey{strconv.FormatFloat(rank, 'g', -1, 32), string(article.Id)}
+}
+
+// headlineExprs returns expressions for highlighted title and abstract,
+// NULL if highlighting is not requested or there is nothing to highlight.
+func (c *compiledSearch) headlineExprs(opts *model.HighlightOptions) (title, abstract string) {
+	if opts == nil || c.rank == "" {
+		return "NULL", "NULL"
+	}
+	sel := fmt.Sprintf(`StartSel="%s", StopSel="%s"`, opts.StartSel, opts.StopSel)
+	title = fmt.Sprintf("ts_headline(f.Config, a.Title, %s, %s)", c.rank, c.args.add(sel+", HighlightAll=true"))
+	abstract = fmt.Sprintf("ts_headline(f.Config, a.Abstract, %s, %s)", c.rank, c.args.add(fmt.Sprintf("%s, MaxFragments=%d", sel, opts.MaxFragments)))
+	return title, abstract
+}
+
+func (c *compiledSearch) compileNode(n searchquery.Node) string {
+	switch n := n.(type) {
+	case searchquery.And:
+		return c.joinNodes(n.Operands, " AND ")
+	case searchquery.Or:
+		return c.joinNodes(n.Operands, " OR ")
+	case searchquery.Not:
+		return "NOT (" + c.compileNode(n.Operand) + ")"
+	case searchquery.Term:
+		return c.compileTerm(n)
+	}
+	panic(fmt.Sprintf("unexpected search query node %T", n))
+}
+
+func (c *compiledSearch) joinNodes(nodes []searchquery.Node, sep string) string {
+	parts := make([]string, len(nodes))
+	for i := range nodes {
+		parts[i] = c.compileNode(nodes[i])
+	}
+	return "(" + strings.Join(parts, sep) + ")"
+}
+
+func (c *compiledSearch) compileTerm(t searchquery.Term) string {
+	switch t.Field {
+	case searchquery.TitleField:
+		// the unfiltered match lets the GIN index narrow down the articles to filter
+		return fmt.Sprintf("(f.TextData @@ %[1]s AND ts_filter(f.TextData, '{a}') @@ %[1]s)", c.tsquery(t))
+	case searchquery.AbstractField:
+		return fmt.Sprintf("(f.TextData @@ %[1]s AND ts_filter(f.TextData, '{c}') @@ %[1]s)", c.tsquery(t))
+	case searchquery.AuthorField:
+		return c.authorCondition(t.Text)
+	case searchquery.IdField:
+		if t.Prefix {
+			return fmt.Sprintf("a.Id LIKE %s", c.args.add(escapeLike(t.Text)+"%"))
+		}
+		return fmt.Sprintf("a.Id = %s", c.args.add(t.Text))
+	case searchquery.CategoryField:
+		pattern := escapeLike(t.Text)
+		if t.Prefix {
+			pattern += "%"
+		}
+		return c.categoryCondition(pattern)
+	}
+	q := c.tsquery(t)
+	if c.includeBody {
+		return fmt.Sprintf("(f.TextData @@ %[1]s OR f.BodyData @@ %[1]s)", q)
+	}
+	return fmt.Sprintf("f.TextData @@ %s", q)
+}
+
+// authorCondition matches articles with an author whose name contains name.
+func (c *compiledSearch) authorCondition(name string) string {
+	return fmt.Sprintf(
+		"EXISTS (SELECT 1 FROM AuthorsOfArticles au WHERE au.ArticleId = a.Id AND au.AuthorName ILIKE %s)",
+		c.args.add("%"+escapeLike(name)+"%"))
+}
+
+// categoryCondition matches articles with a category matching the LIKE pattern.
+func (c *compiledSearch) categoryCondition(pattern string) string {
+	return fmt.Sprintf(
+		"EXISTS (SELECT 1 FROM CategoriesOfArticles ca WHERE ca.ArticleId = a.Id AND ca.Category ILIKE %s)",
+		c.args.add(pattern))
+}
+
+// tsquery matches the term normalized with any of the configurations, as the
+// index of each article is built with its own one.
+func (c *compiledSearch) tsquery(t searchquery.Term) string {
+	function, text := "plainto_tsquery", t.Text
+	switch {
+	case t.Phrase:
+		function = "phraseto_tsquery"
+	case t.Prefix:
+		function, text = "to_tsquery", quoteLexeme(t.Text)+":*"
+	}
+	arg := c.args.add(text)
+	queries := make([]string, len(c.configs))
+	for i, config := range c.configs {
+		queries[i] = fmt.Sprintf("%s('%s', %s)", function, config, arg)
+	}
+	if len(queries) == 1 {
+		return queries[0]
+	}
+	return "(" + strings.Join(queries, " || ") + ")"
+}
+
+// quoteLexeme quotes s so that to_tsquery treats it as a single operand.
+func quoteLexeme(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
+
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
@@ -0,0 +1,36 @@
+package postgres
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/mp-hl-2021/unarXiv/internal/domain/model"
+)
+
+func TestCompileSearchIncludeBody(t *testing.T) {
+	tests := []struct {
+		name        string
+		query       string
+		includeBody bool
+		wantBody    bool
+	}{
+		{name: "body excluded", query: "transformer", includeBody: false, wantBody: false},
+		{name: "body included", query: "transformer", includeBody: true, wantBody: true},
+		// fields never match the body
+		{name: "title with body included", query: "title:transformer", includeBody: true, wantBody: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := compileSearch(model.SearchQuery{Query: tt.query, IncludeBody: tt.includeBody}, []string{"english"})
+			if err != nil {
+				t.Fatalf("compileSearch() error = %v", err)
+			}
+			if got := strings.Contains(c.where, "BodyData"); got != tt.wantBody {
+				t.Errorf("condition %q matches the body = %v, want %v", c.where, got, tt.wantBody)
+			}
+			if got := strings.Contains(c.rankExpr(), "BodyData"); got != tt.includeBody {
+				t.Errorf("rank %q ranks by the body = %v, want %v", c.rankExpr(), got, tt.includeBody)
+			}
+		})
+	}
+}
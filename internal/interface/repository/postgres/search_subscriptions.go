@@ -5,9 +5,11 @@ import (
 	"github.com/mp-hl-2021/unarXiv/internal/domain"
 	"github.com/mp-hl-2021/unarXiv/internal/domain/model"
 	"github.com/mp-hl-2021/unarXiv/internal/interface/utils"
+	"net/url"
+	"strconv"
 	"time"
 
-	_ "github.com/lib/pq"
+	"github.com/lib/pq"
 )
 
 type SearchSubscriptionRepo struct {
@@ -18,26 +20,98 @@ func NewSearchSubscriptionRepo(db *sql.DB) *SearchSubscriptionRepo {
 	return &SearchSubscriptionRepo{db: db}
 }
 
-func (a *SearchSubscriptionRepo) GetSearchSubscriptions(id model.UserId) ([]string, error) {
-	rows, err := a.db.Query("SELECT Search FROM AccountSearchRelations where UserId = $1;", id)
+// encodeSearchFilters serializes everything but the query text that makes a
+// search distinct, so that the same search always maps to the same row.
+func encodeSearchFilters(query model.SearchQuery) string {
+	v := url.Values{}
+	if f := query.Filters; f.UpdatedAfter != 0 {
+		v.Set("updated_after", strconv.FormatUint(f.UpdatedAfter, 10))
+	}
+	if f := query.Filters; f.UpdatedBefore != 0 {
+		v.Set("updated_before", strconv.FormatUint(f.UpdatedBefore, 10))
+	}
+	if query.Filters.Author != "" {
+		v.Set("author", query.Filters.Author)
+	}
+	if query.Filters.Category != "" {
+		v.Set("category", query.Filters.Category)
+	}
+	if query.SortOrder != "" && query.SortOrder != model.SortByRelevance {
+		v.Set("sort", string(query.SortOrder))
+	}
+	if query.IncludeBody {
+		v.Set("body", "true")
+	}
+	return v.Encode()
+}
+
+func decodeSearchFilters(search, filters string) (model.SearchQuery, error) {
+	query := model.SearchQuery{Query: search}
+	v, err := url.ParseQuery(filters)
 	if err != nil {
-		return nil, err
+		return query, err
 	}
-	defer rows.Close()
-	subs := []string{}
+	if s := v.Get("updated_after"); s != "" {
+		if query.Filters.UpdatedAfter, err = strconv.ParseUint(s, 10, 64); err != nil {
+			return query, err
+		}
+	}
+	if s := v.Get("updated_before"); s != "" {
+		if query.Filters.UpdatedBefore, err = strconv.ParseUint(s, 10, 64); err != nil {
+			return query, err
+		}
+	}
+	query.Filters.Author = v.Get("author")
+	query.Filters.Category = v.Get("category")
+	query.SortOrder = model.SearchSortOrder(v.Get("sort"))
+	query.IncludeBody = v.Get("body") == "true"
+	return query, nil
+}
+
+// scanSearchQueries reads rows of (Search, Filters, LastAccess) and returns the
+// page of queries and the key of the next page in the order of keyColumns.
+func scanSearchQueries(rows *sql.Rows, page model.PageRequest, keyColumns func(search, filters string, lastAccess uint64) model.PageKey) ([]model.SearchQuery, model.PageKey, error) {
+	result := []model.SearchQuery{}
+	var next model.PageKey
 	for rows.Next() {
-		var query string
-		if err := rows.Scan(&query); err != nil {
-			return nil, err
-		} else {
-			subs = append(subs, query)
+		var search, filters string
+		var lastAccess uint64
+		if err := rows.Scan(&search, &filters, &lastAccess); err != nil {
+			return nil, nil, err
 		}
+		if hasNextPage(page, len(result)+1) {
+			return result, next, nil
+		}
+		query, err := decodeSearchFilters(search, filters)
+		if err != nil {
+			return nil, nil, err
+		}
+		result = append(result, query)
+		next = keyColumns(search, filters, lastAccess)
+	}
+	return result, nil, rows.Err()
+}
+
+func (a *SearchSubscriptionRepo) GetSearchSubscriptions(id model.UserId, page model.PageRequest) ([]model.SearchQuery, model.PageKey, error) {
+	after, err := pageKeyArgs(page, 2)
+	if err != nil {
+		return nil, nil, err
+	}
+	rows, err := a.db.Query(`
+		SELECT Search, Filters, LastAccess FROM AccountSearchRelations
+		WHERE UserId = $1 AND IsSubscribed = true AND ($2::text IS NULL OR (Search, Filters) > ($2, $3))
+		ORDER BY Search, Filters LIMIT $4;`, id, after[0], after[1], pageLimitArg(page))
+	if err != nil {
+		return nil, nil, err
 	}
-	return subs, nil
+	defer rows.Close()
+	return scanSearchQueries(rows, page, func(search, filters string, _ uint64) model.PageKey {
+		return model.PageKey{search, filters}
+	})
 }
 
-func (a *SearchSubscriptionRepo) IsSubscribedForSearch(id model.UserId, query string) (bool, error) {
-	rows, err := a.db.Query("SELECT IsSubscribed FROM AccountSearchRelations WHERE UserId = $1 AND Search = $2;", id, query)
+func (a *SearchSubscriptionRepo) IsSubscribedForSearch(id model.UserId, query model.SearchQuery) (bool, error) {
+	rows, err := a.db.Query("SELECT IsSubscribed FROM AccountSearchRelations WHERE UserId = $1 AND Search = $2 AND Filters = $3;", id, query.Query, encodeSearchFilters(query))
 	if err != nil {
 		return false, err
 	}
@@ -50,8 +124,8 @@ func (a *SearchSubscriptionRepo) IsSubscribedForSearch(id model.UserId, query st
 	return false, nil
 }
 
-func (a *SearchSubscriptionRepo) createRelationIfNotExists(userId model.UserId, query string) error {
-	rows, err := a.db.Query("SELECT IsSubscribed FROM AccountSearchRelations WHERE UserId = $1 AND Search = $2;", userId, query)
+func (a *SearchSubscriptionRepo) createRelationIfNotExists(userId model.UserId, query model.SearchQuery) error {
+	rows, err := a.db.Query("SELECT IsSubscribed FROM AccountSearchRelations WHERE UserId = $1 AND Search = $2 AND Filters = $3;", userId, query.Query, encodeSearchFilters(query))
 	if err != nil {
 		return err
 	}
@@ -62,8 +136,8 @@ func (a *SearchSubscriptionRepo) createRelationIfNotExists(userId model.UserId,
 	}
 	if !relationExists {
 		_, err := a.db.Exec(
-			"INSERT INTO AccountSearchRelations (UserId, Search, IsSubscribed, LastAccess) VALUES ($1, $2, false, $3);",
-			userId, query, utils.Uint64Time(time.Now()))
+			"INSERT INTO AccountSearchRelations (UserId, Search, Filters, IsSubscribed, LastAccess) VALUES ($1, $2, $3, false, $4);",
+			userId, query.Query, encodeSearchFilters(query), utils.Uint64Time(time.Now()))
 		if err != nil {
 			return err
 		}
@@ -71,7 +145,7 @@ func (a *SearchSubscriptionRepo) createRelationIfNotExists(userId model.UserId,
 	return nil
 }
 
-func (a *SearchSubscriptionRepo) SubscribeForSearch(id model.UserId, query string) error {
+func (a *SearchSubscriptionRepo) SubscribeForSearch(id model.UserId, query model.SearchQuery) error {
 	if ok, _ := a.IsSubscribedForSearch(id, query); ok {
 		return domain.AlreadySubscribed
 	}
@@ -79,35 +153,35 @@ func (a *SearchSubscriptionRepo) SubscribeForSearch(id model.UserId, query strin
 	if err != nil {
 		return err
 	}
-	_, err = a.db.Exec("UPDATE AccountSearchRelations SET IsSubscribed = true WHERE UserId = $1 AND Search = $2;", id, query)
+	_, err = a.db.Exec("UPDATE AccountSearchRelations SET IsSubscribed = true WHERE UserId = $1 AND Search = $2 AND Filters = $3;", id, query.Query, encodeSearchFilters(query))
 	if err != nil {
 		return err
 	}
 	return nil
 }
 
-func (a *SearchSubscriptionRepo) UnsubscribeFromSearch(id model.UserId, query string) error {
+func (a *SearchSubscriptionRepo) UnsubscribeFromSearch(id model.UserId, query model.SearchQuery) error {
 	if ok, _ := a.IsSubscribedForSearch(id, query); ok {
-		_, err := a.db.Exec("UPDATE AccountSearchRelations SET IsSubscribed = false WHERE UserId = $1 AND Search = $2;", id, query)
+		_, err := a.db.Exec("UPDATE AccountSearchRelations SET IsSubscribed = false WHERE UserId = $1 AND Search = $2 AND Filters = $3;", id, query.Query, encodeSearchFilters(query))
 		return err
 	} else {
 		return domain.NotSubscribed
 	}
 }
 
-func (a *SearchSubscriptionRepo) SearchAccessOccurred(id model.UserId, query string) error {
+func (a *SearchSubscriptionRepo) SearchAccessOccurred(id model.UserId, query model.SearchQuery) error {
 	err := a.createRelationIfNotExists(id, query)
 	if err != nil {
 		return err
 	}
 	_, err = a.db.Exec(
-		"UPDATE AccountSearchRelations SET LastAccess = $1 WHERE UserId = $2 AND Search = $3;",
-		utils.Uint64Time(time.Now()), id, query)
+		"UPDATE AccountSearchRelations SET LastAccess = $1 WHERE UserId = $2 AND Search = $3 AND Filters = $4;",
+		utils.Uint64Time(time.Now()), id, query.Query, encodeSearchFilters(query))
 	return err
 }
 
-func (a *SearchSubscriptionRepo) GetSearchLastAccessTimestamp(userId model.UserId, query string) (uint64, error) {
-	rows, err := a.db.Query("SELECT LastAccess FROM AccountSearchRelations WHERE UserId = $1 AND Search = $2;", userId, query)
+func (a *SearchSubscriptionRepo) GetSearchLastAccessTimestamp(userId model.UserId, query model.SearchQuery) (uint64, error) {
+	rows, err := a.db.Query("SELECT LastAccess FROM AccountSearchRelations WHERE UserId = $1 AND Search = $2 AND Filters = $3;", userId, query.Query, encodeSearchFilters(query))
 	if err != nil {
 		return 0, err
 	}
@@ -120,22 +194,50 @@ func (a *SearchSubscriptionRepo) GetSearchLastAccessTimestamp(userId model.UserI
 	return 0, domain.NeverAccessed
 }
 
-func (a *SearchSubscriptionRepo) GetSearchHistory(userId model.UserId) ([]string, error) {
-	rows, err := a.db.Query("SELECT ArticleId FROM AccountSearchRelations WHERE UserId = $1;", userId)
+func (a *SearchSubscriptionRepo) GetSearchLastAccessTimestamps(userId model.UserId, queries []model.SearchQuery) ([]uint64, error) {
+	searches := make([]string, len(queries))
+	filters := make([]string, len(queries))
+	for i, query := range queries {
+		searches[i], filters[i] = query.Query, encodeSearchFilters(query)
+	}
+	rows, err := a.db.Query(`
+		SELECT q.Ord, coalesce(r.LastAccess, 0)
+		FROM unnest($2::text[], $3::text[]) WITH ORDINALITY AS q(Search, Filters, Ord)
+		JOIN AccountSearchRelations r ON r.UserId = $1 AND r.Search = q.Search AND r.Filters = q.Filters;`,
+		userId, pq.Array(searches), pq.Array(filters))
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
-	result := []string{}
+	timestamps := make([]uint64, len(queries))
 	for rows.Next() {
-		var query string
-		if err := rows.Scan(&query); err != nil {
+		var ord int
+		var lastAccess uint64
+		if err := rows.Scan(&ord, &lastAccess); err != nil {
 			return nil, err
-		} else {
-			result = append(result, query)
 		}
+		timestamps[ord-1] = lastAccess
 	}
-	return result, nil
+	return timestamps, rows.Err()
+}
+
+func (a *SearchSubscriptionRepo) GetSearchHistory(userId model.UserId, page model.PageRequest) ([]model.SearchQuery, model.PageKey, error) {
+	after, err := pageKeyArgs(page, 3)
+	if err != nil {
+		return nil, nil, err
+	}
+	rows, err := a.db.Query(`
+		SELECT Search, Filters, LastAccess FROM AccountSearchRelations
+		WHERE UserId = $1
+			AND ($2::bigint IS NULL OR LastAccess < $2 OR (LastAccess = $2 AND (Search, Filters) > ($3, $4)))
+		ORDER BY LastAccess DESC, Search, Filters LIMIT $5;`, userId, after[0], after[1], after[2], pageLimitArg(page))
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+	return scanSearchQueries(rows, page, func(search, filters string, lastAccess uint64) model.PageKey {
+		return model.PageKey{strconv.FormatUint(lastAccess, 10), search, filters}
+	})
 }
 
 func (a *SearchSubscriptionRepo) ClearSearchHistory(userId model.UserId) error {
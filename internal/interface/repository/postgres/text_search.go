@@ -0,0 +1,176 @@
+package postgres
+
+import (
+	"database/sql"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/mp-hl-2021/unarXiv/internal/domain"
+	"github.com/mp-hl-2021/unarXiv/internal/domain/language"
+	"github.com/mp-hl-2021/unarXiv/internal/domain/model"
+	"github.com/mp-hl-2021/unarXiv/internal/interface/utils"
+)
+
+// TextSearchConfig selects text search configurations articles are indexed with.
+type TextSearchConfig struct {
+	// Default is the configuration of articles in an unknown language, "english" if empty.
+	Default string
+	// DetectLanguage enables per-article configurations for languages detected in titles and abstracts.
+	DetectLanguage bool
+}
+
+var configNameRegexp = regexp.MustCompile(`^[a-z_][a-z0-9_]*$`)
+
+func (t TextSearchConfig) defaultConfig() string {
+	if t.Default == "" {
+		return "english"
+	}
+	return t.Default
+}
+
+// Validate checks the configuration name, as it is inlined into queries.
+// Whether Postgres knows the configuration is only found out by the first query.
+func (t TextSearchConfig) Validate() error {
+	if !configNameRegexp.MatchString(t.defaultConfig()) {
+		return fmt.Errorf("invalid text search configuration name %q", t.Default)
+	}
+	return nil
+}
+
+// configFor returns the configuration to index an article with.
+func (t TextSearchConfig) configFor(title, abstract string) string {
+	if t.DetectLanguage {
+		if lang, ok := language.Detect(title + "\n" + abstract); ok {
+			return string(lang)
+		}
+	}
+	return t.defaultConfig()
+}
+
+// configs returns all configurations articles may be indexed with. Queries are
+// built with each of them, so that they match articles in any language.
+func (t TextSearchConfig) configs() []string {
+	configs := []string{t.defaultConfig()}
+	if t.DetectLanguage {
+		for _, lang := range language.Supported() {
+			if string(lang) != configs[0] {
+				configs = append(configs, string(lang))
+			}
+		}
+	}
+	return configs
+}
+
+// indexArticlesQuery rebuilds index rows of articles given as parallel arrays of
+// ids and configurations. The indexed document is the title with weight A, authors
+// with weight B and the abstract with weight C. Names are not stemmed. The full
+// text, if there is one, is indexed separately with weight D, as it is only
+// searched on request.
+const indexArticlesQuery = `
+INSERT INTO ArticlesFTS (Id, Config, TextData, BodyData)
+SELECT a.Id, c.Config,
+    setweight(to_tsvector(c.Config, coalesce(a.Title, '')), 'A') ||
+    setweight(to_tsvector('simple', coalesce(
+        (SELECT string_agg(au.AuthorName, ' ') FROM AuthorsOfArticles au WHERE au.ArticleId = a.Id), '')), 'B') ||
+    setweight(to_tsvector(c.Config, coalesce(a.Abstract, '')), 'C'),
+    (SELECT setweight(to_tsvector(c.Config, b.Body), 'D') FROM ArticleBodies b WHERE b.ArticleId = a.Id)
+FROM unnest($1::text[], $2::regconfig[]) AS c(Id, Config)
+JOIN Articles a ON a.Id = c.Id
+ON CONFLICT (Id) DO UPDATE SET Config = EXCLUDED.Config, TextData = EXCLUDED.TextData, BodyData = EXCLUDED.BodyData;
+`
+
+type execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+type indexedArticle struct {
+	id       string
+	title    string
+	abstract string
+}
+
+func (a *ArticleRepo) indexArticles(db execer, articles []indexedArticle) error {
+	ids := make([]string, len(articles))
+	configs := make([]string, len(articles))
+	for i, article := range articles {
+		ids[i] = article.id
+		configs[i] = a.textSearch.configFor(article.title, article.abstract)
+	}
+	_, err := db.Exec(indexArticlesQuery, pq.Array(ids), pq.Array(configs))
+	return err
+}
+
+// Reindex rebuilds the index of all articles in batches of batchSize, calling
+// progress with the number of articles reindexed so far after each batch.
+func (a *ArticleRepo) Reindex(batchSize int, progress func(done int)) (int, error) {
+	done := 0
+	last := ""
+	for {
+		batch, err := a.articlesAfter(last, batchSize)
+		if err != nil {
+			return done, err
+		}
+		if len(batch) == 0 {
+			return done, nil
+		}
+		if err := a.indexArticles(a.db, batch); err != nil {
+			return done, err
+		}
+		done += len(batch)
+		last = batch[len(batch)-1].id
+		progress(done)
+	}
+}
+
+// maxBodyLength keeps full texts well below the limit of tsvector size.
+const maxBodyLength = 256 << 10
+
+func (a *ArticleRepo) UpdateArticleBody(id model.ArticleId, body string) error {
+	if len(body) > maxBodyLength {
+		body = strings.ToValidUTF8(body[:maxBodyLength], "")
+	}
+	tx, err := a.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	var article indexedArticle
+	err = tx.QueryRow("SELECT Id, coalesce(Title, ''), coalesce(Abstract, '') FROM Articles WHERE Id = $1;", id).
+		Scan(&article.id, &article.title, &article.abstract)
+	if err == sql.ErrNoRows {
+		return domain.ArticleNotFound
+	}
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(`INSERT INTO ArticleBodies (ArticleId, Body, ExtractedAt) VALUES ($1, $2, $3)
+ON CONFLICT (ArticleId) DO UPDATE SET Body = EXCLUDED.Body, ExtractedAt = EXCLUDED.ExtractedAt;`,
+		id, body, utils.Uint64Time(time.Now()))
+	if err != nil {
+		return err
+	}
+	if err := a.indexArticles(tx, []indexedArticle{article}); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (a *ArticleRepo) articlesAfter(id string, limit int) ([]indexedArticle, error) {
+	rows, err := a.db.Query("SELECT Id, coalesce(Title, ''), coalesce(Abstract, '') FROM Articles WHERE Id > $1 ORDER BY Id LIMIT $2;", id, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var articles []indexedArticle
+	for rows.Next() {
+		var article indexedArticle
+		if err := rows.Scan(&article.id, &article.title, &article.abstract); err != nil {
+			return nil, err
+		}
+		articles = append(articles, article)
+	}
+	return articles, rows.Err()
+}
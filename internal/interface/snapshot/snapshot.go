@@ -0,0 +1,189 @@
+// Package snapshot reads the arXiv metadata snapshot, a file with one JSON
+// object per line describing the latest version of every article.
+package snapshot
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/mp-hl-2021/unarXiv/internal/domain/model"
+	"github.com/mp-hl-2021/unarXiv/internal/interface/utils"
+)
+
+const (
+	versionDateLayout = "Mon, 2 Jan 2006 15:04:05 MST"
+	updateDateLayout  = "2006-01-02"
+)
+
+var (
+	ErrNoId      = fmt.Errorf("record has no id")
+	ErrNoTitle   = fmt.Errorf("record has no title")
+	ErrNoAuthors = fmt.Errorf("record has no authors")
+	ErrNoDate    = fmt.Errorf("record has no valid date")
+)
+
+// Record is a line of the snapshot. Only fields imported into articles are decoded.
+type Record struct {
+	Id            string     `json:"id"`
+	Title         string     `json:"title"`
+	Abstract      string     `json:"abstract"`
+	Categories    string     `json:"categories"`
+	Comments      string     `json:"comments"`
+	JournalRef    string     `json:"journal-ref"`
+	DOI           string     `json:"doi"`
+	License       string     `json:"license"`
+	AuthorsParsed [][]string `json:"authors_parsed"`
+	Versions      []struct {
+		Version string `json:"version"`
+		Created string `json:"created"`
+	} `json:"versions"`
+	UpdateDate string `json:"update_date"`
+}
+
+// Article converts the record, absURL being the prefix of abstract page URLs.
+func (r *Record) Article(absURL string) (model.Article, error) {
+	if r.Id == "" {
+		return model.Article{}, ErrNoId
+	}
+	article := model.Article{ArticleMeta: model.ArticleMeta{
+		Id:         model.ArticleId(r.Id),
+		Title:      strings.Join(strings.Fields(r.Title), " "),
+		Abstract:   strings.Join(strings.Fields(r.Abstract), " "),
+		Categories: strings.Fields(r.Categories),
+		Comments:   strings.Join(strings.Fields(r.Comments), " "),
+		JournalRef: strings.Join(strings.Fields(r.JournalRef), " "),
+		DOI:        strings.TrimSpace(r.DOI),
+		License:    strings.TrimSpace(r.License),
+	}}
+	if article.Title == "" {
+		return model.Article{}, ErrNoTitle
+	}
+	for _, parts := range r.AuthorsParsed {
+		// parts are the last name, first names and a suffix
+		name := make([]string, 0, 3)
+		for _, i := range []int{1, 0, 2} {
+			if i < len(parts) && strings.TrimSpace(parts[i]) != "" {
+				name = append(name, strings.TrimSpace(parts[i]))
+			}
+		}
+		if len(name) > 0 {
+			article.Authors = append(article.Authors, strings.Join(name, " "))
+		}
+	}
+	if len(article.Authors) == 0 {
+		return model.Article{}, ErrNoAuthors
+	}
+	timestamp, err := r.updatedAt()
+	if err != nil {
+		return model.Article{}, err
+	}
+	article.LastUpdateTimestamp = utils.Uint64Time(timestamp)
+	if len(r.Versions) > 0 {
+		article.SubmittedAt = versionDate(r.Versions[0].Created)
+		article.LatestVersionAt = versionDate(r.Versions[len(r.Versions)-1].Created)
+	}
+	fullDocumentURL, err := url.Parse(absURL + r.Id)
+	if err != nil {
+		return model.Article{}, err
+	}
+	article.FullDocumentURL = *fullDocumentURL
+	return article, nil
+}
+
+func versionDate(date string) uint64 {
+	t, err := time.Parse(versionDateLayout, date)
+	if err != nil {
+		return 0
+	}
+	return utils.Uint64Time(t)
+}
+
+// updatedAt is the submission time of the latest version, or the date of the
+// latest metadata update if versions are missing.
+func (r *Record) updatedAt() (time.Time, error) {
+	if len(r.Versions) > 0 {
+		if t, err := time.Parse(versionDateLayout, r.Versions[len(r.Versions)-1].Created); err == nil {
+			return t, nil
+		}
+	}
+	if t, err := time.Parse(updateDateLayout, r.UpdateDate); err == nil {
+		return t, nil
+	}
+	return time.Time{}, ErrNoDate
+}
+
+// LineError is a line that is not a valid record.
+type LineError struct {
+	Line int64
+	Err  error
+}
+
+func (e *LineError) Error() string {
+	return fmt.Sprintf("line %d: %v", e.Line, e.Err)
+}
+
+func (e *LineError) Unwrap() error {
+	return e.Err
+}
+
+// Reader reads records line by line. Lines of the snapshot are counted from 1.
+type Reader struct {
+	r    *bufio.Reader
+	line int64
+}
+
+func NewReader(r io.Reader) *Reader {
+	return &Reader{r: bufio.NewReaderSize(r, 1<<20)}
+}
+
+// Line is the number of the line last read.
+func (r *Reader) Line() int64 {
+	return r.line
+}
+
+func (r *Reader) readLine() ([]byte, error) {
+	line, err := r.r.ReadBytes('\n')
+	if err == io.EOF && len(line) > 0 {
+		err = nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	r.line++
+	return line, nil
+}
+
+// Skip skips n lines without decoding them, returning io.EOF if there are fewer.
+func (r *Reader) Skip(n int64) error {
+	for r.line < n {
+		if _, err := r.readLine(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Next returns the next record and io.EOF at the end of the snapshot. A line
+// that is not a valid record is reported as a *LineError, reading may go on
+// after it. Blank lines are skipped.
+func (r *Reader) Next() (Record, error) {
+	for {
+		line, err := r.readLine()
+		if err != nil {
+			return Record{}, err
+		}
+		if len(strings.TrimSpace(string(line))) == 0 {
+			continue
+		}
+		var record Record
+		if err := json.Unmarshal(line, &record); err != nil {
+			return Record{}, &LineError{Line: r.line, Err: err}
+		}
+		return record, nil
+	}
+}
@@ -0,0 +1,177 @@
+// Package warc reads and writes WARC files (ISO 28500), the archive format
+// of web crawls, to record fetched pages and replay them later.
+package warc
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/rand"
+	"fmt"
+	"io"
+	"net/textproto"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const version = "WARC/1.1"
+
+// Record types used by the crawler.
+const (
+	TypeWarcinfo = "warcinfo"
+	TypeResponse = "response"
+	TypeRequest  = "request"
+)
+
+var (
+	ErrBadVersion      = fmt.Errorf("not a WARC record")
+	ErrNoContentLength = fmt.Errorf("record has no valid Content-Length")
+	ErrBadRecordEnd    = fmt.Errorf("record is not followed by two CRLFs")
+)
+
+// Record is a WARC record. Header holds named fields except Content-Length,
+// which is the length of Block.
+type Record struct {
+	Header textproto.MIMEHeader
+	Block  []byte
+}
+
+// NewRecord creates a record of type recordType about targetURI with a new
+// id and the current date.
+func NewRecord(recordType, targetURI, contentType string, block []byte) Record {
+	header := textproto.MIMEHeader{}
+	header.Set("WARC-Type", recordType)
+	header.Set("WARC-Record-ID", newRecordId())
+	header.Set("WARC-Date", time.Now().UTC().Format(time.RFC3339))
+	if targetURI != "" {
+		header.Set("WARC-Target-URI", targetURI)
+	}
+	if contentType != "" {
+		header.Set("Content-Type", contentType)
+	}
+	return Record{Header: header, Block: block}
+}
+
+func (r *Record) Type() string {
+	return r.Header.Get("WARC-Type")
+}
+
+func (r *Record) TargetURI() string {
+	return r.Header.Get("WARC-Target-URI")
+}
+
+func newRecordId() string {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		panic(err)
+	}
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("<urn:uuid:%x-%x-%x-%x-%x>", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
+
+// Writer writes records, each one as a separate gzip member if compressed,
+// so that files can be appended to and records read independently.
+type Writer struct {
+	w        io.Writer
+	compress bool
+}
+
+func NewWriter(w io.Writer, compress bool) *Writer {
+	return &Writer{w: w, compress: compress}
+}
+
+func (w *Writer) WriteRecord(r Record) error {
+	keys := make([]string, 0, len(r.Header))
+	for key := range r.Header {
+		if key != "Content-Length" {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	var buf bytes.Buffer
+	buf.WriteString(version + "\r\n")
+	for _, key := range keys {
+		for _, value := range r.Header[key] {
+			fmt.Fprintf(&buf, "%s: %s\r\n", fieldName(key), value)
+		}
+	}
+	fmt.Fprintf(&buf, "Content-Length: %d\r\n\r\n", len(r.Block))
+	buf.Write(r.Block)
+	buf.WriteString("\r\n\r\n")
+	if !w.compress {
+		_, err := w.w.Write(buf.Bytes())
+		return err
+	}
+	zw := gzip.NewWriter(w.w)
+	if _, err := zw.Write(buf.Bytes()); err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+// fieldName spells a canonical MIME header key the way the standard does,
+// e.g. WARC-Record-ID for Warc-Record-Id.
+func fieldName(key string) string {
+	parts := strings.Split(key, "-")
+	for i, part := range parts {
+		switch part {
+		case "Warc", "Id", "Uri", "Ip":
+			parts[i] = strings.ToUpper(part)
+		}
+	}
+	return strings.Join(parts, "-")
+}
+
+// Reader reads records of a WARC file, compressed or not.
+type Reader struct {
+	r  *bufio.Reader
+	tp *textproto.Reader
+}
+
+func NewReader(r io.Reader) (*Reader, error) {
+	br := bufio.NewReader(r)
+	if magic, err := br.Peek(2); err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+		// gzip.Reader reads all members as one stream
+		zr, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, err
+		}
+		br = bufio.NewReader(zr)
+	}
+	return &Reader{r: br, tp: textproto.NewReader(br)}, nil
+}
+
+// Next returns the next record, or io.EOF after the last one.
+func (r *Reader) Next() (Record, error) {
+	line, err := r.tp.ReadLine()
+	for err == nil && line == "" {
+		line, err = r.tp.ReadLine()
+	}
+	if err != nil {
+		return Record{}, err
+	}
+	if !strings.HasPrefix(line, "WARC/") {
+		return Record{}, ErrBadVersion
+	}
+	header, err := r.tp.ReadMIMEHeader()
+	if err != nil {
+		return Record{}, err
+	}
+	length, err := strconv.ParseInt(header.Get("Content-Length"), 10, 64)
+	if err != nil || length < 0 {
+		return Record{}, ErrNoContentLength
+	}
+	header.Del("Content-Length")
+	block := make([]byte, length)
+	if _, err := io.ReadFull(r.r, block); err != nil {
+		return Record{}, err
+	}
+	var end [4]byte
+	if _, err := io.ReadFull(r.r, end[:]); err != nil || string(end[:]) != "\r\n\r\n" {
+		return Record{}, ErrBadRecordEnd
+	}
+	return Record{Header: header, Block: block}, nil
+}
@@ -0,0 +1,122 @@
+package warc
+
+import (
+	"bytes"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestWriterReaderRoundTrip(t *testing.T) {
+	response := NewRecord(TypeResponse, "https://arxiv.org/abs/2101.00001", "application/http;msgtype=response",
+		[]byte("HTTP/1.1 200 OK\r\nContent-Type: text/html\r\n\r\n<html>\r\n\r\n</html>"))
+	response.Header.Set("WARC-IP-Address", "127.0.0.1")
+	response.Header.Add("X-Note", "first")
+	response.Header.Add("X-Note", "second")
+	records := []Record{
+		NewRecord(TypeWarcinfo, "", "application/warc-fields", []byte("software: test\r\n")),
+		response,
+		NewRecord(TypeRequest, "https://arxiv.org/pdf/2101.00001", "", nil),
+	}
+	for _, compress := range []bool{false, true} {
+		name := "uncompressed"
+		if compress {
+			name = "compressed"
+		}
+		t.Run(name, func(t *testing.T) {
+			var buf bytes.Buffer
+			w := NewWriter(&buf, compress)
+			for _, r := range records {
+				if err := w.WriteRecord(r); err != nil {
+					t.Fatalf("WriteRecord() error = %v", err)
+				}
+			}
+			if got := buf.Len() > 1 && buf.Bytes()[0] == 0x1f && buf.Bytes()[1] == 0x8b; got != compress {
+				t.Errorf("gzip output = %v, want %v", got, compress)
+			}
+			if !compress && !strings.Contains(buf.String(), "WARC-Record-ID: <urn:uuid:") {
+				t.Errorf("fields are not spelled as in the standard:\n%s", buf.String())
+			}
+
+			r, err := NewReader(&buf)
+			if err != nil {
+				t.Fatalf("NewReader() error = %v", err)
+			}
+			for i, want := range records {
+				got, err := r.Next()
+				if err != nil {
+					t.Fatalf("Next() record %d error = %v", i, err)
+				}
+				if !reflect.DeepEqual(got.Header, want.Header) {
+					t.Errorf("record %d header = %v, want %v", i, got.Header, want.Header)
+				}
+				if !bytes.Equal(got.Block, want.Block) {
+					t.Errorf("record %d block = %q, want %q", i, got.Block, want.Block)
+				}
+			}
+			if _, err := r.Next(); err != io.EOF {
+				t.Errorf("Next() after the last record error = %v, want io.EOF", err)
+			}
+		})
+	}
+}
+
+func TestReaderErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want error
+	}{
+		{
+			name: "not a WARC record",
+			data: "HTTP/1.1 200 OK\r\n\r\n",
+			want: ErrBadVersion,
+		},
+		{
+			name: "no content length",
+			data: "WARC/1.1\r\nWARC-Type: response\r\n\r\n\r\n\r\n",
+			want: ErrNoContentLength,
+		},
+		{
+			name: "negative content length",
+			data: "WARC/1.1\r\nContent-Length: -1\r\n\r\n\r\n\r\n",
+			want: ErrNoContentLength,
+		},
+		{
+			name: "block longer than its record",
+			data: "WARC/1.1\r\nContent-Length: 4\r\n\r\nabcdefgh",
+			want: ErrBadRecordEnd,
+		},
+		{
+			name: "truncated block",
+			data: "WARC/1.1\r\nContent-Length: 100\r\n\r\nabc",
+			want: io.ErrUnexpectedEOF,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := NewReader(strings.NewReader(tt.data))
+			if err != nil {
+				t.Fatalf("NewReader() error = %v", err)
+			}
+			if _, err := r.Next(); err != tt.want {
+				t.Errorf("Next() error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestFieldName(t *testing.T) {
+	tests := map[string]string{
+		"Warc-Record-Id":  "WARC-Record-ID",
+		"Warc-Target-Uri": "WARC-Target-URI",
+		"Warc-Ip-Address": "WARC-IP-Address",
+		"Content-Type":    "Content-Type",
+	}
+	for key, want := range tests {
+		if got := fieldName(key); got != want {
+			t.Errorf("fieldName(%q) = %q, want %q", key, got, want)
+		}
+	}
+}
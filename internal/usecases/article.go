@@ -4,4 +4,9 @@ import "github.com/mp-hl-2021/unarXiv/internal/domain/model"
 
 type ArticleInterface interface {
     AccessArticle(articleId model.ArticleId, userId *model.UserId) (model.Article, error)
+    RelatedArticles(articleId model.ArticleId, limit uint32, userId *model.UserId) ([]model.RelatedArticle, error)
+    ArticleVersions(articleId model.ArticleId) ([]model.ArticleVersion, error)
+    // DiffArticleVersions compares two recorded versions. Zero to means the latest
+    // recorded version, zero from means the recorded version preceding to.
+    DiffArticleVersions(articleId model.ArticleId, from, to uint32) (model.VersionDiff, error)
 }
@@ -7,11 +7,11 @@ type ArticleUserRelationsInterface interface {
 	UnsubscribeFromArticle(userId model.UserId, articleId model.ArticleId) error
 	CheckArticleSubscription(userId model.UserId, articleId model.ArticleId) (*model.UserArticleSubscription, error)
 
-	GetArticleSubscriptions(userId model.UserId) ([]model.UserArticleSubscription, error)
+	GetArticleSubscriptions(userId model.UserId, page model.PageRequest) ([]model.UserArticleSubscription, model.PageKey, error)
 
-	GetArticleUpdates(userId model.UserId) ([]model.ArticleMeta, error)
+	GetArticleUpdates(userId model.UserId, page model.PageRequest) ([]model.UserArticleMeta, model.PageKey, error)
 
-	GetArticleHistory(id model.UserId) (model.UserArticleHistory, error)
+	GetArticleHistory(id model.UserId, page model.PageRequest) (model.UserArticleHistory, error)
 	ClearArticleHistory(id model.UserId) error
 	GetArticleLastAccess(userId model.UserId, articleId model.ArticleId) (model.UserArticleAccess, error)
 }
@@ -3,16 +3,16 @@ package usecases
 import "github.com/mp-hl-2021/unarXiv/internal/domain/model"
 
 type SearchUserRelationsInterface interface {
-	SubscribeForSearch(userId model.UserId, query string) (model.UserSearchSubscription, error)
-	UnsubscribeFromSearch(userId model.UserId, query string) error
-	CheckSearchSubscription(userId model.UserId, query string) (*model.UserSearchSubscription, error)
+	SubscribeForSearch(userId model.UserId, query model.SearchQuery) (model.UserSearchSubscription, error)
+	UnsubscribeFromSearch(userId model.UserId, query model.SearchQuery) error
+	CheckSearchSubscription(userId model.UserId, query model.SearchQuery) (*model.UserSearchSubscription, error)
 
-	GetSearchSubscriptions(userId model.UserId) ([]model.UserSearchSubscription, error)
+	GetSearchSubscriptions(userId model.UserId, page model.PageRequest) ([]model.UserSearchSubscription, model.PageKey, error)
 
-	GetSearchUpdates(userId model.UserId) ([]string, error)
+	GetSearchUpdates(userId model.UserId, page model.PageRequest) ([]model.SearchQuery, model.PageKey, error)
 
-	GetSearchHistory(id model.UserId) (model.UserSearchHistory, error)
+	GetSearchHistory(id model.UserId, page model.PageRequest) (model.UserSearchHistory, error)
 	ClearSearchHistory(id model.UserId) error
 
-	GetSearchLastAccess(userId model.UserId, query string) (model.UserSearchAccess, error)
+	GetSearchLastAccess(userId model.UserId, query model.SearchQuery) (model.UserSearchAccess, error)
 }
@@ -0,0 +1,170 @@
+package usecases
+
+import (
+	"context"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mp-hl-2021/unarXiv/internal/domain/model"
+	"github.com/mp-hl-2021/unarXiv/internal/domain/repository"
+	"github.com/mp-hl-2021/unarXiv/internal/domain/searchquery"
+	"github.com/mp-hl-2021/unarXiv/internal/domain/spelling"
+)
+
+type SuggestInterface interface {
+	// Suggest returns completions of a partially typed query.
+	Suggest(prefix string, limit uint32) ([]model.Suggestion, error)
+}
+
+const (
+	defaultSuggestLimit = 10
+	maxSuggestLimit     = 20
+
+	// lexiconSize bounds dictionaries to the most frequent words.
+	lexiconSize = 100000
+	lexiconTTL  = 10 * time.Minute
+	// lexiconRefreshInterval is how often words are recounted in all articles.
+	lexiconRefreshInterval = 24 * time.Hour
+	// lexiconRetryInterval is how soon a failed build is retried.
+	lexiconRetryInterval = time.Minute
+
+	// didYouMeanMaxMatches is the number of matches below which corrections are suggested.
+	didYouMeanMaxMatches = 3
+)
+
+// lexicon keeps dictionaries built from the whole corpus in memory. Loading
+// them takes longer than a request may, so they are loaded in the background
+// by KeepSuggestionsFresh, from words recounted every lexiconRefreshInterval.
+type lexicon struct {
+	repo repository.LexiconRepo
+
+	mu     sync.RWMutex
+	titles *spelling.Dictionary
+	words  *spelling.Dictionary
+}
+
+// KeepSuggestionsFresh loads dictionaries of suggestions and corrections and
+// reloads them every lexiconTTL, until ctx is done. Until they are first
+// loaded, only past queries are suggested.
+func (u *usecasesThroughRepos) KeepSuggestionsFresh(ctx context.Context) {
+	u.lexicon.keepFresh(ctx)
+}
+
+func (l *lexicon) keepFresh(ctx context.Context) {
+	// words were counted when the schema was created or at the last refresh,
+	// which another instance may have done, so they are not recounted at startup
+	nextRefresh := time.Now().Add(lexiconRefreshInterval)
+	for {
+		wait := lexiconTTL
+		if !time.Now().Before(nextRefresh) {
+			if err := l.repo.RefreshWords(); err != nil {
+				log.Printf("Error happened while counting words: %v", err)
+			} else {
+				nextRefresh = time.Now().Add(lexiconRefreshInterval)
+			}
+		}
+		if err := l.rebuild(); err != nil {
+			log.Printf("Error happened while building dictionaries: %v", err)
+			wait = lexiconRetryInterval
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+	}
+}
+
+func (l *lexicon) rebuild() error {
+	titleTerms, err := l.repo.TitleTerms(lexiconSize)
+	if err != nil {
+		return err
+	}
+	allWords, err := l.repo.Words(lexiconSize)
+	if err != nil {
+		return err
+	}
+	titles, words := spelling.NewDictionary(titleTerms), spelling.NewDictionary(allWords)
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.titles, l.words = titles, words
+	return nil
+}
+
+// dictionaries returns the latest dictionaries, nil until they are first built.
+func (l *lexicon) dictionaries() (titles, words *spelling.Dictionary) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.titles, l.words
+}
+
+func (u *usecasesThroughRepos) Suggest(prefix string, limit uint32) ([]model.Suggestion, error) {
+	if limit == 0 {
+		limit = defaultSuggestLimit
+	}
+	if limit > maxSuggestLimit {
+		limit = maxSuggestLimit
+	}
+	prefix = strings.TrimLeft(prefix, " ")
+	if prefix == "" {
+		return nil, nil
+	}
+	queries, err := u.lexiconRepo.PopularQueries(prefix, limit)
+	if err != nil {
+		return nil, err
+	}
+	seen := make(map[string]bool)
+	var result []model.Suggestion
+	for _, q := range queries {
+		seen[q.Term] = true
+		result = append(result, model.Suggestion{Text: q.Term, Source: model.SuggestedQuery})
+	}
+
+	// complete the last word, keeping the rest of the prefix as typed
+	lastWord := prefix[strings.LastIndex(prefix, " ")+1:]
+	titles, _ := u.lexicon.dictionaries()
+	if titles == nil {
+		return result, nil
+	}
+	for _, term := range titles.Complete(lastWord, int(limit)) {
+		if uint32(len(result)) >= limit {
+			break
+		}
+		text := prefix[:len(prefix)-len(lastWord)] + term
+		if !seen[text] {
+			seen[text] = true
+			result = append(result, model.Suggestion{Text: text, Source: model.SuggestedTerm})
+		}
+	}
+	return result, nil
+}
+
+// didYouMean corrects misspelled words of a query, returns an empty string if
+// all words are known or have no close match.
+func (u *usecasesThroughRepos) didYouMean(query string) (string, error) {
+	root, err := searchquery.Parse(query)
+	if err != nil {
+		return "", err
+	}
+	_, words := u.lexicon.dictionaries()
+	if words == nil {
+		return "", nil
+	}
+	corrected := false
+	result := searchquery.ReplaceTerms(query, searchquery.PositiveTerms(root), func(t searchquery.Term) (string, bool) {
+		if !t.Field.IsText() || t.Phrase || t.Prefix {
+			return "", false
+		}
+		word, ok := words.Correct(t.Text)
+		corrected = corrected || ok
+		return word, ok
+	})
+	if !corrected {
+		return "", nil
+	}
+	return result, nil
+}
@@ -1,8 +1,12 @@
 package usecases
 
 import (
+	"log"
+
+	"github.com/mp-hl-2021/unarXiv/internal/domain"
 	"github.com/mp-hl-2021/unarXiv/internal/domain/model"
 	"github.com/mp-hl-2021/unarXiv/internal/domain/repository"
+	"github.com/mp-hl-2021/unarXiv/internal/domain/searchquery"
 )
 
 type Interface interface {
@@ -11,6 +15,26 @@ type Interface interface {
 	SearchInterface
 	ArticleUserRelationsInterface
 	SearchUserRelationsInterface
+	SuggestInterface
+}
+
+const (
+	defaultPageLimit = 20
+	maxPageLimit     = 100
+
+	defaultRelatedLimit = 10
+	maxRelatedLimit     = 50
+)
+
+// capPage applies the default page size and caps the one requested by a client.
+func capPage(page model.PageRequest) model.PageRequest {
+	if page.Limit == 0 {
+		page.Limit = defaultPageLimit
+	}
+	if page.Limit > maxPageLimit {
+		page.Limit = maxPageLimit
+	}
+	return page
 }
 
 type usecasesThroughRepos struct {
@@ -19,6 +43,8 @@ type usecasesThroughRepos struct {
 	updatesRepo              repository.UpdatesRepo
 	articleUserRelationsRepo repository.ArticleUserRelationsRepo
 	searchUserRelationsRepo  repository.SearchUserRelationsRepo
+	lexiconRepo              repository.LexiconRepo
+	lexicon                  *lexicon
 }
 
 func NewUsecases(
@@ -26,13 +52,16 @@ func NewUsecases(
 	articleRepo repository.ArticleRepo,
 	updatesRepo repository.UpdatesRepo,
 	articleUserRelationsRepo repository.ArticleUserRelationsRepo,
-	searchUserRelationsRepo repository.SearchUserRelationsRepo) *usecasesThroughRepos {
+	searchUserRelationsRepo repository.SearchUserRelationsRepo,
+	lexiconRepo repository.LexiconRepo) *usecasesThroughRepos {
 	return &usecasesThroughRepos{
 		auth:                     auth,
 		articleRepo:              articleRepo,
 		updatesRepo:              updatesRepo,
 		articleUserRelationsRepo: articleUserRelationsRepo,
 		searchUserRelationsRepo:  searchUserRelationsRepo,
+		lexiconRepo:              lexiconRepo,
+		lexicon:                  &lexicon{repo: lexiconRepo},
 	}
 }
 
@@ -61,27 +90,146 @@ func (u *usecasesThroughRepos) AccessArticle(articleId model.ArticleId, userId *
 	return article, nil
 }
 
+func (u *usecasesThroughRepos) RelatedArticles(articleId model.ArticleId, limit uint32, userId *model.UserId) ([]model.RelatedArticle, error) {
+	if limit == 0 {
+		limit = defaultRelatedLimit
+	}
+	if limit > maxRelatedLimit {
+		limit = maxRelatedLimit
+	}
+	related, err := u.articleRepo.RelatedArticles(articleId, limit)
+	if err != nil {
+		return nil, err
+	}
+	if userId != nil {
+		articles := make([]*model.UserArticleMeta, len(related))
+		for i := range related {
+			articles[i] = &related[i].UserArticleMeta
+		}
+		if err := u.attachUserRelations(*userId, articles); err != nil {
+			return nil, err
+		}
+	}
+	return related, nil
+}
+
+func (u *usecasesThroughRepos) ArticleVersions(articleId model.ArticleId) ([]model.ArticleVersion, error) {
+	return u.articleRepo.ArticleVersions(articleId)
+}
+
+func (u *usecasesThroughRepos) DiffArticleVersions(articleId model.ArticleId, from, to uint32) (model.VersionDiff, error) {
+	versions, err := u.articleRepo.ArticleVersions(articleId)
+	if err != nil {
+		return model.VersionDiff{}, err
+	}
+	var recorded []model.ArticleVersion
+	for _, v := range versions {
+		if v.Recorded {
+			recorded = append(recorded, v)
+		}
+	}
+	find := func(version uint32) (int, error) {
+		for i := range recorded {
+			if recorded[i].Version == version {
+				return i, nil
+			}
+		}
+		for _, v := range versions {
+			if v.Version == version {
+				return 0, domain.VersionNotRecorded
+			}
+		}
+		return 0, domain.VersionNotFound
+	}
+	toIdx := len(recorded) - 1
+	if to != 0 {
+		if toIdx, err = find(to); err != nil {
+			return model.VersionDiff{}, err
+		}
+	}
+	fromIdx := toIdx - 1
+	if from != 0 {
+		if fromIdx, err = find(from); err != nil {
+			return model.VersionDiff{}, err
+		}
+	}
+	if fromIdx < 0 || toIdx < 0 {
+		return model.VersionDiff{}, domain.VersionNotRecorded
+	}
+	return recorded[fromIdx].Diff(recorded[toIdx]), nil
+}
+
 func (u *usecasesThroughRepos) Search(query model.SearchQuery, userId *model.UserId) (model.SearchResult, error) {
-	result, err := u.articleRepo.Search(query, 100)
+	query.Page = capPage(query.Page)
+	result, err := u.articleRepo.Search(query)
 	if err != nil {
 		return model.SearchResult{}, err
 	}
+	if result.TotalMatchesCount < didYouMeanMaxMatches {
+		// a failed correction is not worth failing the search
+		if didYouMean, err := u.didYouMean(query.Query); err == nil {
+			result.DidYouMean = didYouMean
+		} else {
+			log.Printf("Error happened while correcting query %q: %v", query.Query, err)
+		}
+	}
 	if userId != nil {
-		if err := u.searchUserRelationsRepo.SearchAccessOccurred(*userId, query.Query); err != nil {
+		articles := make([]*model.UserArticleMeta, len(result.Articles))
+		for i := range result.Articles {
+			articles[i] = &result.Articles[i].UserArticleMeta
+		}
+		if err := u.attachUserRelations(*userId, articles); err != nil {
+			return model.SearchResult{}, err
+		}
+		if err := u.searchUserRelationsRepo.SearchAccessOccurred(*userId, query); err != nil {
 			return model.SearchResult{}, err
 		}
 	}
 	return result, err
 }
 
-func (u *usecasesThroughRepos) GetSearchHistory(id model.UserId) (model.UserSearchHistory, error) {
-	queries, err := u.searchUserRelationsRepo.GetSearchHistory(id)
+// attachUserRelations fills in Relation of every article with a single batched lookup.
+func (u *usecasesThroughRepos) attachUserRelations(userId model.UserId, articles []*model.UserArticleMeta) error {
+	if len(articles) == 0 {
+		return nil
+	}
+	ids := make([]model.ArticleId, len(articles))
+	for i := range articles {
+		ids[i] = articles[i].Id
+	}
+	relations, err := u.articleUserRelationsRepo.GetArticleRelations(userId, ids)
+	if err != nil {
+		return err
+	}
+	for i := range articles {
+		relation := relations[articles[i].Id]
+		articles[i].Relation = &relation
+	}
+	return nil
+}
+
+func (u *usecasesThroughRepos) metasForUser(userId model.UserId, metas []model.ArticleMeta) ([]model.UserArticleMeta, error) {
+	result := make([]model.UserArticleMeta, len(metas))
+	articles := make([]*model.UserArticleMeta, len(metas))
+	for i := range metas {
+		result[i].ArticleMeta = metas[i]
+		articles[i] = &result[i]
+	}
+	if err := u.attachUserRelations(userId, articles); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func (u *usecasesThroughRepos) GetSearchHistory(id model.UserId, page model.PageRequest) (model.UserSearchHistory, error) {
+	queries, next, err := u.searchUserRelationsRepo.GetSearchHistory(id, capPage(page))
 	if err != nil {
 		return model.UserSearchHistory{}, err
 	}
 	return model.UserSearchHistory{
 		UserId:  id,
 		Queries: queries,
+		Next:    next,
 	}, nil
 }
 
@@ -89,22 +237,23 @@ func (u *usecasesThroughRepos) ClearSearchHistory(id model.UserId) error {
 	return u.searchUserRelationsRepo.ClearSearchHistory(id)
 }
 
-func (u *usecasesThroughRepos) GetArticleHistory(id model.UserId) (model.UserArticleHistory, error) {
-	articles, err := u.articleUserRelationsRepo.GetArticleHistory(id)
+func (u *usecasesThroughRepos) GetArticleHistory(id model.UserId, page model.PageRequest) (model.UserArticleHistory, error) {
+	articles, next, err := u.articleUserRelationsRepo.GetArticleHistory(id, capPage(page))
 	if err != nil {
 		return model.UserArticleHistory{}, err
 	}
-	metas := make([]model.ArticleMeta, 0, len(articles))
-	for _, aid := range articles {
-		if meta, err := u.articleRepo.ArticleMetaById(aid); err == nil {
-			metas = append(metas, meta)
-		} else {
-			return model.UserArticleHistory{}, err
-		}
+	metas, err := u.articleRepo.ArticleMetasByIds(articles)
+	if err != nil {
+		return model.UserArticleHistory{}, err
+	}
+	userMetas, err := u.metasForUser(id, metas)
+	if err != nil {
+		return model.UserArticleHistory{}, err
 	}
 	return model.UserArticleHistory{
 		UserId:   id,
-		Articles: metas,
+		Articles: userMetas,
+		Next:     next,
 	}, nil
 }
 
@@ -124,7 +273,7 @@ func (u *usecasesThroughRepos) GetArticleLastAccess(userId model.UserId, article
 	}, nil
 }
 
-func (u *usecasesThroughRepos) GetSearchLastAccess(userId model.UserId, query string) (model.UserSearchAccess, error) {
+func (u *usecasesThroughRepos) GetSearchLastAccess(userId model.UserId, query model.SearchQuery) (model.UserSearchAccess, error) {
 	ts, err := u.searchUserRelationsRepo.GetSearchLastAccessTimestamp(userId, query)
 	if err != nil {
 		return model.UserSearchAccess{}, err
@@ -166,10 +315,10 @@ func (u *usecasesThroughRepos) CheckArticleSubscription(userId model.UserId, art
 	}
 }
 
-func (u *usecasesThroughRepos) GetArticleSubscriptions(userId model.UserId) ([]model.UserArticleSubscription, error) {
-	subs, err := u.articleUserRelationsRepo.GetArticleSubscriptions(userId)
+func (u *usecasesThroughRepos) GetArticleSubscriptions(userId model.UserId, page model.PageRequest) ([]model.UserArticleSubscription, model.PageKey, error) {
+	subs, next, err := u.articleUserRelationsRepo.GetArticleSubscriptions(userId, capPage(page))
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	result := make([]model.UserArticleSubscription, len(subs))
 	for i := range subs {
@@ -178,14 +327,18 @@ func (u *usecasesThroughRepos) GetArticleSubscriptions(userId model.UserId) ([]m
 			ArticleId: subs[i],
 		}
 	}
-	return result, nil
+	return result, next, nil
 }
 
-func (u *usecasesThroughRepos) GetArticleUpdates(userId model.UserId) ([]model.ArticleMeta, error) {
-	return u.updatesRepo.GetArticleSubscriptionsUpdates(userId)
+func (u *usecasesThroughRepos) GetArticleUpdates(userId model.UserId, page model.PageRequest) ([]model.UserArticleMeta, model.PageKey, error) {
+	// the relations are loaded by the updates repo to find the updated articles
+	return u.updatesRepo.GetArticleSubscriptionsUpdates(userId, capPage(page))
 }
 
-func (u *usecasesThroughRepos) SubscribeForSearch(userId model.UserId, query string) (model.UserSearchSubscription, error) {
+func (u *usecasesThroughRepos) SubscribeForSearch(userId model.UserId, query model.SearchQuery) (model.UserSearchSubscription, error) {
+	if _, err := searchquery.Parse(query.Query); err != nil {
+		return model.UserSearchSubscription{}, err
+	}
 	err := u.searchUserRelationsRepo.SubscribeForSearch(userId, query)
 	if err != nil {
 		return model.UserSearchSubscription{}, err
@@ -196,11 +349,11 @@ func (u *usecasesThroughRepos) SubscribeForSearch(userId model.UserId, query str
 	}, nil
 }
 
-func (u *usecasesThroughRepos) UnsubscribeFromSearch(userId model.UserId, query string) error {
+func (u *usecasesThroughRepos) UnsubscribeFromSearch(userId model.UserId, query model.SearchQuery) error {
 	return u.searchUserRelationsRepo.UnsubscribeFromSearch(userId, query)
 }
 
-func (u *usecasesThroughRepos) CheckSearchSubscription(userId model.UserId, query string) (*model.UserSearchSubscription, error) {
+func (u *usecasesThroughRepos) CheckSearchSubscription(userId model.UserId, query model.SearchQuery) (*model.UserSearchSubscription, error) {
 	if s, err := u.searchUserRelationsRepo.IsSubscribedForSearch(userId, query); err != nil {
 		return nil, err
 	} else {
@@ -215,10 +368,10 @@ func (u *usecasesThroughRepos) CheckSearchSubscription(userId model.UserId, quer
 	}
 }
 
-func (u *usecasesThroughRepos) GetSearchSubscriptions(userId model.UserId) ([]model.UserSearchSubscription, error) {
-	qs, err := u.searchUserRelationsRepo.GetSearchSubscriptions(userId)
+func (u *usecasesThroughRepos) GetSearchSubscriptions(userId model.UserId, page model.PageRequest) ([]model.UserSearchSubscription, model.PageKey, error) {
+	qs, next, err := u.searchUserRelationsRepo.GetSearchSubscriptions(userId, capPage(page))
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	result := make([]model.UserSearchSubscription, len(qs))
 	for i := range qs {
@@ -227,9 +380,9 @@ func (u *usecasesThroughRepos) GetSearchSubscriptions(userId model.UserId) ([]mo
 			Query:  qs[i],
 		}
 	}
-	return result, nil
+	return result, next, nil
 }
 
-func (u *usecasesThroughRepos) GetSearchUpdates(userId model.UserId) ([]string, error) {
-	return u.updatesRepo.GetSearchSubscriptionsUpdates(userId)
+func (u *usecasesThroughRepos) GetSearchUpdates(userId model.UserId, page model.PageRequest) ([]model.SearchQuery, model.PageKey, error) {
+	return u.updatesRepo.GetSearchSubscriptionsUpdates(userId, capPage(page))
 }
@@ -0,0 +1,94 @@
+ALTER TABLE IF EXISTS ArticlesFTS
+    ADD COLUMN IF NOT EXISTS Config regconfig not null default 'english';
+
+ALTER TABLE IF EXISTS AccountArticleRelations
+    ADD COLUMN IF NOT EXISTS SubscribedAt bigint;
+
+ALTER TABLE IF EXISTS AccountSearchRelations
+    ADD COLUMN IF NOT EXISTS Filters text not null default '';
+
+ALTER TABLE IF EXISTS ArticlesFTS
+    ADD COLUMN IF NOT EXISTS BodyData tsvector;
+
+ALTER TABLE IF EXISTS CrawlerConfig
+    ADD COLUMN IF NOT EXISTS IndexFullText boolean not null default false;
+
+CREATE TABLE IF NOT EXISTS Licenses (
+    Id serial PRIMARY KEY,
+    URL text not null unique
+);
+
+ALTER TABLE IF EXISTS Articles
+    ADD COLUMN IF NOT EXISTS SubmittedAt bigint,
+    ADD COLUMN IF NOT EXISTS LatestVersionAt bigint,
+    ADD COLUMN IF NOT EXISTS DOI text,
+    ADD COLUMN IF NOT EXISTS JournalRef text,
+    ADD COLUMN IF NOT EXISTS Comments text,
+    ADD COLUMN IF NOT EXISTS LicenseId integer REFERENCES Licenses (Id);
+
+ALTER TABLE IF EXISTS CategoriesOfArticles
+    ADD COLUMN IF NOT EXISTS IsPrimary boolean not null default false;
+
+ALTER TABLE IF EXISTS CrawlStatus
+    ADD COLUMN IF NOT EXISTS RetryCount integer not null default 0,
+    ADD COLUMN IF NOT EXISTS NextAttemptAt bigint,
+    ADD COLUMN IF NOT EXISTS LastError text;
+
+ALTER TABLE IF EXISTS CrawlStatus
+    ADD COLUMN IF NOT EXISTS ETag text,
+    ADD COLUMN IF NOT EXISTS LastModified text,
+    ADD COLUMN IF NOT EXISTS RecrawlInterval bigint,
+    ADD COLUMN IF NOT EXISTS Priority integer not null default 0;
+
+ALTER TABLE IF EXISTS CrawlerConfig
+    ADD COLUMN IF NOT EXISTS IncludePatterns text[] not null default '{}',
+    ADD COLUMN IF NOT EXISTS ExcludePatterns text[] not null default '{}';
+
+ALTER TABLE IF EXISTS CrawlStatus
+    ADD COLUMN IF NOT EXISTS LeasedBy text,
+    ADD COLUMN IF NOT EXISTS LeasedAt bigint,
+    ADD COLUMN IF NOT EXISTS LeaseExpiresAt bigint;
+
+ALTER TABLE IF EXISTS CrawlerConfig
+    ADD COLUMN IF NOT EXISTS Concurrency integer not null default 2,
+    ADD COLUMN IF NOT EXISTS CrawlDelaySeconds double precision not null default 0,
+    ADD COLUMN IF NOT EXISTS Mode text not null default 'discover' CHECK (Mode IN ('discover', 'refresh'));
+
+ALTER TABLE IF EXISTS CrawlStatus
+    ADD COLUMN IF NOT EXISTS RootURL text;
+
+-- URLs queued before configurations had pipelines of their own belong to the
+-- configuration they were found under. The queue index is recreated per
+-- configuration by initdb.sql.
+DO $$
+BEGIN
+    IF to_regclass('crawlstatus') IS NOT NULL AND to_regclass('crawlerconfig') IS NOT NULL THEN
+        UPDATE CrawlStatus s SET RootURL = c.RootURL
+        FROM CrawlerConfig c
+        WHERE s.RootURL IS NULL AND s.URL LIKE c.RootURL || '%';
+    END IF;
+    IF EXISTS (SELECT 1 FROM pg_indexes WHERE indexname = 'idx_crawl_status_queue' AND indexdef NOT ILIKE '%rooturl%') THEN
+        DROP INDEX idx_crawl_status_queue;
+    END IF;
+END $$;
+
+-- URLs were only marked visited before they had states. Visited URLs that
+-- failed permanently are failed, other visited ones are parsed, unless they
+-- were still leased by a worker, in which case they are crawled again.
+ALTER TABLE IF EXISTS CrawlStatus
+    ADD COLUMN IF NOT EXISTS State text not null default 'queued' CHECK (State IN ('queued', 'claimed', 'fetched', 'parsed', 'failed'));
+
+DO $$
+BEGIN
+    IF EXISTS (SELECT 1 FROM information_schema.columns WHERE table_name = 'crawlstatus' AND column_name = 'visited') THEN
+        UPDATE CrawlStatus SET State = CASE
+            WHEN NOT Visited OR LeasedBy IS NOT NULL THEN 'queued'
+            ELSE 'parsed'
+        END, LeasedBy = NULL, LeasedAt = NULL, LeaseExpiresAt = NULL;
+        IF to_regclass('crawlfailures') IS NOT NULL THEN
+            UPDATE CrawlStatus s SET State = 'failed' FROM CrawlFailures f WHERE f.URL = s.URL;
+        END IF;
+        ALTER TABLE CrawlStatus DROP COLUMN Visited;
+        DROP INDEX IF EXISTS idx_crawl_status_queue;
+    END IF;
+END $$;